@@ -0,0 +1,90 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+const (
+	// ConditionReady is True once the platform objects match the spec: for a
+	// service account its user, API key and auth secret, for an organization
+	// its org.
+	ConditionReady = "Ready"
+	// ConditionDryRun is present while the object is reconciled in dry-run
+	// mode. It is True when status.plan holds the actions the operator would
+	// take.
+	ConditionDryRun = "DryRun"
+	// ConditionExpiring is True while a service account with a ttl or
+	// expiresAt is about to expire.
+	ConditionExpiring = "Expiring"
+)
+
+const (
+	// ReasonReconciled means the last reconcile completed without errors.
+	ReasonReconciled = "Reconciled"
+	// ReasonReconcileError means the last reconcile failed with an error that
+	// is recorded in status.error.
+	ReasonReconcileError = "ReconcileError"
+	// ReasonPlatformUnavailable means the platform could not be reached; the
+	// reconcile is retried with backoff.
+	ReasonPlatformUnavailable = "PlatformUnavailable"
+	// ReasonPlatformAuth means the platform rejected the operator's own
+	// credentials. The error is recorded in status.error and the reconcile is
+	// retried rarely until the credentials are fixed.
+	ReasonPlatformAuth = "PlatformAuth"
+	// ReasonPlatformConflict means the platform state changed underneath the
+	// reconcile, e.g. a username that already exists.
+	ReasonPlatformConflict = "PlatformConflict"
+	// ReasonPlatformNotFound means a platform object referenced by the status
+	// no longer exists.
+	ReasonPlatformNotFound = "PlatformNotFound"
+	// ReasonOrgNotReady means the PixoOrganization named by spec.orgRef does
+	// not exist or has no platform org yet.
+	ReasonOrgNotReady = "OrgNotReady"
+	// ReasonInUse means a PixoOrganization is being deleted but service
+	// accounts still reference it, or a PixoServiceAccount is being deleted
+	// but Deployments still use it.
+	ReasonInUse = "InUse"
+	// ReasonConnectionNotReady means the PixoPlatformConnection named by
+	// spec.connectionRef or its credentials Secret does not exist.
+	ReasonConnectionNotReady = "ConnectionNotReady"
+	// ReasonServiceAccountNotReady means the PixoServiceAccount an API key is
+	// issued for, or a binding injects, does not exist or has no platform
+	// user yet.
+	ReasonServiceAccountNotReady = "ServiceAccountNotReady"
+	// ReasonExpired means an API key passed spec.expiresAt and was revoked,
+	// or a service account reached its expiry and is being deleted.
+	ReasonExpired = "Expired"
+	// ReasonExpiring is the reason of the warnings recorded on a service
+	// account and its workloads shortly before the account expires.
+	ReasonExpiring = "Expiring"
+	// ReasonPlanned means a dry run computed the actions in status.plan
+	// without taking them.
+	ReasonPlanned = "Planned"
+	// ReasonSuspended means the account is suspended and the operator leaves
+	// it alone until it is resumed.
+	ReasonSuspended = "Suspended"
+	// ReasonResumed is the reason of the events recorded when a suspended
+	// account is resumed.
+	ReasonResumed = "Resumed"
+	// ReasonServiceAccountDisabled is the reason of the warnings recorded on
+	// workloads that consume a disabled account.
+	ReasonServiceAccountDisabled = "ServiceAccountDisabled"
+	// ReasonOrphanedUser is the reason of the warnings recorded for platform
+	// users that look like the operator's but no service account tracks.
+	ReasonOrphanedUser = "OrphanedUser"
+	// ReasonOrphanedUserDeleted is the reason of the events recorded when
+	// the orphan sweeper deletes such a user.
+	ReasonOrphanedUserDeleted = "OrphanedUserDeleted"
+)
@@ -0,0 +1,146 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+// +kubebuilder:resource:path=pixoapikeys,shortName=pak,singular=pixoapikey,scope=Namespaced
+
+// PixoAPIKeySpec defines the desired state of PixoAPIKey
+type PixoAPIKeySpec struct {
+	// ServiceAccountName is the PixoServiceAccount in the same namespace whose
+	// platform user the key is issued for.
+	// +kubebuilder:validation:MinLength=1
+	ServiceAccountName string `json:"serviceAccountName"`
+	// SecretName is the Secret the key is written to. It defaults to the
+	// name of the PixoAPIKey.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// RotationPeriod, when set, replaces the key with a new one once it is
+	// this old. The old key is revoked after the Secret holds the new one.
+	// +optional
+	RotationPeriod *metav1.Duration `json:"rotationPeriod,omitempty"`
+	// ExpiresAt, when set, revokes the key and removes its Secret at that
+	// time. An expired key is not replaced.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// PixoAPIKeyStatus defines the observed state of PixoAPIKey
+type PixoAPIKeyStatus struct {
+	APIKeyID   int    `json:"apiKeyId,omitempty"`
+	UserID     int    `json:"userId,omitempty"`
+	SecretName string `json:"secretName,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// IssuedAt is when the current key was created.
+	// +optional
+	IssuedAt *metav1.Time `json:"issuedAt,omitempty"`
+	// NextRotationAt is when the current key will be replaced.
+	// +optional
+	NextRotationAt *metav1.Time `json:"nextRotationAt,omitempty"`
+
+	// RequestedAt is when a new key was requested, and PendingAPIKeyID the
+	// key the platform issued for it. Both are set until the key is written
+	// to the Secret, so an interrupted reconcile reuses the key.
+	// +optional
+	RequestedAt *metav1.Time `json:"requestedAt,omitempty"`
+	// +optional
+	PendingAPIKeyID int `json:"pendingApiKeyId,omitempty"`
+	// PriorAPIKeyIDs are the user's keys from before the request, so a key
+	// whose creation response was lost is the one that isn't listed here.
+	// +optional
+	PriorAPIKeyIDs []int `json:"priorApiKeyIds,omitempty"`
+
+	// Plan lists the actions a dry run would take. It is only set while
+	// the API key is in dry-run mode.
+	// +optional
+	Plan []string `json:"plan,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Service Account",type=string,JSONPath=`.spec.serviceAccountName`
+//+kubebuilder:printcolumn:name="Key ID",type=integer,JSONPath=`.status.apiKeyId`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// PixoAPIKey is the Schema for the pixoapikeys API
+type PixoAPIKey struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PixoAPIKeySpec   `json:"spec,omitempty"`
+	Status PixoAPIKeyStatus `json:"status,omitempty"`
+}
+
+func (k *PixoAPIKey) SecretName() string {
+	if k.Spec.SecretName != "" {
+		return k.Spec.SecretName
+	}
+
+	return k.Name
+}
+
+// Expired reports whether the key is past spec.expiresAt at now.
+func (k *PixoAPIKey) Expired(now time.Time) bool {
+	return k.Spec.ExpiresAt != nil && !now.Before(k.Spec.ExpiresAt.Time)
+}
+
+// RotationDue returns when the current key should be replaced, if the key
+// rotates.
+func (k *PixoAPIKey) RotationDue() (time.Time, bool) {
+	if k.Spec.RotationPeriod == nil || k.Status.IssuedAt == nil {
+		return time.Time{}, false
+	}
+
+	return k.Status.IssuedAt.Add(k.Spec.RotationPeriod.Duration), true
+}
+
+func (k *PixoAPIKey) GenerateSecretSpec() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k.SecretName(),
+			Namespace: k.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+}
+
+//+kubebuilder:object:root=true
+
+// PixoAPIKeyList contains a list of PixoAPIKey
+type PixoAPIKeyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PixoAPIKey `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&PixoAPIKey{},
+		&PixoAPIKeyList{},
+	)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+// InjectionStyle is how a binding hands the account's credentials to the
+// containers of a workload.
+// +kubebuilder:validation:Enum=env;envFrom;volume
+type InjectionStyle string
+
+const (
+	// InjectEnv adds PIXO_USERNAME, PIXO_PASSWORD and PIXO_API_KEY
+	// variables, the same ones the service-account-name annotation adds.
+	InjectEnv InjectionStyle = "env"
+	// InjectEnvFrom adds the whole auth Secret as an envFrom source.
+	InjectEnvFrom InjectionStyle = "envFrom"
+	// InjectVolume mounts the auth Secret as a read-only volume.
+	InjectVolume InjectionStyle = "volume"
+)
+
+// DefaultCredentialsMountPath is where the volume injection style mounts the
+// auth Secret when spec.mountPath is not set.
+const DefaultCredentialsMountPath = "/var/run/secrets/pixovr.com"
+
+// +kubebuilder:resource:path=pixocredentialbindings,shortName=pcb,singular=pixocredentialbinding,scope=Namespaced
+
+// PixoCredentialBindingSpec defines the desired state of PixoCredentialBinding
+// +kubebuilder:validation:XValidation:rule="has(self.workloadSelector) || has(self.podSelector)",message="at least one of workloadSelector or podSelector must be set"
+type PixoCredentialBindingSpec struct {
+	// ServiceAccountName is the PixoServiceAccount in the same namespace whose
+	// credentials are injected.
+	// +kubebuilder:validation:MinLength=1
+	ServiceAccountName string `json:"serviceAccountName"`
+	// WorkloadSelector matches Deployments by their own labels.
+	// +optional
+	WorkloadSelector *metav1.LabelSelector `json:"workloadSelector,omitempty"`
+	// PodSelector matches Deployments by the labels of their pod template.
+	// When both selectors are set, a Deployment has to match both.
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// Injection is how the credentials are handed to the containers.
+	// +kubebuilder:default=env
+	// +optional
+	Injection InjectionStyle `json:"injection,omitempty"`
+	// MountPath is where the volume injection style mounts the auth Secret.
+	// It defaults to /var/run/secrets/pixovr.com.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// PixoCredentialBindingStatus defines the observed state of PixoCredentialBinding
+type PixoCredentialBindingStatus struct {
+	// MatchedWorkloads are the names of the Deployments the credentials are
+	// injected into. It is always serialized, so a status patch clears it
+	// once nothing matches.
+	// +optional
+	MatchedWorkloads []string `json:"matchedWorkloads"`
+	// InjectedSecretName is the auth Secret the workloads were last pointed
+	// at.
+	// +optional
+	InjectedSecretName string `json:"injectedSecretName,omitempty"`
+	Error              string `json:"error,omitempty"`
+
+	// Plan lists the actions a dry run would take. It is only set while
+	// the binding is in dry-run mode.
+	// +optional
+	Plan []string `json:"plan,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Service Account",type=string,JSONPath=`.spec.serviceAccountName`
+//+kubebuilder:printcolumn:name="Injection",type=string,JSONPath=`.spec.injection`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// PixoCredentialBinding is the Schema for the pixocredentialbindings API
+type PixoCredentialBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PixoCredentialBindingSpec   `json:"spec,omitempty"`
+	Status PixoCredentialBindingStatus `json:"status,omitempty"`
+}
+
+func (b *PixoCredentialBinding) InjectionStyle() InjectionStyle {
+	if b.Spec.Injection == "" {
+		return InjectEnv
+	}
+
+	return b.Spec.Injection
+}
+
+func (b *PixoCredentialBinding) MountPath() string {
+	if b.Spec.MountPath != "" {
+		return b.Spec.MountPath
+	}
+
+	return DefaultCredentialsMountPath
+}
+
+// VolumeName is the name of the pod volume the volume injection style adds.
+// It is derived from the binding's name, so several bindings can mount into
+// the same workload.
+func (b *PixoCredentialBinding) VolumeName() string {
+	name := "pixo-" + strings.ReplaceAll(b.Name, ".", "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+
+	return name
+}
+
+//+kubebuilder:object:root=true
+
+// PixoCredentialBindingList contains a list of PixoCredentialBinding
+type PixoCredentialBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PixoCredentialBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&PixoCredentialBinding{},
+		&PixoCredentialBindingList{},
+	)
+}
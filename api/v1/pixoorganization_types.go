@@ -0,0 +1,118 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OrgDeletionPolicy decides what happens to the platform org when its
+// PixoOrganization is deleted.
+// +kubebuilder:validation:Enum=Retain;Delete
+type OrgDeletionPolicy string
+
+const (
+	// OrgDeletionPolicyRetain leaves the platform org in place.
+	OrgDeletionPolicyRetain OrgDeletionPolicy = "Retain"
+	// OrgDeletionPolicyDelete deletes the platform org, unless it was adopted
+	// rather than created by the operator.
+	OrgDeletionPolicyDelete OrgDeletionPolicy = "Delete"
+)
+
+// +kubebuilder:resource:path=pixoorganizations,shortName=porg,singular=pixoorganization,scope=Namespaced
+
+// PixoOrganizationSpec defines the desired state of PixoOrganization
+type PixoOrganizationSpec struct {
+	// DisplayName is the org's name on the platform. It defaults to the
+	// resource name. An existing org with this name is adopted.
+	// +optional
+	DisplayName string `json:"displayName,omitempty"`
+	// +optional
+	Type string `json:"type,omitempty"`
+	// +kubebuilder:default=Retain
+	// +optional
+	DeletionPolicy OrgDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// PixoOrganizationStatus defines the observed state of PixoOrganization
+type PixoOrganizationStatus struct {
+	OrgID int    `json:"orgId,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Type  string `json:"type,omitempty"`
+	// Adopted is true when the org already existed on the platform and was
+	// not created by the operator.
+	Adopted bool   `json:"adopted,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	// Plan lists the actions a dry run would take. It is only set while
+	// the organization is in dry-run mode.
+	// +optional
+	Plan []string `json:"plan,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Org ID",type=integer,JSONPath=`.status.orgId`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// PixoOrganization is the Schema for the pixoorganizations API
+type PixoOrganization struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PixoOrganizationSpec   `json:"spec,omitempty"`
+	Status PixoOrganizationStatus `json:"status,omitempty"`
+}
+
+// OrgName is the name of the org on the platform.
+func (o *PixoOrganization) OrgName() string {
+	if o.Spec.DisplayName != "" {
+		return o.Spec.DisplayName
+	}
+
+	return o.Name
+}
+
+func (o *PixoOrganization) GenerateOrgSpec() *platform.Org {
+	return &platform.Org{
+		ID:   o.Status.OrgID,
+		Name: o.OrgName(),
+		Type: o.Spec.Type,
+	}
+}
+
+//+kubebuilder:object:root=true
+
+// PixoOrganizationList contains a list of PixoOrganization
+type PixoOrganizationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PixoOrganization `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&PixoOrganization{},
+		&PixoOrganizationList{},
+	)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:resource:path=pixoplatformconnections,shortName=ppc,singular=pixoplatformconnection,scope=Namespaced
+
+// PixoPlatformConnectionSpec defines the desired state of PixoPlatformConnection
+type PixoPlatformConnectionSpec struct {
+	// Lifecycle is the platform environment, e.g. "dev", "stage" or "prod".
+	// Empty selects production.
+	// +optional
+	Lifecycle string `json:"lifecycle,omitempty"`
+	// Region is the platform region, e.g. "na" or "saudi". Empty selects
+	// the default region.
+	// +optional
+	Region string `json:"region,omitempty"`
+	// Internal reaches the platform through its in-cluster service names
+	// instead of its public URL.
+	// +optional
+	Internal bool `json:"internal,omitempty"`
+	// CredentialsSecretRef names a Secret in the connection's namespace
+	// holding an "api-key", or a "username" and "password", the operator
+	// authenticates with. Changes to it are picked up on the next reconcile.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+	// NamespaceSelector matches the other namespaces whose
+	// PixoServiceAccounts may use the connection. Without it only accounts
+	// in the connection's own namespace can, since they act with its
+	// credentials.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// PixoPlatformConnectionStatus defines the observed state of PixoPlatformConnection
+type PixoPlatformConnectionStatus struct {
+	// URL is the platform URL the connection resolved to.
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Lifecycle",type=string,JSONPath=`.spec.lifecycle`
+//+kubebuilder:printcolumn:name="Region",type=string,JSONPath=`.spec.region`
+//+kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// PixoPlatformConnection is the Schema for the pixoplatformconnections API
+type PixoPlatformConnection struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PixoPlatformConnectionSpec   `json:"spec,omitempty"`
+	Status PixoPlatformConnectionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PixoPlatformConnectionList contains a list of PixoPlatformConnection
+type PixoPlatformConnectionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PixoPlatformConnection `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&PixoPlatformConnection{},
+		&PixoPlatformConnectionList{},
+	)
+}
@@ -20,9 +20,11 @@ import (
 	"fmt"
 	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
 	"github.com/go-faker/faker/v4"
-	"github.com/rs/zerolog/log"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"strings"
+	"time"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -30,14 +32,228 @@ import (
 
 // +kubebuilder:resource:path=pixoserviceaccounts,shortName=psa,singular=pixoserviceaccount,scope=Namespaced
 
+// CredentialSet selects which credentials are issued for an account.
+// +kubebuilder:validation:Enum=apiKey;password;both
+type CredentialSet string
+
+const (
+	CredentialsAPIKey   CredentialSet = "apiKey"
+	CredentialsPassword CredentialSet = "password"
+	CredentialsBoth     CredentialSet = "both"
+)
+
+// SuspendPolicy decides what happens to an account's access while it is
+// suspended.
+// +kubebuilder:validation:Enum=Freeze;RevokeAccess
+type SuspendPolicy string
+
+const (
+	// SuspendFreeze leaves the account's access as it is.
+	SuspendFreeze SuspendPolicy = "Freeze"
+	// SuspendRevokeAccess revokes the account's API key and replaces its
+	// password until it is resumed, when new credentials are issued.
+	SuspendRevokeAccess SuspendPolicy = "RevokeAccess"
+)
+
+// CreationPhase is how far the creation of an account's platform user got.
+// Each phase is recorded before the step that depends on it, so a reconcile
+// interrupted at any point picks up where it stopped.
+type CreationPhase string
+
+const (
+	// CreationPending means a password was generated and stored in the auth
+	// Secret, and the user is being created with it.
+	CreationPending CreationPhase = "Pending"
+	// CreationUserCreated means the user exists and its ID is in status.
+	CreationUserCreated CreationPhase = "UserCreated"
+	// CreationComplete means the user's credentials are in the auth Secret.
+	CreationComplete CreationPhase = "Complete"
+)
+
+// UserState is the state of an account's platform user.
+type UserState string
+
+const (
+	UserStateActive   UserState = "Active"
+	UserStateDisabled UserState = "Disabled"
+)
+
+const (
+	// AnnotationPaused suspends an account like spec.suspend when set to
+	// "true".
+	AnnotationPaused = "platform.pixovr.com/paused"
+
+	// AnnotationAdoptUserID names the ID of the existing platform user an
+	// account takes over. The account fails rather than adopt a user with
+	// the same username but another ID.
+	AnnotationAdoptUserID = "platform.pixovr.com/adopt-user-id"
+	// AnnotationAdoptAPIKeyID names an existing api key of the adopted user
+	// that is written to the auth Secret instead of minting a new one.
+	AnnotationAdoptAPIKeyID = "platform.pixovr.com/adopt-api-key-id"
+
+	// AnnotationPixoServiceAccount on a Kubernetes ServiceAccount names the
+	// PixoServiceAccount in the same namespace whose credentials every pod
+	// running as it gets, like an entry in spec.kubernetesServiceAccounts.
+	AnnotationPixoServiceAccount = "platform.pixovr.com/pixo-service-account"
+
+	// AnnotationForceDelete lets an account be deleted while Deployments
+	// still use it when set to "true".
+	AnnotationForceDelete = "platform.pixovr.com/force-delete"
+)
+
+// LabelExchangeLedger marks the Secrets that record the api keys the token
+// exchange issued, by key ID, with the time each one expires.
+const LabelExchangeLedger = "platform.pixovr.com/exchange-ledger"
+
 // PixoServiceAccountSpec defines the desired state of PixoServiceAccount
+// +kubebuilder:validation:XValidation:rule="!(has(self.ttl) && has(self.expiresAt))",message="set at most one of ttl and expiresAt"
+// +kubebuilder:validation:XValidation:rule="!(has(self.orgRef) && has(self.connectionRef))",message="orgRef only names organizations on the operator's own connection, set orgId with connectionRef"
 type PixoServiceAccountSpec struct {
 	FirstName string `json:"firstName,omitempty"`
 	LastName  string `json:"lastName,omitempty"`
 	OrgID     int    `json:"orgId,omitempty"`
 	Role      string `json:"role,omitempty"`
+
+	// OrgRef names the PixoOrganization the user belongs to, either as
+	// "name" in the account's namespace or as "namespace/name". When set it
+	// takes precedence over OrgID.
+	// +kubebuilder:validation:Pattern=`^([a-z0-9]([-a-z0-9]*[a-z0-9])?/)?[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`
+	// +optional
+	OrgRef string `json:"orgRef,omitempty"`
+
+	// ConnectionRef names the PixoPlatformConnection the account's user is
+	// managed on, either as "name" in the account's namespace or as
+	// "namespace/name". Without it the operator's own connection is used.
+	// A connection in another namespace has to allow the account's namespace
+	// with its namespaceSelector.
+	// Organizations named by orgRef live on the operator's own connection, so
+	// accounts on another connection set orgId instead.
+	// +kubebuilder:validation:Pattern=`^([a-z0-9]([-a-z0-9]*[a-z0-9])?/)?[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`
+	// +optional
+	ConnectionRef string `json:"connectionRef,omitempty"`
+
+	// Credentials selects what is kept in the auth Secret and injected into
+	// workloads. A password that isn't requested is only used to create the
+	// user and is removed from the Secret once the user exists.
+	// +kubebuilder:default=both
+	// +optional
+	Credentials CredentialSet `json:"credentials,omitempty"`
+
+	// Enabled deactivates the platform user when false, without deleting it,
+	// and revokes its api key. Setting it back to true reactivates the user
+	// and issues new credentials.
+	// +kubebuilder:default=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Suspend stops every platform change and workload patch for the
+	// account, including its deletion, while status is still reported.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// SuspendPolicy decides what happens to the account's access while it
+	// is suspended.
+	// +kubebuilder:default=Freeze
+	// +optional
+	SuspendPolicy SuspendPolicy `json:"suspendPolicy,omitempty"`
+
+	// SecretTemplate shapes the Secret the account's credentials are written
+	// to. Without it the Secret is named "<name>-auth" and uses the keys
+	// "username", "password" and "api-key".
+	// +optional
+	SecretTemplate *SecretTemplate `json:"secretTemplate,omitempty"`
+
+	// KubernetesServiceAccounts names ServiceAccounts in the account's
+	// namespace. Deployments whose pods run as one of them get the account's
+	// credentials without the service-account-name annotation; a Deployment
+	// whose annotation names another account keeps that one.
+	// +listType=set
+	// +optional
+	KubernetesServiceAccounts []string `json:"kubernetesServiceAccounts,omitempty"`
+
+	// TTL, when set, expires the account this long after it was created.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// ExpiresAt, when set, expires the account at that time. Warnings are
+	// recorded on the account and its workloads shortly before it expires;
+	// at expiry the account is deleted, which revokes its api key and
+	// deletes its platform user.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Sinks push the username and API key to stores outside the cluster in
+	// addition to the auth Secret, which stays the operator's record of the
+	// credentials. Rotated keys are pushed to every sink and all sinks are
+	// cleared when the account is deleted.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Sinks []SecretSink `json:"sinks,omitempty"`
+}
+
+// SecretTemplate describes the auth Secret of a PixoServiceAccount. Changing
+// its name or keys moves the credentials to the new layout and removes the
+// old Secret.
+type SecretTemplate struct {
+	// Name of the Secret. Defaults to "<name>-auth".
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Keys renames the keys the credentials are stored under.
+	// +optional
+	Keys SecretKeys `json:"keys,omitempty"`
+
+	// Labels and Annotations are added to the Secret next to the ones the
+	// operator sets itself.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Data holds extra keys whose values are Go templates, such as a .env
+	// file or a JSON config. Templates can use .Username, .Password,
+	// .APIKey, .UserID, .APIKeyID, .PlatformURL, .APIURL, .GraphQLURL,
+	// .Lifecycle and .Region, and the toJson function.
+	// +optional
+	Data map[string]string `json:"data,omitempty"`
 }
 
+// SecretKeys names the keys of the auth Secret. Empty fields keep the
+// default key.
+type SecretKeys struct {
+	// +optional
+	Username string `json:"username,omitempty"`
+	// +optional
+	Password string `json:"password,omitempty"`
+	// +optional
+	APIKey string `json:"apiKey,omitempty"`
+}
+
+// WithDefaults fills in the default key for every field that is empty.
+func (k SecretKeys) WithDefaults() SecretKeys {
+	if k.Username == "" {
+		k.Username = "username"
+	}
+	if k.Password == "" {
+		k.Password = "password"
+	}
+	if k.APIKey == "" {
+		k.APIKey = "api-key"
+	}
+
+	return k
+}
+
+// Keys the platform endpoints of the account's connection are stored under in
+// the auth Secret, next to the credentials.
+const (
+	SecretKeyAPIURL     = "api-url"
+	SecretKeyGraphQLURL = "graphql-url"
+	SecretKeyLifecycle  = "lifecycle"
+	SecretKeyRegion     = "region"
+)
+
 // PixoServiceAccountStatus defines the observed state of PixoServiceAccount
 type PixoServiceAccountStatus struct {
 	ID        int    `json:"id,omitempty"`
@@ -49,8 +265,56 @@ type PixoServiceAccountStatus struct {
 	APIKeyID  int    `json:"apiKeyId,omitempty"`
 	Error     string `json:"error,omitempty"`
 
+	// CreationPhase is how far creating the platform user got.
+	CreationPhase CreationPhase `json:"creationPhase,omitempty"`
+	// APIKeyRequestedAt is set while an api key is being minted, so a key
+	// whose creation was interrupted is found again instead of leaked.
+	// +optional
+	APIKeyRequestedAt *metav1.Time `json:"apiKeyRequestedAt,omitempty"`
+	// PriorAPIKeyIDs are the user's keys from before that mint, so the key
+	// it created is the one that isn't listed here.
+	// +optional
+	PriorAPIKeyIDs []int `json:"priorApiKeyIds,omitempty"`
+
+	// SecretName is the auth Secret the credentials were last written to.
+	SecretName string `json:"secretName,omitempty"`
+
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Sinks []SecretSinkStatus `json:"sinks,omitempty"`
+
+	// UserState is the state of the platform user, Active or Disabled.
+	UserState UserState `json:"userState,omitempty"`
+
+	// Suspended is true while reconciliation of the account is suspended.
+	Suspended bool `json:"suspended,omitempty"`
+	// AccessRevoked is true while the account's credentials are revoked
+	// because it is disabled or suspended with the RevokeAccess policy.
+	AccessRevoked bool `json:"accessRevoked,omitempty"`
+
+	// ExpiresAt is when the account expires, from spec.ttl or
+	// spec.expiresAt.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// BlockingWorkloads lists the Deployments that still use the account
+	// while its deletion waits for them.
+	// +optional
+	BlockingWorkloads []string `json:"blockingWorkloads,omitempty"`
+
+	// Plan lists the actions a dry run would take. It is only set while
+	// the account is in dry-run mode.
+	// +optional
+	Plan []string `json:"plan,omitempty"`
+
 	CreatedAt metav1.Time `json:"createdAt,omitempty"`
 	UpdatedAt metav1.Time `json:"updatedAt,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -65,33 +329,114 @@ type PixoServiceAccount struct {
 	Status PixoServiceAccountStatus `json:"status,omitempty"`
 }
 
-func (s *PixoServiceAccount) Log(msg string, err error) {
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("name", s.Name).
-			Str("namespace", s.Namespace).
-			Msg(msg)
+// AuthSecretName returns the name of the auth Secret, from
+// spec.secretTemplate.name if set.
+func (p *PixoServiceAccount) AuthSecretName() string {
+	if p.Spec.SecretTemplate != nil && p.Spec.SecretTemplate.Name != "" {
+		return p.Spec.SecretTemplate.Name
 	}
 
-	log.Info().
-		Str("name", s.Name).
-		Str("namespace", s.Namespace).
-		Msg(msg)
+	return p.DefaultAuthSecretName()
 }
 
-func (p *PixoServiceAccount) AuthSecretName() string {
+// ExchangeLedgerName returns the name of the Secret the token exchange
+// records the short-lived api keys it issued for the account in.
+func (p *PixoServiceAccount) ExchangeLedgerName() string {
+	return p.Name + "-exchange"
+}
+
+// DefaultAuthSecretName returns the name the auth Secret has without a
+// secret template.
+func (p *PixoServiceAccount) DefaultAuthSecretName() string {
 	return fmt.Sprintf("%s-auth", p.Name)
 }
 
-func (p *PixoServiceAccount) GenerateUserSpec() *platform.User {
+// AuthSecretKeys returns the keys the credentials are stored under.
+func (p *PixoServiceAccount) AuthSecretKeys() SecretKeys {
+	if p.Spec.SecretTemplate == nil {
+		return SecretKeys{}.WithDefaults()
+	}
+
+	return p.Spec.SecretTemplate.Keys.WithDefaults()
+}
+
+// OrgRefKey returns the PixoOrganization referenced by spec.orgRef, if any.
+func (p *PixoServiceAccount) OrgRefKey() (types.NamespacedName, bool) {
+	if p.Spec.OrgRef == "" {
+		return types.NamespacedName{}, false
+	}
+
+	if namespace, name, ok := strings.Cut(p.Spec.OrgRef, "/"); ok {
+		return types.NamespacedName{Namespace: namespace, Name: name}, true
+	}
+
+	return types.NamespacedName{Namespace: p.Namespace, Name: p.Spec.OrgRef}, true
+}
+
+// ConnectionRefKey returns the PixoPlatformConnection referenced by
+// spec.connectionRef, if any.
+func (p *PixoServiceAccount) ConnectionRefKey() (types.NamespacedName, bool) {
+	if p.Spec.ConnectionRef == "" {
+		return types.NamespacedName{}, false
+	}
+
+	if namespace, name, ok := strings.Cut(p.Spec.ConnectionRef, "/"); ok {
+		return types.NamespacedName{Namespace: namespace, Name: name}, true
+	}
+
+	return types.NamespacedName{Namespace: p.Namespace, Name: p.Spec.ConnectionRef}, true
+}
+
+// ExpiresAt returns when the account expires, if it has a spec.ttl or
+// spec.expiresAt.
+func (p *PixoServiceAccount) ExpiresAt() (time.Time, bool) {
+	switch {
+	case p.Spec.ExpiresAt != nil:
+		return p.Spec.ExpiresAt.Time, true
+	case p.Spec.TTL != nil:
+		return p.CreationTimestamp.Add(p.Spec.TTL.Duration), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// IsSuspended reports whether the account is suspended by spec.suspend or
+// the paused annotation.
+func (p *PixoServiceAccount) IsSuspended() bool {
+	return p.Spec.Suspend || p.Annotations[AnnotationPaused] == "true"
+}
+
+// IsEnabled reports whether the account's platform user should be active.
+func (p *PixoServiceAccount) IsEnabled() bool {
+	return p.Spec.Enabled == nil || *p.Spec.Enabled
+}
+
+// IssuesAPIKey reports whether the account asks for an API key.
+func (p *PixoServiceAccount) IssuesAPIKey() bool {
+	return p.Spec.Credentials != CredentialsPassword
+}
+
+// IssuesPassword reports whether the account asks for its password to be
+// kept.
+func (p *PixoServiceAccount) IssuesPassword() bool {
+	return p.Spec.Credentials != CredentialsAPIKey
+}
+
+// GeneratePassword returns a random password for a platform user.
+func GeneratePassword() string {
+	return faker.Password() + "!"
+}
+
+// GenerateUserSpec returns the platform user for the account in the org with
+// the given ID, which the caller resolves from spec.orgId or spec.orgRef.
+func (p *PixoServiceAccount) GenerateUserSpec(orgID int) *platform.User {
 	return &platform.User{
 		Username:  p.Name,
-		Password:  faker.Password() + "!",
+		Password:  GeneratePassword(),
 		FirstName: p.Spec.FirstName,
 		LastName:  p.Spec.LastName,
 		Role:      p.Spec.Role,
-		OrgID:     p.Spec.OrgID,
+		OrgID:     orgID,
 	}
 }
 
@@ -0,0 +1,103 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelServiceAccountTemplate marks the PixoServiceAccounts stamped out by a
+// PixoServiceAccountTemplate with the template's name.
+const LabelServiceAccountTemplate = "platform.pixovr.com/service-account-template"
+
+// +kubebuilder:resource:path=pixoserviceaccounttemplates,shortName=psat,singular=pixoserviceaccounttemplate,scope=Cluster
+
+// PixoServiceAccountTemplateSpec defines the desired state of PixoServiceAccountTemplate
+type PixoServiceAccountTemplateSpec struct {
+	// NamespaceSelector matches the namespaces a PixoServiceAccount is
+	// created in. An empty selector matches every namespace.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	// Template is the PixoServiceAccount created in each namespace.
+	Template ServiceAccountTemplate `json:"template"`
+}
+
+// ServiceAccountTemplate describes the PixoServiceAccounts a template creates.
+// The name, first name and last name are Go templates rendered with
+// .Namespace, the namespace's name, and .Labels, its labels. The name is
+// also the platform username.
+type ServiceAccountTemplate struct {
+	// Name of the PixoServiceAccount, e.g. "{{ .Namespace }}-uploader".
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Labels and Annotations are added to the PixoServiceAccount.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Spec of the PixoServiceAccount.
+	Spec PixoServiceAccountSpec `json:"spec"`
+}
+
+// PixoServiceAccountTemplateStatus defines the observed state of PixoServiceAccountTemplate
+type PixoServiceAccountTemplateStatus struct {
+	// ServiceAccounts are the PixoServiceAccounts the template manages, as
+	// "namespace/name". It is always serialized, so a status patch clears it
+	// once no namespace matches.
+	// +optional
+	ServiceAccounts []string `json:"serviceAccounts"`
+	Error           string   `json:"error,omitempty"`
+
+	// Plan lists the actions a dry run would take. It is only set while
+	// the template is in dry-run mode.
+	// +optional
+	Plan []string `json:"plan,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Account",type=string,JSONPath=`.spec.template.name`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// PixoServiceAccountTemplate is the Schema for the pixoserviceaccounttemplates API
+type PixoServiceAccountTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PixoServiceAccountTemplateSpec   `json:"spec,omitempty"`
+	Status PixoServiceAccountTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PixoServiceAccountTemplateList contains a list of PixoServiceAccountTemplate
+type PixoServiceAccountTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PixoServiceAccountTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&PixoServiceAccountTemplate{},
+		&PixoServiceAccountTemplateList{},
+	)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretSink is an external store the account's username and API key are
+// pushed to, for consumers outside the cluster. Exactly one of the store
+// fields must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.vault) != has(self.http)",message="exactly one of vault or http must be set"
+type SecretSink struct {
+	// Name identifies the sink in status.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// +optional
+	Vault *VaultSink `json:"vault,omitempty"`
+	// +optional
+	HTTP *HTTPSink `json:"http,omitempty"`
+}
+
+// VaultSink writes the credentials to a HashiCorp Vault KV version 2 engine.
+type VaultSink struct {
+	// Address of the Vault server, such as https://vault.example.com:8200.
+	Address string `json:"address"`
+	// Mount of the KV engine. Defaults to "secret".
+	// +optional
+	Mount string `json:"mount,omitempty"`
+	// Path of the secret within the engine.
+	Path string `json:"path"`
+	// TokenSecretRef selects the Vault token from a Secret in the account's
+	// namespace.
+	TokenSecretRef corev1.SecretKeySelector `json:"tokenSecretRef"`
+}
+
+// HTTPSink PUTs the credentials as JSON to a URL and DELETEs the URL when
+// they are revoked.
+type HTTPSink struct {
+	URL string `json:"url"`
+	// TokenSecretRef optionally selects a bearer token from a Secret in the
+	// account's namespace.
+	// +optional
+	TokenSecretRef *corev1.SecretKeySelector `json:"tokenSecretRef,omitempty"`
+}
+
+// SecretSinkStatus reports the last push to a sink.
+type SecretSinkStatus struct {
+	Name string `json:"name"`
+	// APIKeyID is the API key the sink last received.
+	APIKeyID int `json:"apiKeyId,omitempty"`
+	// ObservedGeneration is the generation of the account the sink was
+	// last pushed for.
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastSyncedAt       *metav1.Time `json:"lastSyncedAt,omitempty"`
+	Error              string       `json:"error,omitempty"`
+}
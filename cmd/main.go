@@ -17,13 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
 	"github.com/PixoVR/pixo-golang-clients/pixo-platform/urlfinder"
 	"github.com/PixoVR/pixo-golang-server-utilities/pixo-platform/config"
 	"github.com/joho/godotenv"
-	"github.com/rs/zerolog/log"
+	"go.uber.org/zap/zapcore"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -39,6 +44,9 @@ import (
 
 	platformv1 "pixovr.com/platform/api/v1"
 	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/exchange"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/pkg/tokenexchange"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -48,10 +56,6 @@ var (
 )
 
 func init() {
-	if err := godotenv.Load(".env"); err != nil {
-		log.Warn().Msg("no .env file found")
-	}
-
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(platformv1.AddToScheme(scheme))
@@ -62,19 +66,105 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var logJSON bool
+	var logVerbosity int
+	var credentialsDir string
+	var credentialsPollInterval time.Duration
+	var dryRun bool
+	tokenExchange := exchange.Server{}
+	orphanSweeper := controller.OrphanSweeper{}
+	platformOptions := platformclient.DefaultOptions()
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&logJSON, "log-json", false,
+		"Emit structured JSON logs using the production logger configuration instead of the development console output.")
+	flag.IntVar(&logVerbosity, "log-verbosity", 0,
+		"Log verbosity. Higher values enable more detailed V-level logs; takes precedence over --zap-log-level when set.")
+	flag.IntVar(&platformOptions.MaxRetries, "platform-max-retries", platformOptions.MaxRetries,
+		"How many times an idempotent platform call is retried after a transient failure.")
+	flag.DurationVar(&platformOptions.InitialBackoff, "platform-retry-backoff", platformOptions.InitialBackoff,
+		"Delay before the first retry of a platform call; doubles on every retry.")
+	flag.DurationVar(&platformOptions.MaxBackoff, "platform-max-retry-backoff", platformOptions.MaxBackoff,
+		"Upper bound on the delay between retries of a platform call.")
+	flag.Float64Var(&platformOptions.QPS, "platform-qps", platformOptions.QPS,
+		"Maximum sustained requests per second sent to the Pixo platform. 0 disables the limit.")
+	flag.IntVar(&platformOptions.Burst, "platform-burst", platformOptions.Burst,
+		"Maximum burst of requests sent to the Pixo platform.")
+	flag.IntVar(&platformOptions.BreakerThreshold, "platform-breaker-threshold", platformOptions.BreakerThreshold,
+		"Consecutive transient platform failures that open the circuit breaker. 0 disables the breaker.")
+	flag.DurationVar(&platformOptions.BreakerCooldown, "platform-breaker-cooldown", platformOptions.BreakerCooldown,
+		"How long the circuit breaker stays open before probing the platform again.")
+	flag.StringVar(&credentialsDir, "platform-credentials-dir", "",
+		"Directory the operator's platform credentials Secret is mounted at, holding an api-key or a username and password. "+
+			"The credentials are reloaded when they change and /readyz fails while the platform rejects them. "+
+			"When empty, PIXO_API_KEY is used for the lifetime of the process.")
+	flag.DurationVar(&credentialsPollInterval, "platform-credentials-poll-interval", time.Minute,
+		"How often the mounted platform credentials are re-read and validated.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Plan every reconcile without changing the platform or the cluster. Planned actions are written to status.plan and "+
+			"emitted as events. A single object can be planned with the platform.pixovr.com/dry-run annotation instead.")
+	flag.StringVar(&tokenExchange.Addr, "token-exchange-bind-address", "",
+		"The address the token exchange binds to. Pods exchange their projected ServiceAccount token there for a "+
+			"short-lived api key of the PixoServiceAccount bound to their ServiceAccount. Disabled when empty.")
+	flag.StringVar(&tokenExchange.CertDir, "token-exchange-cert-dir", "/tmp/k8s-token-exchange-server/serving-certs",
+		"Directory holding the tls.crt and tls.key the token exchange serves with. They are reloaded when they change.")
+	flag.StringVar(&tokenExchange.Audience, "token-exchange-audience", tokenexchange.DefaultAudience,
+		"The audience projected tokens presented to the token exchange must be issued for.")
+	flag.DurationVar(&tokenExchange.DefaultTTL, "token-exchange-default-ttl", 15*time.Minute,
+		"Lifetime of an exchanged api key when the request asks for none.")
+	flag.DurationVar(&tokenExchange.MaxTTL, "token-exchange-max-ttl", time.Hour,
+		"Longest lifetime a request to the token exchange can ask for.")
+	flag.DurationVar(&tokenExchange.RevokeInterval, "token-exchange-revoke-interval", 30*time.Second,
+		"How often exchanged api keys that expired are revoked.")
+	flag.Func("orphan-sweep-username-pattern",
+		"Regular expression matching the usernames of the platform users the operator manages. Matching users that no "+
+			"PixoServiceAccount tracks are reported as orphans. The sweeper is disabled when unset.",
+		func(value string) (err error) {
+			orphanSweeper.UsernamePattern, err = regexp.Compile(value)
+			return err
+		})
+	flag.Func("orphan-sweep-org-ids",
+		"Comma-separated IDs of platform orgs to sweep in addition to the orgs of existing accounts and organizations.",
+		func(value string) error {
+			for _, field := range strings.Split(value, ",") {
+				orgID, err := strconv.Atoi(strings.TrimSpace(field))
+				if err != nil {
+					return err
+				}
+				orphanSweeper.OrgIDs = append(orphanSweeper.OrgIDs, orgID)
+			}
+			return nil
+		})
+	flag.DurationVar(&orphanSweeper.Interval, "orphan-sweep-interval", time.Hour,
+		"How often platform users are compared with the PixoServiceAccounts in all namespaces.")
+	flag.DurationVar(&orphanSweeper.GracePeriod, "orphan-sweep-grace-period", 24*time.Hour,
+		"How long a user has to stay orphaned before it is reported or deleted.")
+	flag.BoolVar(&orphanSweeper.Delete, "orphan-sweep-delete", false,
+		"Delete orphaned users and their api keys instead of only reporting them in metrics and events.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	if logJSON {
+		// production mode defaults to the JSON encoder, info level and error stacktraces
+		opts.Development = false
+	}
+
+	if logVerbosity > 0 {
+		opts.Level = zapcore.Level(-logVerbosity)
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if err := godotenv.Load(".env"); err != nil {
+		setupLog.Info("no .env file found")
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
@@ -104,18 +194,131 @@ func main() {
 		Lifecycle: config.GetLifecycle(),
 		Region:    config.GetRegion(),
 	}
-	platformClient := graphql.NewClient(clientConfig)
+
+	var baseClient graphql.PlatformClient
+	if credentialsDir == "" {
+		baseClient = platformclient.NewGraphQLClient(graphql.NewClient(clientConfig))
+	} else {
+		reloadableClient, err := platformclient.NewReloadableClient(ctrl.LoggerInto(context.Background(), setupLog), credentialsDir, credentialsPollInterval,
+			func(credentials platformclient.Credentials) (graphql.PlatformClient, error) {
+				return newPlatformClient(clientConfig, credentials)
+			})
+		if err != nil {
+			setupLog.Error(err, "unable to create platform client")
+			os.Exit(1)
+		}
+
+		if err = mgr.Add(reloadableClient); err != nil {
+			setupLog.Error(err, "unable to watch platform credentials")
+			os.Exit(1)
+		}
+
+		if err = mgr.AddReadyzCheck("platform-credentials", reloadableClient.Check); err != nil {
+			setupLog.Error(err, "unable to set up platform credentials check")
+			os.Exit(1)
+		}
+
+		baseClient = reloadableClient
+	}
+	platformClient := platformclient.NewResilientClient(baseClient, platformOptions)
+	connections := platformclient.NewPool(func(connection platformclient.ConnectionConfig) (graphql.PlatformClient, error) {
+		return newPlatformClient(urlfinder.ClientConfig{
+			Internal:  connection.Internal,
+			Lifecycle: connection.Lifecycle,
+			Region:    connection.Region,
+		}, connection.Credentials)
+	}, platformOptions)
 
 	if err = (&controller.PixoServiceAccountReconciler{
 		Client:         mgr.GetClient(),
 		Scheme:         mgr.GetScheme(),
 		PlatformClient: platformClient,
+		Lifecycle:      clientConfig.Lifecycle,
+		Region:         clientConfig.Region,
+		Internal:       clientConfig.Internal,
+		Connections:    connections,
+		Recorder:       mgr.GetEventRecorderFor("pixoserviceaccount-controller"),
+		DryRun:         dryRun,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PixoServiceAccount")
 		os.Exit(1)
 	}
+	if err = (&controller.PixoOrganizationReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		PlatformClient: platformClient,
+		Recorder:       mgr.GetEventRecorderFor("pixoorganization-controller"),
+		DryRun:         dryRun,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PixoOrganization")
+		os.Exit(1)
+	}
+	if err = (&controller.PixoAPIKeyReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		PlatformClient: platformClient,
+		Connections:    connections,
+		Recorder:       mgr.GetEventRecorderFor("pixoapikey-controller"),
+		DryRun:         dryRun,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PixoAPIKey")
+		os.Exit(1)
+	}
+	if err = (&controller.PixoCredentialBindingReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("pixocredentialbinding-controller"),
+		DryRun:   dryRun,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PixoCredentialBinding")
+		os.Exit(1)
+	}
+	if err = (&controller.PixoPlatformConnectionReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Connections: connections,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PixoPlatformConnection")
+		os.Exit(1)
+	}
+	if err = (&controller.PixoServiceAccountTemplateReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("pixoserviceaccounttemplate-controller"),
+		DryRun:   dryRun,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PixoServiceAccountTemplate")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
+	if tokenExchange.Addr != "" && dryRun {
+		setupLog.Info("token exchange is disabled in dry-run mode")
+	} else if tokenExchange.Addr != "" {
+		tokenExchange.Client = mgr.GetClient()
+		tokenExchange.PlatformClient = platformClient
+		tokenExchange.Connections = connections
+		if err = mgr.Add(&tokenExchange); err != nil {
+			setupLog.Error(err, "unable to set up token exchange")
+			os.Exit(1)
+		}
+	}
+
+	if orphanSweeper.UsernamePattern != nil {
+		if orphanSweeper.Delete && dryRun {
+			setupLog.Info("orphaned users are only reported in dry-run mode")
+			orphanSweeper.Delete = false
+		}
+		orphanSweeper.Client = mgr.GetClient()
+		orphanSweeper.PlatformClient = platformClient
+		orphanSweeper.Connections = connections
+		orphanSweeper.Recorder = mgr.GetEventRecorderFor("orphan-sweeper")
+		if err = mgr.Add(&orphanSweeper); err != nil {
+			setupLog.Error(err, "unable to set up orphan sweeper")
+			os.Exit(1)
+		}
+	}
+
 	if err = mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -131,3 +334,19 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newPlatformClient builds a platform client for config authenticated with
+// credentials. An API key takes precedence over a username and password.
+func newPlatformClient(config urlfinder.ClientConfig, credentials platformclient.Credentials) (graphql.PlatformClient, error) {
+	config.APIKey = credentials.APIKey
+	if credentials.APIKey == "" && credentials.Username != "" {
+		client, err := graphql.NewClientWithBasicAuth(credentials.Username, credentials.Password, config)
+		if err != nil {
+			return nil, err
+		}
+
+		return platformclient.NewGraphQLClient(client), nil
+	}
+
+	return platformclient.NewGraphQLClient(graphql.NewClient(config)), nil
+}
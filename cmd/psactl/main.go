@@ -0,0 +1,138 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// psactl manages PixoServiceAccounts from the command line. Its import
+// command writes manifests for platform users that were created by hand, so
+// the operator can adopt them.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	"github.com/PixoVR/pixo-golang-clients/pixo-platform/urlfinder"
+	"github.com/PixoVR/pixo-golang-server-utilities/pixo-platform/config"
+	"github.com/joho/godotenv"
+	"os"
+	"strings"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/importer"
+	"pixovr.com/platform/internal/platformclient"
+)
+
+const usage = `usage: psactl <command> [flags]
+
+commands:
+  import  write PixoServiceAccount manifests for the users of a platform org
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	var options importer.Options
+	var exclude string
+	var apply bool
+	flags.IntVar(&options.OrgID, "org-id", 0, "ID of the platform org whose users are imported.")
+	flags.StringVar(&options.Namespace, "namespace", "default", "Namespace of the generated PixoServiceAccounts.")
+	flags.StringVar(&exclude, "exclude", "", "Comma-separated usernames to leave out.")
+	flags.BoolVar(&apply, "apply", false,
+		"Create the PixoServiceAccounts in the current kubeconfig context instead of only printing them. "+
+			"Accounts that already exist are left alone.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if options.OrgID == 0 {
+		return fmt.Errorf("--org-id is required")
+	}
+	if exclude != "" {
+		options.Exclude = strings.Split(exclude, ",")
+	}
+
+	_ = godotenv.Load(".env")
+	platformClient := platformclient.NewGraphQLClient(graphql.NewClient(urlfinder.ClientConfig{
+		Internal:  os.Getenv("INTERNAL") == "true",
+		APIKey:    os.Getenv("PIXO_API_KEY"),
+		Lifecycle: config.GetLifecycle(),
+		Region:    config.GetRegion(),
+	}))
+
+	ctx := context.Background()
+	result, err := importer.Import(ctx, platformClient, options)
+	if err != nil {
+		return err
+	}
+
+	for _, skipped := range result.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s: %s\n", skipped.Username, skipped.Reason)
+	}
+
+	if !apply {
+		return importer.WriteYAML(os.Stdout, result.ServiceAccounts)
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(platformv1.AddToScheme(scheme))
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	existing, err := importer.Apply(ctx, k8sClient, result.ServiceAccounts)
+	for _, name := range existing {
+		fmt.Fprintf(os.Stderr, "skipped %s/%s: already exists\n", options.Namespace, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "created %d PixoServiceAccounts\n", len(result.ServiceAccounts)-len(existing))
+	return nil
+}
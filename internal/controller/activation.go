@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	corev1 "k8s.io/api/core/v1"
+	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// disable revokes the account's credentials and deactivates its platform
+// user, then warns the workloads that still consume it. The user is checked
+// on every reconcile, so it is deactivated again if it was reactivated on the
+// platform behind the operator's back.
+func (r *PixoServiceAccountReconciler) disable(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User) error {
+	users, err := platformclient.UserActivation(r.PlatformClient)
+	if err != nil {
+		return err
+	}
+
+	if !serviceAccount.Status.AccessRevoked {
+		if err = r.revokeAccess(ctx, serviceAccount, user, v1.ReasonServiceAccountDisabled); err != nil {
+			return err
+		}
+	}
+
+	active := true
+	if serviceAccount.Status.UserState == v1.UserStateDisabled {
+		if active, err = users.UserActive(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	if active {
+		if err = users.SetUserActive(ctx, user.ID, false); err != nil {
+			return err
+		}
+		serviceAccountLogger(ctx, serviceAccount).Info("deactivated platform user")
+		r.event(ctx, serviceAccount, corev1.EventTypeNormal, v1.ReasonServiceAccountDisabled, "deactivated platform user")
+	}
+
+	if err = r.setUserState(ctx, serviceAccount, v1.UserStateDisabled); err != nil {
+		return err
+	}
+
+	return r.warnWorkloads(ctx, serviceAccount, v1.ReasonServiceAccountDisabled,
+		fmt.Sprintf("PixoServiceAccount %s is disabled and its credentials no longer work", serviceAccount.Name))
+}
+
+// enable reactivates the platform user of an account that was disabled. The
+// credentials revoked with it are issued again later in the reconcile.
+func (r *PixoServiceAccountReconciler) enable(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User) error {
+	if serviceAccount.Status.UserState == v1.UserStateDisabled {
+		users, err := platformclient.UserActivation(r.PlatformClient)
+		if err != nil {
+			return err
+		}
+
+		if err = users.SetUserActive(ctx, user.ID, true); err != nil {
+			return err
+		}
+		serviceAccountLogger(ctx, serviceAccount).Info("reactivated platform user")
+		r.event(ctx, serviceAccount, corev1.EventTypeNormal, v1.ReasonResumed, "reactivated platform user")
+	}
+
+	return r.setUserState(ctx, serviceAccount, v1.UserStateActive)
+}
+
+func (r *PixoServiceAccountReconciler) setUserState(ctx context.Context, serviceAccount *v1.PixoServiceAccount, state v1.UserState) error {
+	if serviceAccount.Status.UserState == state {
+		return nil
+	}
+
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Status.UserState = state
+	return r.Status().Patch(ctx, serviceAccount, patch)
+}
+
+// warnWorkloads records a warning on every Deployment that consumes the
+// account, such as when its credentials no longer work.
+func (r *PixoServiceAccountReconciler) warnWorkloads(ctx context.Context, serviceAccount *v1.PixoServiceAccount, reason, message string) error {
+	if r.Recorder == nil || planFrom(ctx) != nil {
+		return nil
+	}
+
+	deployments, err := r.consumingDeployments(ctx, serviceAccount)
+	if err != nil {
+		return err
+	}
+
+	for i := range deployments {
+		r.Recorder.Event(&deployments[i], corev1.EventTypeWarning, reason, message)
+	}
+
+	return nil
+}
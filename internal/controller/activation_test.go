@@ -0,0 +1,114 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount enabled", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		recorder       *record.FakeRecorder
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	setEnabled := func(enabled bool) {
+		serviceAccount.Spec.Enabled = &enabled
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+	}
+
+	userActive := func() bool {
+		active, err := platformClient.UserActive(ctx, serviceAccount.Status.ID)
+		Expect(err).NotTo(HaveOccurred())
+		return active
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		recorder = record.NewFakeRecorder(20)
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+			Recorder:       recorder,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		req = NewRequest(serviceAccount)
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+	})
+
+	It("should be enabled by default", func() {
+		Expect(serviceAccount.IsEnabled()).To(BeTrue())
+		Expect(serviceAccount.Status.UserState).To(Equal(platformv1.UserStateActive))
+		Expect(platformClient.Calls("SetUserActive")).To(BeZero())
+	})
+
+	It("can disable the user without deleting it and warn its workloads", func() {
+		apiKeyID := serviceAccount.Status.APIKeyID
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name+"-disabled", serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		setEnabled(false)
+
+		Expect(serviceAccount.Status.UserState).To(Equal(platformv1.UserStateDisabled))
+		Expect(serviceAccount.Status.AccessRevoked).To(BeTrue())
+		Expect(serviceAccount.Status.APIKeyID).To(BeZero())
+		_, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeTrue())
+		Expect(userActive()).To(BeFalse())
+		_, ok = platformClient.APIKey(apiKeyID)
+		Expect(ok).To(BeFalse())
+		Expect(recorder.Events).To(Receive(ContainSubstring("revoked api key")))
+		Expect(recorder.Events).To(Receive(ContainSubstring("deactivated platform user")))
+		Expect(recorder.Events).To(Receive(And(
+			HavePrefix("Warning "+platformv1.ReasonServiceAccountDisabled),
+			ContainSubstring(serviceAccount.Name),
+		)))
+	})
+
+	It("should deactivate the user again when it is reactivated on the platform", func() {
+		setEnabled(false)
+		Expect(platformClient.SetUserActive(ctx, serviceAccount.Status.ID, true)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(userActive()).To(BeFalse())
+		Expect(platformClient.Calls("DeleteAPIKey")).To(Equal(1))
+	})
+
+	It("can reactivate the user with new credentials", func() {
+		apiKeyID := serviceAccount.Status.APIKeyID
+		setEnabled(false)
+
+		setEnabled(true)
+
+		Expect(serviceAccount.Status.UserState).To(Equal(platformv1.UserStateActive))
+		Expect(serviceAccount.Status.AccessRevoked).To(BeFalse())
+		Expect(userActive()).To(BeTrue())
+		Expect(serviceAccount.Status.APIKeyID).NotTo(BeZero())
+		Expect(serviceAccount.Status.APIKeyID).NotTo(Equal(apiKeyID))
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(string(secret.Data["password"])).To(Equal(platformClient.Password(serviceAccount.Status.ID)))
+		Expect(platformClient.Login(serviceAccount.Name, string(secret.Data["password"]))).To(Succeed())
+	})
+
+})
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	v1 "pixovr.com/platform/api/v1"
+	"strconv"
+)
+
+// checkAdoption makes sure an account with the adopt-user-id annotation only
+// takes over that user. It is never created from scratch, since that would
+// leave the user the annotation names behind.
+func checkAdoption(serviceAccount *v1.PixoServiceAccount, user *platform.User, exists bool) error {
+	value, ok := serviceAccount.Annotations[v1.AnnotationAdoptUserID]
+	if !ok {
+		return nil
+	}
+
+	userID, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation %q: %w", v1.AnnotationAdoptUserID, value, err)
+	}
+
+	if !exists {
+		return fmt.Errorf("platform user %s to adopt was not found", serviceAccount.Name)
+	}
+
+	if user.ID != userID {
+		return fmt.Errorf("platform user %s has ID %d, not the adopted ID %d", serviceAccount.Name, user.ID, userID)
+	}
+
+	return nil
+}
+
+// adoptAPIKey fills in the api key named by the adopt-api-key-id annotation
+// when the account holds no api key yet, so an imported user keeps the key
+// its clients already use. A key that no longer exists is replaced as usual.
+func (r *PixoServiceAccountReconciler) adoptAPIKey(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User, credentials authCredentials) (authCredentials, error) {
+	value, ok := serviceAccount.Annotations[v1.AnnotationAdoptAPIKeyID]
+	if !ok || credentials.APIKey != "" || serviceAccount.Status.AccessRevoked || !serviceAccount.IssuesAPIKey() {
+		return credentials, nil
+	}
+
+	apiKeyID, err := strconv.Atoi(value)
+	if err != nil {
+		return credentials, fmt.Errorf("invalid %s annotation %q: %w", v1.AnnotationAdoptAPIKeyID, value, err)
+	}
+
+	keys, err := r.PlatformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &user.ID})
+	if err != nil {
+		return credentials, err
+	}
+
+	for _, key := range keys {
+		if key.ID == apiKeyID {
+			credentials.APIKey = key.Key
+			credentials.APIKeyID = key.ID
+			return credentials, r.HandleStatusUpdate(ctx, serviceAccount, "adopted api key", key.ID, user, nil)
+		}
+	}
+
+	serviceAccountLogger(ctx, serviceAccount).Info("api key to adopt no longer exists", "apiKeyId", apiKeyID)
+	return credentials, nil
+}
@@ -0,0 +1,88 @@
+package controller_test
+
+import (
+	"context"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strconv"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount adoption", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		serviceAccount *platformv1.PixoServiceAccount
+		user           *platform.User
+		apiKey         *platform.APIKey
+		req            ctrl.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		serviceAccount.Spec.Credentials = platformv1.CredentialsAPIKey
+		req = NewRequest(serviceAccount)
+
+		user = platformClient.AddUser(platform.User{
+			Username:  serviceAccount.Name,
+			FirstName: serviceAccount.Spec.FirstName,
+			LastName:  serviceAccount.Spec.LastName,
+			Role:      "admin",
+			OrgID:     fake.DefaultOrgID,
+		}, "hand-made")
+		var err error
+		apiKey, err = platformClient.CreateAPIKey(ctx, platform.APIKey{UserID: user.ID})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("can take over an imported user and its api key", func() {
+		serviceAccount.Annotations = map[string]string{
+			platformv1.AnnotationAdoptUserID:   strconv.Itoa(user.ID),
+			platformv1.AnnotationAdoptAPIKeyID: strconv.Itoa(apiKey.ID),
+		}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateUser")).To(BeZero())
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+		Expect(platformClient.Calls("UpdateUser")).To(BeZero())
+		Expect(platformClient.Password(user.ID)).To(Equal("hand-made"))
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.ID).To(Equal(user.ID))
+		Expect(serviceAccount.Status.APIKeyID).To(Equal(apiKey.ID))
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(string(secret.Data["api-key"])).To(Equal(apiKey.Key))
+		Expect(secret.Labels).To(HaveKeyWithValue("platform.pixovr.com/api-key-id", strconv.Itoa(apiKey.ID)))
+	})
+
+	It("should refuse to adopt a user with another ID", func() {
+		serviceAccount.Annotations = map[string]string{platformv1.AnnotationAdoptUserID: strconv.Itoa(user.ID + 100)}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).To(HaveOccurred())
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.Error).To(ContainSubstring("not the adopted ID"))
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonReconcileError)
+	})
+
+})
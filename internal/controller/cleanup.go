@@ -3,40 +3,55 @@ package controller
 import (
 	"context"
 	v1 "pixovr.com/platform/api/v1"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-	"strconv"
+	"pixovr.com/platform/internal/platformclient"
 )
 
 func (r *PixoServiceAccountReconciler) cleanup(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
-	secret := serviceAccount.GenerateAuthSecretSpec()
-	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+	secret, err := r.getAuthSecret(ctx, serviceAccount)
+	if err != nil {
 		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to get auth secret", 0, nil, err)
 	}
 
-	if serviceAccount.Status.APIKeyID == 0 {
-		apiKeyIDValue, ok := secret.Labels["platform.pixovr.com/api-key-id"]
-		if !ok {
-			return r.HandleStatusUpdate(ctx, serviceAccount, "no api key id found", 0, nil, nil)
-		}
+	// accounts that only use a password have no api key to revoke
+	apiKeyID := serviceAccount.Status.APIKeyID
+	if apiKeyID == 0 && secret != nil {
+		apiKeyID = readAuthCredentials(secret).APIKeyID
+	}
 
-		apiKeyID, err := strconv.Atoi(apiKeyIDValue)
-		if err != nil {
-			return r.HandleStatusUpdate(ctx, serviceAccount, "invalid api key id", 0, nil, err)
-		}
+	if err = r.clearSinks(ctx, serviceAccount); err != nil {
+		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to clear secret sinks", 0, nil, err)
+	}
 
-		serviceAccount.Status.APIKeyID = apiKeyID
+	if apiKeyID != 0 {
+		if err = r.PlatformClient.DeleteAPIKey(ctx, apiKeyID); err != nil && !platformclient.IsNotFound(err) {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete api key", 0, nil, err)
+		}
 	}
 
-	if err := r.PlatformClient.DeleteAPIKey(ctx, serviceAccount.Status.APIKeyID); err != nil {
-		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete api key", 0, nil, err)
+	userID := serviceAccount.Status.ID
+	if userID == 0 && serviceAccount.Status.CreationPhase == v1.CreationPending {
+		// the user may have been created without its ID being recorded
+		user, exists, err := r.lookupUser(ctx, serviceAccount.Name)
+		if err != nil {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to get user", 0, nil, err)
+		}
+		if exists {
+			userID = user.ID
+		}
 	}
 
-	if err := r.PlatformClient.DeleteUser(ctx, serviceAccount.Status.ID); err != nil {
-		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete user", 0, nil, err)
+	// an account that never got a user, or whose user is already gone,
+	// has nothing left to delete on the platform
+	if userID != 0 {
+		if err = r.PlatformClient.DeleteUser(ctx, userID); err != nil && !platformclient.IsNotFound(err) {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete user", 0, nil, err)
+		}
 	}
 
-	if err := r.Delete(ctx, serviceAccount.GenerateAuthSecretSpec()); err != nil {
-		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete auth secret", 0, nil, err)
+	if secret != nil {
+		if err = r.Delete(ctx, secret); err != nil {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete auth secret", 0, nil, err)
+		}
 	}
 
 	return r.HandleStatusUpdate(ctx, serviceAccount, "cleanup complete", 0, nil, nil)
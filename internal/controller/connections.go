@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// connectionClient returns the PixoPlatformConnection named by key and its
+// platform client from the pool, building it from the connection's spec and
+// credentials Secret. The connection has to allow namespace, the namespace of
+// the object that uses it.
+func connectionClient(ctx context.Context, c client.Reader, pool *platformclient.Pool, key types.NamespacedName, namespace string) (graphql.PlatformClient, *platformv1.PixoPlatformConnection, error) {
+	if pool == nil {
+		return nil, nil, newNotReadyError(platformv1.ReasonConnectionNotReady, "platform connections are not enabled")
+	}
+
+	connection := &platformv1.PixoPlatformConnection{}
+	if err := c.Get(ctx, key, connection); err != nil {
+		if errors.IsNotFound(err) {
+			pool.Remove(key.String())
+			return nil, nil, newNotReadyError(platformv1.ReasonConnectionNotReady, "platform connection %s not found", key)
+		}
+
+		return nil, nil, err
+	}
+
+	if err := connectionAllows(ctx, c, connection, namespace); err != nil {
+		return nil, nil, err
+	}
+
+	config, err := connectionConfig(ctx, c, connection)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	platformClient, err := pool.Get(key.String(), config)
+	return platformClient, connection, err
+}
+
+// connectionAllows returns an error unless accounts in namespace may use the
+// connection: those in its own namespace always can, those in others when
+// its namespaceSelector matches their namespace.
+func connectionAllows(ctx context.Context, c client.Reader, connection *platformv1.PixoPlatformConnection, namespace string) error {
+	if namespace == connection.Namespace {
+		return nil
+	}
+
+	denied := newNotReadyError(platformv1.ReasonConnectionNotReady, "platform connection %s/%s does not allow namespace %s",
+		connection.Namespace, connection.Name, namespace)
+	if connection.Spec.NamespaceSelector == nil {
+		return denied
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(connection.Spec.NamespaceSelector)
+	if err != nil {
+		return err
+	}
+
+	ns := &corev1.Namespace{}
+	if err = c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return err
+	}
+	if !selector.Matches(labels.Set(ns.Labels)) {
+		return denied
+	}
+
+	return nil
+}
+
+// connectionConfig reads the config of a connection's client, including the
+// credentials from its Secret.
+func connectionConfig(ctx context.Context, c client.Reader, connection *platformv1.PixoPlatformConnection) (platformclient.ConnectionConfig, error) {
+	key := types.NamespacedName{Namespace: connection.Namespace, Name: connection.Spec.CredentialsSecretRef.Name}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return platformclient.ConnectionConfig{}, newNotReadyError(platformv1.ReasonConnectionNotReady, "credentials secret %s not found", key)
+		}
+
+		return platformclient.ConnectionConfig{}, err
+	}
+
+	credentials := platformclient.Credentials{
+		APIKey:   strings.TrimSpace(string(secret.Data[platformclient.CredentialsAPIKeyFile])),
+		Username: strings.TrimSpace(string(secret.Data[platformclient.CredentialsUsernameFile])),
+		Password: strings.TrimSpace(string(secret.Data[platformclient.CredentialsPasswordFile])),
+	}
+	if credentials.APIKey == "" && (credentials.Username == "" || credentials.Password == "") {
+		return platformclient.ConnectionConfig{}, newNotReadyError(platformv1.ReasonConnectionNotReady, "%s in secret %s", platformclient.ErrNoCredentials, key)
+	}
+
+	return platformclient.ConnectionConfig{
+		Lifecycle:   connection.Spec.Lifecycle,
+		Region:      connection.Spec.Region,
+		Internal:    connection.Spec.Internal,
+		Credentials: credentials,
+	}, nil
+}
+
+// PlatformClientFor returns the platform client the account's user is
+// managed with: its connection's when spec.connectionRef is set, otherwise
+// fallback.
+func PlatformClientFor(ctx context.Context, c client.Reader, pool *platformclient.Pool, fallback graphql.PlatformClient, serviceAccount *platformv1.PixoServiceAccount) (graphql.PlatformClient, error) {
+	key, ok := serviceAccount.ConnectionRefKey()
+	if !ok {
+		return fallback, nil
+	}
+
+	platformClient, _, err := connectionClient(ctx, c, pool, key, serviceAccount.Namespace)
+	return platformClient, err
+}
+
+// forConnection returns a copy of the reconciler that manages the account's
+// user on the connection named by its connectionRef.
+func (r *PixoServiceAccountReconciler) forConnection(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount) (*PixoServiceAccountReconciler, error) {
+	reconciler := *r
+
+	key, ok := serviceAccount.ConnectionRefKey()
+	if !ok {
+		return &reconciler, nil
+	}
+
+	platformClient, connection, err := connectionClient(ctx, r.Client, r.Connections, key, serviceAccount.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciler.PlatformClient = platformClient
+	reconciler.Lifecycle = connection.Spec.Lifecycle
+	reconciler.Region = connection.Spec.Region
+	reconciler.Internal = connection.Spec.Internal
+	return &reconciler, nil
+}
+
+// serviceAccountsReferencingConnection lists the service accounts in any
+// namespace whose connectionRef resolves to key.
+func serviceAccountsReferencingConnection(ctx context.Context, c client.Client, key types.NamespacedName) ([]platformv1.PixoServiceAccount, error) {
+	serviceAccounts := &platformv1.PixoServiceAccountList{}
+	if err := c.List(ctx, serviceAccounts); err != nil {
+		return nil, err
+	}
+
+	var referencing []platformv1.PixoServiceAccount
+	for _, serviceAccount := range serviceAccounts.Items {
+		if ref, ok := serviceAccount.ConnectionRefKey(); ok && ref == key {
+			referencing = append(referencing, serviceAccount)
+		}
+	}
+
+	return referencing, nil
+}
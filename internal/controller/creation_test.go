@@ -0,0 +1,186 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var errCrashed = errors.New("operator crashed")
+
+// crashingClient fails every write to the cluster after the first writes
+// succeeded, like an operator killed in the middle of a reconcile.
+type crashingClient struct {
+	runtime.Client
+	writes int
+}
+
+func (c *crashingClient) write() error {
+	if c.writes == 0 {
+		return errCrashed
+	}
+	c.writes--
+	return nil
+}
+
+func (c *crashingClient) Create(ctx context.Context, obj runtime.Object, opts ...runtime.CreateOption) error {
+	if err := c.write(); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *crashingClient) Update(ctx context.Context, obj runtime.Object, opts ...runtime.UpdateOption) error {
+	if err := c.write(); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *crashingClient) Patch(ctx context.Context, obj runtime.Object, patch runtime.Patch, opts ...runtime.PatchOption) error {
+	if err := c.write(); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *crashingClient) Delete(ctx context.Context, obj runtime.Object, opts ...runtime.DeleteOption) error {
+	if err := c.write(); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *crashingClient) Status() runtime.SubResourceWriter {
+	return &crashingStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+type crashingStatusWriter struct {
+	runtime.SubResourceWriter
+	client *crashingClient
+}
+
+func (w *crashingStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...runtime.SubResourceUpdateOption) error {
+	if err := w.client.write(); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *crashingStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch runtime.Patch, opts ...runtime.SubResourcePatchOption) error {
+	if err := w.client.write(); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
+
+var _ = Describe("PixoServiceAccount creation", func() {
+
+	var (
+		ctx            context.Context
+		platformClient *fake.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+	})
+
+	reconcile := func(c runtime.Client, serviceAccount *platformv1.PixoServiceAccount) error {
+		reconciler := controller.PixoServiceAccountReconciler{
+			Client:         c,
+			PlatformClient: platformClient,
+		}
+		_, err := reconciler.Reconcile(ctx, NewRequest(serviceAccount))
+		return err
+	}
+
+	// expectConsistent reconciles until the account is complete and checks
+	// that exactly one user with one api key was created, and that the
+	// Secret holds its credentials.
+	expectConsistent := func(serviceAccount *platformv1.PixoServiceAccount) {
+		for i := 0; i < 5 && serviceAccount.Status.CreationPhase != platformv1.CreationComplete; i++ {
+			Expect(reconcile(k8sClient, serviceAccount)).To(Succeed())
+			Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+		}
+
+		Expect(serviceAccount.Status.CreationPhase).To(Equal(platformv1.CreationComplete))
+		Expect(serviceAccount.Status.APIKeyRequestedAt).To(BeNil())
+		var users []int
+		for _, user := range platformClient.Users() {
+			if user.Username == serviceAccount.Name {
+				users = append(users, user.ID)
+			}
+		}
+		Expect(users).To(Equal([]int{serviceAccount.Status.ID}))
+		keys := platformClient.APIKeysForUser(serviceAccount.Status.ID)
+		Expect(keys).To(HaveLen(1))
+		Expect(serviceAccount.Status.APIKeyID).To(Equal(keys[0].ID))
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(string(secret.Data["api-key"])).To(Equal(keys[0].Key))
+		Expect(string(secret.Data["password"])).To(Equal(platformClient.Password(serviceAccount.Status.ID)))
+		Expect(platformClient.Login(serviceAccount.Name, string(secret.Data["password"]))).To(Succeed())
+	}
+
+	It("should recover from a crash after any write", func() {
+		for writes := 0; writes < 12; writes++ {
+			By(fmt.Sprintf("crashing after %d writes", writes))
+			serviceAccount := NewTestServiceAccount(Namespace, fmt.Sprintf("crash-%d", writes), "admin")
+			Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+			crashing := &crashingClient{Client: k8sClient, writes: writes}
+			for i := 0; i < 5 && crashing.writes > 0; i++ {
+				_ = reconcile(crashing, serviceAccount)
+			}
+			Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+
+			expectConsistent(serviceAccount)
+		}
+	})
+
+	It("should record a user whose creation response was lost", func() {
+		platformClient.InjectFault(fake.Fault{Operation: "CreateUser", StatusCode: http.StatusBadGateway, Times: 1, Lost: true})
+		serviceAccount := CreateTestServiceAccount(ctx, Namespace)
+
+		_ = reconcile(k8sClient, serviceAccount)
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.CreationPhase).To(Equal(platformv1.CreationPending))
+
+		expectConsistent(serviceAccount)
+		Expect(platformClient.Calls("CreateUser")).To(Equal(1))
+		Expect(platformClient.Calls("UpdateUser")).To(BeZero())
+	})
+
+	It("should not leak an api key whose creation response was lost", func() {
+		platformClient.InjectFault(fake.Fault{Operation: "CreateAPIKey", StatusCode: http.StatusBadGateway, Times: 1, Lost: true})
+		serviceAccount := CreateTestServiceAccount(ctx, Namespace)
+
+		_ = reconcile(k8sClient, serviceAccount)
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.APIKeyRequestedAt).NotTo(BeNil())
+
+		expectConsistent(serviceAccount)
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+	})
+
+	It("should delete a user whose ID was never recorded", func() {
+		platformClient.InjectFault(fake.Fault{Operation: "CreateUser", StatusCode: http.StatusBadGateway, Times: 1, Lost: true})
+		serviceAccount := CreateTestServiceAccount(ctx, Namespace)
+		_ = reconcile(k8sClient, serviceAccount)
+
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+		Expect(reconcile(k8sClient, serviceAccount)).To(Succeed())
+
+		_, exists := platformClient.User(strings.ToLower(serviceAccount.Name))
+		Expect(exists).To(BeFalse())
+	})
+
+})
@@ -0,0 +1,130 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/apps/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount credentials", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	create := func(credentials platformv1.CredentialSet) {
+		serviceAccount.Spec.Credentials = credentials
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+	}
+
+	switchTo := func(credentials platformv1.CredentialSet) {
+		serviceAccount.Spec.Credentials = credentials
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		req = NewRequest(serviceAccount)
+	})
+
+	It("should issue both credentials by default", func() {
+		create("")
+
+		Expect(serviceAccount.Spec.Credentials).To(Equal(platformv1.CredentialsBoth))
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(secret.Data).To(HaveKey("api-key"))
+		Expect(string(secret.Data["password"])).To(Equal(platformClient.Password(serviceAccount.Status.ID)))
+	})
+
+	It("can keep only the api key and discard the password", func() {
+		create(platformv1.CredentialsAPIKey)
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name+"-api-key-only", serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Password(serviceAccount.Status.ID)).NotTo(BeEmpty())
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(secret.Data).To(HaveLen(6))
+		Expect(secret.Data).To(HaveKey("username"))
+		Expect(secret.Data).To(HaveKey("api-key"))
+		Expect(secret.Data).To(HaveKeyWithValue("lifecycle", []byte("prod")))
+		Expect(secret.Data).To(HaveKeyWithValue("region", []byte("na")))
+		var updatedDeployment v1.Deployment
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), &updatedDeployment)).To(Succeed())
+		Expect(updatedDeployment.Spec.Template.Spec.Containers[0].Env).To(HaveLen(6))
+		Expect(updatedDeployment.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(HaveField("Name", "PIXO_PASSWORD")))
+	})
+
+	It("can use only a password without issuing an api key", func() {
+		create(platformv1.CredentialsPassword)
+
+		Expect(platformClient.Calls("CreateAPIKey")).To(BeZero())
+		Expect(serviceAccount.Status.APIKeyID).To(BeZero())
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(secret.Data).NotTo(HaveKey("api-key"))
+		Expect(string(secret.Data["password"])).To(Equal(platformClient.Password(serviceAccount.Status.ID)))
+
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).NotTo(Succeed())
+	})
+
+	It("can set a new password when it is requested after being discarded", func() {
+		create(platformv1.CredentialsAPIKey)
+		discarded := platformClient.Password(serviceAccount.Status.ID)
+
+		switchTo(platformv1.CredentialsBoth)
+
+		password := string(GetAuthSecret(ctx, serviceAccount).Data["password"])
+		Expect(password).NotTo(BeEmpty())
+		Expect(password).NotTo(Equal(discarded))
+		Expect(platformClient.Password(serviceAccount.Status.ID)).To(Equal(password))
+	})
+
+	It("can revoke the api key when it is no longer requested", func() {
+		create(platformv1.CredentialsBoth)
+		apiKeyID := serviceAccount.Status.APIKeyID
+		password := string(GetAuthSecret(ctx, serviceAccount).Data["password"])
+
+		switchTo(platformv1.CredentialsPassword)
+
+		_, ok := platformClient.APIKey(apiKeyID)
+		Expect(ok).To(BeFalse())
+		Expect(serviceAccount.Status.APIKeyID).To(BeZero())
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(secret.Data).NotTo(HaveKey("api-key"))
+		Expect(secret.Labels).NotTo(HaveKey("platform.pixovr.com/api-key-id"))
+		Expect(string(secret.Data["password"])).To(Equal(password))
+	})
+
+})
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// dependencyRequeueAfter is how often a reconcile waiting on another object
+// is retried. Watches on the dependency normally requeue it sooner.
+const dependencyRequeueAfter = time.Minute
+
+// notReadyError reports that a reconcile is waiting for another Kubernetes
+// object, such as the PixoOrganization named by an account's orgRef. It is
+// surfaced on the Ready condition under reason and kept out of status.error.
+type notReadyError struct {
+	reason string
+	err    error
+}
+
+func newNotReadyError(reason string, format string, args ...interface{}) error {
+	return &notReadyError{reason: reason, err: fmt.Errorf(format, args...)}
+}
+
+func (e *notReadyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notReadyError) Unwrap() error {
+	return e.err
+}
+
+func asNotReady(err error) (*notReadyError, bool) {
+	var notReady *notReadyError
+	ok := errors.As(err, &notReady)
+	return notReady, ok
+}
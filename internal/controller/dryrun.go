@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"slices"
+	"sync"
+)
+
+// AnnotationDryRun puts a single object in dry-run mode when set to "true".
+const AnnotationDryRun = "platform.pixovr.com/dry-run"
+
+// isDryRun reports whether obj is reconciled in dry-run mode, either because
+// the whole manager runs with --dry-run or because of its annotation.
+func isDryRun(dryRun bool, obj client.Object) bool {
+	return dryRun || obj.GetAnnotations()[AnnotationDryRun] == "true"
+}
+
+// plan collects the actions a dry run would have taken, in order.
+type plan struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func (p *plan) add(action string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !slices.Contains(p.actions, action) {
+		p.actions = append(p.actions, action)
+	}
+}
+
+type planContextKey struct{}
+
+func withPlan(ctx context.Context, p *plan) context.Context {
+	return context.WithValue(ctx, planContextKey{}, p)
+}
+
+// planFrom returns the plan of the dry run ctx belongs to, or nil outside of
+// a dry run. Code that talks to anything other than the platform or the
+// Kubernetes API checks it to skip its writes.
+func planFrom(ctx context.Context) *plan {
+	p, _ := ctx.Value(planContextKey{}).(*plan)
+	return p
+}
+
+var _ client.Client = (*planClient)(nil)
+
+// planClient is a client.Client for dry runs. Reads go to the API server;
+// writes are added to the plan instead. Status writes are dropped, since
+// during a dry run they would only describe actions that didn't happen.
+type planClient struct {
+	client.Client
+	plan *plan
+}
+
+func (c *planClient) describe(verb string, obj client.Object) {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+
+	c.plan.add(fmt.Sprintf("%s %s %s", verb, kind, client.ObjectKeyFromObject(obj)))
+}
+
+func (c *planClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.describe("create", obj)
+	return nil
+}
+
+func (c *planClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.describe("update", obj)
+	return nil
+}
+
+func (c *planClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.describe("patch", obj)
+	return nil
+}
+
+func (c *planClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.describe("delete", obj)
+	return nil
+}
+
+func (c *planClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	c.describe("delete all", obj)
+	return nil
+}
+
+func (c *planClient) Status() client.SubResourceWriter {
+	return discardWriter{}
+}
+
+func (c *planClient) SubResource(subResource string) client.SubResourceClient {
+	return discardSubResourceClient{SubResourceClient: c.Client.SubResource(subResource)}
+}
+
+type discardWriter struct{}
+
+func (discardWriter) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	return nil
+}
+
+func (discardWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return nil
+}
+
+func (discardWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	return nil
+}
+
+type discardSubResourceClient struct {
+	client.SubResourceClient
+	discardWriter
+}
+
+func (c discardSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	return nil
+}
+
+func (c discardSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return nil
+}
+
+func (c discardSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	return nil
+}
+
+// recordPlan publishes the outcome of a dry run of obj: the planned actions
+// go to status, where planned and conditions point, and each one becomes an
+// event when the plan changed since the last run.
+func recordPlan(ctx context.Context, c client.Client, recorder record.EventRecorder, obj client.Object, planned *[]string, conditions *[]metav1.Condition, p *plan, err error) error {
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+
+	if recorder != nil && !slices.Equal(*planned, p.actions) {
+		for _, action := range p.actions {
+			recorder.Event(obj, corev1.EventTypeNormal, platformv1.ReasonPlanned, action)
+		}
+	}
+	*planned = p.actions
+
+	condition := metav1.Condition{
+		Type:               platformv1.ConditionDryRun,
+		Status:             metav1.ConditionTrue,
+		Reason:             platformv1.ReasonPlanned,
+		Message:            fmt.Sprintf("%d actions planned", len(p.actions)),
+		ObservedGeneration: obj.GetGeneration(),
+	}
+	if len(p.actions) == 0 {
+		condition.Message = "no changes planned"
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason, _ = conditionReason(err)
+		condition.Message = fmt.Sprintf("planning stopped after %d actions: %v", len(p.actions), err)
+		if recorder != nil {
+			recorder.Event(obj, corev1.EventTypeWarning, condition.Reason, condition.Message)
+		}
+	}
+	meta.SetStatusCondition(conditions, condition)
+
+	return c.Status().Patch(ctx, obj, patch)
+}
+
+// clearPlan removes the outcome of an earlier dry run from obj's status once
+// it is reconciled for real.
+func clearPlan(ctx context.Context, c client.Client, obj client.Object, planned *[]string, conditions *[]metav1.Condition) error {
+	if len(*planned) == 0 && meta.FindStatusCondition(*conditions, platformv1.ConditionDryRun) == nil {
+		return nil
+	}
+
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	*planned = nil
+	meta.RemoveStatusCondition(conditions, platformv1.ConditionDryRun)
+	return c.Status().Patch(ctx, obj, patch)
+}
@@ -0,0 +1,126 @@
+package controller_test
+
+import (
+	"context"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("Dry run", func() {
+
+	var (
+		ctx            context.Context
+		recorder       *record.FakeRecorder
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		recorder = record.NewFakeRecorder(100)
+		platformClient = fake.New()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+			Recorder:       recorder,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		req = NewRequest(serviceAccount)
+	})
+
+	It("can plan a new account from its annotation without changing anything", func() {
+		serviceAccount.Annotations = map[string]string{controller.AnnotationDryRun: "true"}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name+"-planned", serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateUser")).To(BeZero())
+		Expect(platformClient.Calls("CreateAPIKey")).To(BeZero())
+		_, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKey{Name: serviceAccount.AuthSecretName(), Namespace: Namespace}, &corev1.Secret{})).NotTo(Succeed())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(BeEmpty())
+
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Finalizers).To(BeEmpty())
+		Expect(serviceAccount.Status.ID).To(BeZero())
+		Expect(serviceAccount.Status.Plan).To(ContainElements(
+			ContainSubstring("create platform user "+serviceAccount.Name),
+			ContainSubstring("mint api key"),
+			"create Secret "+Namespace+"/"+serviceAccount.AuthSecretName(),
+			"update Deployment "+Namespace+"/"+deployment.Name,
+		))
+		Expect(meta.IsStatusConditionTrue(serviceAccount.Status.Conditions, platformv1.ConditionDryRun)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("Planned")))
+
+		delete(serviceAccount.Annotations, controller.AnnotationDryRun)
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateUser")).To(Equal(1))
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.Plan).To(BeEmpty())
+		Expect(meta.FindStatusCondition(serviceAccount.Status.Conditions, platformv1.ConditionDryRun)).To(BeNil())
+	})
+
+	It("can plan the changes to a hand-made user when the whole operator runs dry", func() {
+		reconciler.DryRun = true
+		existing := platformClient.AddUser(platform.User{
+			Username:  serviceAccount.Name,
+			FirstName: serviceAccount.Spec.FirstName,
+			LastName:  serviceAccount.Spec.LastName,
+			Role:      "developer",
+			OrgID:     serviceAccount.Spec.OrgID,
+		}, "hand-made")
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("UpdateUser")).To(BeZero())
+		user, _ := platformClient.User(serviceAccount.Name)
+		Expect(user.Role).To(Equal("developer"))
+		Expect(platformClient.Password(existing.ID)).To(Equal("hand-made"))
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.Plan).To(ContainElement(ContainSubstring("role developer -> admin")))
+		Expect(serviceAccount.Status.Plan).To(ContainElement(ContainSubstring("reset password")))
+		Expect(serviceAccount.Status.Plan).NotTo(ContainElement(ContainSubstring("create platform user")))
+	})
+
+	It("can plan a new organization", func() {
+		orgReconciler := controller.PixoOrganizationReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+			Recorder:       recorder,
+			DryRun:         true,
+		}
+		org := CreateTestOrganization(ctx, Namespace)
+
+		_, err := orgReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: runtime.ObjectKeyFromObject(org)})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Orgs()).NotTo(ContainElement(HaveField("Name", org.Name)))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(org), org)).To(Succeed())
+		Expect(org.Status.OrgID).To(BeZero())
+		Expect(org.Status.Plan).To(ContainElement("create platform org " + org.Name))
+	})
+
+})
@@ -14,8 +14,13 @@ func (r *PixoServiceAccountReconciler) addEnvVarsToDeployments(ctx context.Conte
 		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to list deployments", 0, nil, err)
 	}
 
+	bound, err := boundKubernetesServiceAccounts(ctx, r.Client, serviceAccount)
+	if err != nil {
+		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to list kubernetes service accounts", 0, nil, err)
+	}
+
 	for _, deployment := range deployments.Items {
-		if serviceAccountName, ok := deployment.Annotations[AnnotationKey]; ok && serviceAccountName == serviceAccount.Name {
+		if consumesServiceAccount(&deployment, serviceAccount, bound) {
 			addOrUpdateEnvVars(&deployment, serviceAccount)
 
 			if err := r.Update(ctx, &deployment); err != nil {
@@ -32,35 +37,38 @@ func addOrUpdateEnvVars(deployment *appsv1.Deployment, serviceAccount *v1.PixoSe
 		return
 	}
 
+	keys := serviceAccount.AuthSecretKeys()
 	envVars := []corev1.EnvVar{
 		{
 			Name:  "PIXO_USERNAME",
 			Value: serviceAccount.Name,
 		},
-		{
-			Name: "PIXO_PASSWORD",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: serviceAccount.AuthSecretName(),
-					},
-					Key: "password",
-				},
-			},
-		},
-		{
-			Name: "PIXO_API_KEY",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: serviceAccount.AuthSecretName(),
-					},
-					Key: "api-key",
-				},
-			},
-		},
+	}
+	// variables for credentials the account doesn't issue are removed, so a
+	// workload never points at a key missing from the Secret
+	var staleEnvVars []string
+
+	if serviceAccount.IssuesPassword() {
+		envVars = append(envVars, secretEnvVar("PIXO_PASSWORD", serviceAccount.AuthSecretName(), keys.Password))
+	} else {
+		staleEnvVars = append(staleEnvVars, "PIXO_PASSWORD")
 	}
 
+	if serviceAccount.IssuesAPIKey() {
+		envVars = append(envVars, secretEnvVar("PIXO_API_KEY", serviceAccount.AuthSecretName(), keys.APIKey))
+	} else {
+		staleEnvVars = append(staleEnvVars, "PIXO_API_KEY")
+	}
+
+	// endpoints come from the Secret too, so they always match the
+	// credentials next to them
+	envVars = append(envVars,
+		secretEnvVar("PIXO_API_URL", serviceAccount.AuthSecretName(), v1.SecretKeyAPIURL),
+		secretEnvVar("PIXO_GRAPHQL_URL", serviceAccount.AuthSecretName(), v1.SecretKeyGraphQLURL),
+		secretEnvVar("PIXO_LIFECYCLE", serviceAccount.AuthSecretName(), v1.SecretKeyLifecycle),
+		secretEnvVar("PIXO_REGION", serviceAccount.AuthSecretName(), v1.SecretKeyRegion),
+	)
+
 	for i, container := range deployment.Spec.Template.Spec.Containers {
 		for _, envVar := range envVars {
 			exists := false
@@ -74,6 +82,27 @@ func addOrUpdateEnvVars(deployment *appsv1.Deployment, serviceAccount *v1.PixoSe
 				container.Env = append(container.Env, envVar)
 			}
 		}
+		env := container.Env[:0]
+		for _, envVar := range container.Env {
+			if !containsString(staleEnvVars, envVar.Name) {
+				env = append(env, envVar)
+			}
+		}
+		container.Env = env
 		deployment.Spec.Template.Spec.Containers[i] = container
 	}
 }
+
+func secretEnvVar(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: secretName,
+				},
+				Key: key,
+			},
+		},
+	}
+}
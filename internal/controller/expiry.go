@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	v1 "pixovr.com/platform/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// maxExpiryWarning is how long before expiry warnings are recorded at most.
+// Accounts with a shorter lifetime are warned during its last quarter.
+const maxExpiryWarning = 24 * time.Hour
+
+// expiryWarning returns how long before expiresAt the account is warned.
+func expiryWarning(serviceAccount *v1.PixoServiceAccount, expiresAt time.Time) time.Duration {
+	return min(maxExpiryWarning, expiresAt.Sub(serviceAccount.CreationTimestamp.Time)/4)
+}
+
+// expire deletes an account that reached its expiry, so the finalizer
+// revokes its api key and deletes its platform user like for any other
+// deletion.
+func (r *PixoServiceAccountReconciler) expire(ctx context.Context, serviceAccount *v1.PixoServiceAccount, expiresAt time.Time) error {
+	message := fmt.Sprintf("expired at %s", expiresAt.UTC().Format(time.RFC3339))
+	serviceAccountLogger(ctx, serviceAccount).Info("deleting expired service account", "expiresAt", expiresAt)
+	r.event(ctx, serviceAccount, corev1.EventTypeNormal, v1.ReasonExpired, message+", deleting it")
+
+	if err := r.Delete(ctx, serviceAccount); err != nil && !errors.IsNotFound(err) {
+		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete expired service account", 0, nil, err)
+	}
+
+	return nil
+}
+
+// trackExpiry records when the account expires and warns the account and its
+// workloads once when expiry is near. Status only changes when expiry or the
+// warning does, since each change triggers another reconcile. It returns when
+// the account should be reconciled again: when the warning is due or when it
+// expires.
+func (r *PixoServiceAccountReconciler) trackExpiry(ctx context.Context, serviceAccount *v1.PixoServiceAccount, now time.Time) (time.Duration, error) {
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+
+	expiresAt, ok := serviceAccount.ExpiresAt()
+	if !ok {
+		if serviceAccount.Status.ExpiresAt == nil && meta.FindStatusCondition(serviceAccount.Status.Conditions, v1.ConditionExpiring) == nil {
+			return 0, nil
+		}
+
+		serviceAccount.Status.ExpiresAt = nil
+		meta.RemoveStatusCondition(&serviceAccount.Status.Conditions, v1.ConditionExpiring)
+		return 0, r.Status().Patch(ctx, serviceAccount, patch)
+	}
+
+	remaining := expiresAt.Sub(now)
+	warnAt := expiresAt.Add(-expiryWarning(serviceAccount, expiresAt))
+	serviceAccount.Status.ExpiresAt = &metav1.Time{Time: expiresAt}
+
+	expiring := metav1.Condition{
+		Type:               v1.ConditionExpiring,
+		Status:             metav1.ConditionFalse,
+		Reason:             v1.ReasonReconciled,
+		Message:            fmt.Sprintf("expires at %s", expiresAt.UTC().Format(time.RFC3339)),
+		ObservedGeneration: serviceAccount.Generation,
+	}
+	next := warnAt.Sub(now)
+	if !now.Before(warnAt) {
+		expiring.Status = metav1.ConditionTrue
+		expiring.Reason = v1.ReasonExpiring
+		expiring.Message = fmt.Sprintf("expiring at %s", expiresAt.UTC().Format(time.RFC3339))
+		next = remaining
+	}
+
+	warn := expiring.Status == metav1.ConditionTrue && !meta.IsStatusConditionTrue(serviceAccount.Status.Conditions, v1.ConditionExpiring)
+	meta.SetStatusCondition(&serviceAccount.Status.Conditions, expiring)
+	if err := r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+		return 0, err
+	}
+
+	if warn {
+		message := fmt.Sprintf("PixoServiceAccount %s expires in %s at %s, its platform user will be deleted then",
+			serviceAccount.Name, duration.HumanDuration(remaining), expiresAt.UTC().Format(time.RFC3339))
+		r.event(ctx, serviceAccount, corev1.EventTypeWarning, v1.ReasonExpiring, message)
+		if err := r.warnWorkloads(ctx, serviceAccount, v1.ReasonExpiring, message); err != nil {
+			return 0, err
+		}
+	}
+
+	return max(next, time.Second), nil
+}
@@ -0,0 +1,133 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+	"time"
+)
+
+var _ = Describe("PixoServiceAccount expiry", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		recorder       *record.FakeRecorder
+		serviceAccount *platformv1.PixoServiceAccount
+	)
+
+	reconcile := func() ctrl.Result {
+		res, err := reconciler.Reconcile(ctx, NewRequest(serviceAccount))
+		Expect(err).NotTo(HaveOccurred())
+		return res
+	}
+
+	get := func() {
+		Expect(k8sClient.Get(ctx, NewRequest(serviceAccount).NamespacedName, serviceAccount)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		recorder = record.NewFakeRecorder(20)
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+			Recorder:       recorder,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, "expiry-"+strings.ToLower(faker.Username()), "admin")
+	})
+
+	It("should record the expiry and requeue when the warning is due", func() {
+		serviceAccount.Spec.TTL = &metav1.Duration{Duration: 72 * time.Hour}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		res := reconcile()
+
+		get()
+		expiresAt := serviceAccount.CreationTimestamp.Add(72 * time.Hour)
+		Expect(serviceAccount.Status.ExpiresAt.Time).To(BeTemporally("==", expiresAt))
+		Expect(meta.IsStatusConditionFalse(serviceAccount.Status.Conditions, platformv1.ConditionExpiring)).To(BeTrue())
+		Expect(meta.FindStatusCondition(serviceAccount.Status.Conditions, platformv1.ConditionExpiring).Message).
+			To(Equal("expires at " + expiresAt.UTC().Format(time.RFC3339)))
+		Expect(res.RequeueAfter).To(BeNumerically("~", 48*time.Hour, time.Minute))
+		Expect(ReceivedEvents(recorder, platformv1.ReasonExpiring)).To(BeEmpty())
+	})
+
+	It("should warn the account and its workloads once before it expires", func() {
+		serviceAccount.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(time.Hour)}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name, serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		res := reconcile()
+
+		get()
+		Expect(meta.IsStatusConditionTrue(serviceAccount.Status.Conditions, platformv1.ConditionExpiring)).To(BeTrue())
+		Expect(res.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+		// one on the account and one on its deployment
+		Expect(ReceivedEvents(recorder, platformv1.ReasonExpiring)).To(HaveLen(2))
+
+		expiring := meta.FindStatusCondition(serviceAccount.Status.Conditions, platformv1.ConditionExpiring).DeepCopy()
+
+		reconcile()
+		Expect(ReceivedEvents(recorder, platformv1.ReasonExpiring)).To(BeEmpty())
+		get()
+		Expect(meta.FindStatusCondition(serviceAccount.Status.Conditions, platformv1.ConditionExpiring)).To(Equal(expiring))
+	})
+
+	It("should delete the account and its platform user once it expires", func() {
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+		get()
+		apiKeyID := serviceAccount.Status.APIKeyID
+
+		serviceAccount.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+		reconcile()
+
+		err := k8sClient.Get(ctx, NewRequest(serviceAccount).NamespacedName, serviceAccount)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		_, exists := platformClient.User(serviceAccount.Name)
+		Expect(exists).To(BeFalse())
+		_, exists = platformClient.APIKey(apiKeyID)
+		Expect(exists).To(BeFalse())
+		Expect(ReceivedEvents(recorder, platformv1.ReasonExpired)).To(HaveLen(1))
+	})
+
+	It("should stop tracking expiry when the ttl is removed", func() {
+		serviceAccount.Spec.TTL = &metav1.Duration{Duration: time.Hour}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+		get()
+
+		serviceAccount.Spec.TTL = nil
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		res := reconcile()
+
+		get()
+		Expect(res.RequeueAfter).To(BeZero())
+		Expect(serviceAccount.Status.ExpiresAt).To(BeNil())
+		Expect(meta.FindStatusCondition(serviceAccount.Status.Conditions, platformv1.ConditionExpiring)).To(BeNil())
+	})
+
+	It("should reject an account with both a ttl and expiresAt", func() {
+		serviceAccount.Spec.TTL = &metav1.Duration{Duration: time.Hour}
+		serviceAccount.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(time.Hour)}
+
+		Expect(k8sClient.Create(ctx, serviceAccount)).NotTo(Succeed())
+	})
+
+})
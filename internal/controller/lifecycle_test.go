@@ -0,0 +1,253 @@
+package controller_test
+
+import (
+	"context"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strconv"
+	"time"
+)
+
+var _ = Describe("PixoServiceAccount lifecycle", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		serviceAccount = CreateTestServiceAccount(ctx, Namespace)
+		req = NewRequest(serviceAccount)
+	})
+
+	It("can create, converge and delete a platform user", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		user, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeTrue())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.ID).To(Equal(user.ID))
+		Expect(serviceAccount.Status.APIKeyID).NotTo(BeZero())
+		ExpectStatusToEqualSpec(serviceAccount)
+		secret := &corev1.Secret{}
+		Expect(reconciler.Get(ctx, runtime.ObjectKey{Name: serviceAccount.AuthSecretName(), Namespace: Namespace}, secret)).To(Succeed())
+		apiKey, ok := platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		Expect(string(secret.Data["api-key"])).To(Equal(apiKey.Key))
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateUser")).To(Equal(1))
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+		Expect(platformClient.Calls("UpdateUser")).To(BeZero())
+
+		Expect(reconciler.Delete(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		_, ok = platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+		_, ok = platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		Expect(ok).To(BeFalse())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).NotTo(Succeed())
+	})
+
+	It("can push spec changes to the existing platform user", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		serviceAccount.Spec.Role = "developer"
+		serviceAccount.Spec.LastName = "Updated"
+		Expect(reconciler.Update(ctx, serviceAccount)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		user, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeTrue())
+		Expect(user.Role).To(Equal("developer"))
+		Expect(user.LastName).To(Equal("Updated"))
+		Expect(platformClient.Calls("CreateUser")).To(Equal(1))
+	})
+
+	It("can recover from a platform outage without creating duplicate users", func() {
+		platformClient.InjectFault(fake.Fault{Operation: "CreateUser", StatusCode: http.StatusServiceUnavailable, Times: 1})
+
+		result, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.Error).To(BeEmpty())
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonPlatformUnavailable)
+		_, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Users()).To(ContainElement(HaveField("Username", serviceAccount.Name)))
+		Expect(platformClient.Calls("CreateUser")).To(Equal(2))
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		ExpectReadyCondition(serviceAccount, metav1.ConditionTrue, platformv1.ReasonReconciled)
+	})
+
+	It("can back off when the platform rate limits the operator", func() {
+		platformClient.SetRateLimit(1, time.Minute)
+
+		result, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(meta.FindStatusCondition(serviceAccount.Status.Conditions, platformv1.ConditionReady).Message).To(ContainSubstring("429"))
+		_, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("can give up on a slow platform once the context expires", func() {
+		platformClient.SetLatency(time.Second)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		result, err := reconciler.Reconcile(timeoutCtx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		_, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+	})
+
+	DescribeTable("can back off without creating a user when the lookup fails",
+		func(statusCode int) {
+			platformClient.InjectFault(fake.Fault{Operation: "GetUserByUsername", StatusCode: statusCode, Times: 1})
+
+			result, err := reconciler.Reconcile(ctx, req)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+			Expect(platformClient.Calls("CreateUser")).To(BeZero())
+			Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+			Expect(serviceAccount.Status.Error).To(BeEmpty())
+			ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonPlatformUnavailable)
+		},
+		Entry("when the platform is unavailable", http.StatusServiceUnavailable),
+		Entry("when the request times out", http.StatusGatewayTimeout),
+	)
+
+	DescribeTable("can report rejected operator credentials without creating a user",
+		func(statusCode int) {
+			platformClient.InjectFault(fake.Fault{Operation: "GetUserByUsername", StatusCode: statusCode, Times: 1})
+
+			result, err := reconciler.Reconcile(ctx, req)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", time.Minute))
+			Expect(platformClient.Calls("CreateUser")).To(BeZero())
+			Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+			Expect(serviceAccount.Status.Error).To(ContainSubstring(strconv.Itoa(statusCode)))
+			ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonPlatformAuth)
+		},
+		Entry("when the operator's credentials are rejected", http.StatusUnauthorized),
+		Entry("when the operator is not allowed to read users", http.StatusForbidden),
+	)
+
+	It("can adopt an existing platform user instead of creating a duplicate", func() {
+		existing := platformClient.AddUser(platform.User{
+			Username:  serviceAccount.Name,
+			FirstName: serviceAccount.Spec.FirstName,
+			LastName:  serviceAccount.Spec.LastName,
+			Role:      serviceAccount.Spec.Role,
+			OrgID:     serviceAccount.Spec.OrgID,
+		}, "existing-password")
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateUser")).To(BeZero())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.ID).To(Equal(existing.ID))
+	})
+
+	It("can requeue with the circuit breaker's cooldown while the platform is down", func() {
+		reconciler.PlatformClient = platformclient.NewResilientClient(platformClient, platformclient.Options{
+			BreakerThreshold: 1,
+			BreakerCooldown:  time.Hour,
+		})
+		platformClient.InjectFault(fake.Fault{StatusCode: http.StatusBadGateway})
+
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		calls := platformClient.Calls("GetUserByUsername")
+
+		result, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 30*time.Minute))
+		Expect(platformClient.Calls("GetUserByUsername")).To(Equal(calls))
+	})
+
+	It("can delete an account whose orgRef never resolved", func() {
+		unresolved := NewTestServiceAccount(Namespace, serviceAccount.Name+"-no-org", "admin")
+		unresolved.Spec.OrgRef = "missing-org"
+		Expect(k8sClient.Create(ctx, unresolved)).To(Succeed())
+		unresolvedReq := NewRequest(unresolved)
+		result, err := reconciler.Reconcile(ctx, unresolvedReq)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(reconciler.Get(ctx, unresolvedReq.NamespacedName, unresolved)).To(Succeed())
+		Expect(unresolved.Finalizers).NotTo(BeEmpty())
+		Expect(unresolved.Status.ID).To(BeZero())
+
+		Expect(reconciler.Delete(ctx, unresolved)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, unresolvedReq)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("DeleteUser")).To(BeZero())
+		Expect(errors.IsNotFound(reconciler.Get(ctx, unresolvedReq.NamespacedName, unresolved))).To(BeTrue())
+	})
+
+	It("can delete an account whose platform user is already gone", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(platformClient.DeleteUser(ctx, serviceAccount.Status.ID)).To(Succeed())
+
+		Expect(reconciler.Delete(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errors.IsNotFound(reconciler.Get(ctx, req.NamespacedName, serviceAccount))).To(BeTrue())
+	})
+
+})
+
+func ExpectReadyCondition(serviceAccount *platformv1.PixoServiceAccount, status metav1.ConditionStatus, reason string) {
+	condition := meta.FindStatusCondition(serviceAccount.Status.Conditions, platformv1.ConditionReady)
+	Expect(condition).NotTo(BeNil())
+	Expect(condition.Status).To(Equal(status))
+	Expect(condition.Reason).To(Equal(reason))
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	platformv1 "pixovr.com/platform/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// withRequestLogger makes sure ctx carries a logger keyed by the request's
+// namespace and name. Reconciles started by the manager already get one from
+// controller-runtime (along with the controller name and reconcile ID), so it
+// is only seeded when Reconcile is called directly, e.g. from tests.
+func withRequestLogger(ctx context.Context, req ctrl.Request) context.Context {
+	if _, err := logr.FromContext(ctx); err == nil {
+		return ctx
+	}
+
+	return log.IntoContext(ctx, log.Log.WithValues("namespace", req.Namespace, "name", req.Name))
+}
+
+// serviceAccountLogger returns the request logger annotated with the platform
+// identifiers currently recorded on the service account.
+func serviceAccountLogger(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount) logr.Logger {
+	logger := log.FromContext(ctx)
+
+	if serviceAccount.Status.ID != 0 {
+		logger = logger.WithValues("userId", serviceAccount.Status.ID)
+	}
+
+	if serviceAccount.Status.APIKeyID != 0 {
+		logger = logger.WithValues("apiKeyId", serviceAccount.Status.APIKeyID)
+	}
+
+	return logger
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	platformv1 "pixovr.com/platform/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// resolveOrgID returns the platform org the account's user belongs in: the
+// org of the PixoOrganization named by spec.orgRef, or spec.orgId when no
+// reference is set. Organizations only exist on the operator's own
+// connection, so an account on another connection can't reference one.
+func (r *PixoServiceAccountReconciler) resolveOrgID(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount) (int, error) {
+	key, ok := serviceAccount.OrgRefKey()
+	if !ok {
+		return serviceAccount.Spec.OrgID, nil
+	}
+
+	if serviceAccount.Spec.ConnectionRef != "" {
+		return 0, newNotReadyError(platformv1.ReasonOrgNotReady, "organization %s is on the operator's own connection, not on %s", key, serviceAccount.Spec.ConnectionRef)
+	}
+
+	org := &platformv1.PixoOrganization{}
+	if err := r.Get(ctx, key, org); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, newNotReadyError(platformv1.ReasonOrgNotReady, "organization %s not found", key)
+		}
+
+		return 0, err
+	}
+
+	if org.GetDeletionTimestamp() != nil {
+		return 0, newNotReadyError(platformv1.ReasonOrgNotReady, "organization %s is being deleted", key)
+	}
+
+	if org.Status.OrgID == 0 {
+		return 0, newNotReadyError(platformv1.ReasonOrgNotReady, "organization %s has no platform org yet", key)
+	}
+
+	return org.Status.OrgID, nil
+}
+
+// serviceAccountsReferencingOrg lists the service accounts in any namespace
+// whose orgRef resolves to key.
+func serviceAccountsReferencingOrg(ctx context.Context, c client.Client, key types.NamespacedName) ([]platformv1.PixoServiceAccount, error) {
+	serviceAccounts := &platformv1.PixoServiceAccountList{}
+	if err := c.List(ctx, serviceAccounts); err != nil {
+		return nil, err
+	}
+
+	var referencing []platformv1.PixoServiceAccount
+	for _, serviceAccount := range serviceAccounts.Items {
+		if ref, ok := serviceAccount.OrgRefKey(); ok && ref == key {
+			referencing = append(referencing, serviceAccount)
+		}
+	}
+
+	return referencing, nil
+}
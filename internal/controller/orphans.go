@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	"regexp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultPlatform is the platform label of users on the operator's own
+// platform, as opposed to a PixoPlatformConnection's.
+const defaultPlatform = "default"
+
+var (
+	orphanedUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pixo_orphaned_platform_users",
+		Help: "Platform users past the grace period that no PixoServiceAccount tracks, as of the last sweep.",
+	}, []string{"platform", "org"})
+	orphanedUsersDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pixo_orphaned_platform_users_deleted_total",
+		Help: "Orphaned platform users deleted by the sweeper.",
+	}, []string{"platform"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(orphanedUsers, orphanedUsersDeleted)
+}
+
+// OrphanSweeper periodically looks for platform users the operator created
+// that no PixoServiceAccount tracks any more, e.g. because a finalizer was
+// removed by hand or the CRD was deleted. Orphans are reported in metrics
+// and events, and deleted with their api keys when Delete is set.
+type OrphanSweeper struct {
+	client.Client
+	PlatformClient graphql.PlatformClient
+	Connections    *platformclient.Pool
+	Recorder       record.EventRecorder
+
+	// UsernamePattern matches the usernames of the users the operator
+	// manages. Other users are never reported or deleted.
+	UsernamePattern *regexp.Regexp
+	// OrgIDs are swept on the operator's platform in addition to the orgs of
+	// the accounts and PixoOrganizations, so an org whose accounts are all
+	// gone is still covered.
+	OrgIDs []int
+	// Interval is how often the sweeper runs.
+	Interval time.Duration
+	// GracePeriod is how long a user has to stay orphaned before it is
+	// reported or deleted.
+	GracePeriod time.Duration
+	// Delete deletes orphans instead of only reporting them.
+	Delete bool
+
+	mu        sync.Mutex
+	firstSeen map[string]time.Time
+}
+
+// Orphan is a platform user that no PixoServiceAccount tracks.
+type Orphan struct {
+	// Platform is "default" or the namespace/name of the
+	// PixoPlatformConnection the user is on. Connections to the same
+	// platform are swept together under the first one's name.
+	Platform string
+	OrgID    int
+	UserID   int
+	Username string
+	// Since is when the user was first found orphaned.
+	Since time.Time
+}
+
+// SweepReport is the outcome of a sweep.
+type SweepReport struct {
+	// Orphans are the users past the grace period, including the deleted
+	// ones.
+	Orphans []Orphan
+	Deleted []Orphan
+}
+
+// sweepScope is what is known about the accounts on one connection.
+type sweepScope struct {
+	connection *types.NamespacedName
+	orgIDs     map[int]bool
+	usernames  map[string]bool
+	userIDs    map[int]bool
+}
+
+// sweepPlatform is a platform to sweep, with the accounts of every scope
+// whose client talks to it.
+type sweepPlatform struct {
+	name        string
+	client      graphql.PlatformClient
+	eventTarget client.Object
+	scope       *sweepScope
+}
+
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoserviceaccounts,verbs=get;list;watch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoorganizations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoplatformconnections,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Start sweeps every Interval until ctx is done.
+func (s *OrphanSweeper) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("orphan-sweeper")
+	ctx = log.IntoContext(ctx, logger)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx, time.Now()); err != nil {
+				logger.Error(err, "failed to sweep orphaned platform users")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection returns true so only one replica deletes orphans.
+func (s *OrphanSweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// Sweep compares the users of every org the operator knows about with the
+// accounts in all namespaces at now. A platform that cannot be reached is
+// skipped and its error returned after the others are swept; connections
+// that don't exist or lack credentials are only logged.
+func (s *OrphanSweeper) Sweep(ctx context.Context, now time.Time) (*SweepReport, error) {
+	if s.UsernamePattern == nil {
+		return nil, errors.New("no username pattern to recognize the operator's users by")
+	}
+
+	organizations, err := s.organizationsByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := s.scopes(ctx, organizations)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &SweepReport{}
+	seen := map[string]time.Time{}
+	orphanedUsers.Reset()
+
+	platforms, errs := s.platforms(ctx, scopes)
+	for _, sweep := range platforms {
+		platformName, platformClient, eventTarget, scope := sweep.name, sweep.client, sweep.eventTarget, sweep.scope
+
+		users, err := platformclient.UserList(platformClient)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("platform %s: %w", platformName, err))
+			continue
+		}
+
+		for _, orgID := range sortedKeys(scope.orgIDs) {
+			found, err := users.GetUsers(ctx, orgID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("platform %s: listing users of org %d: %w", platformName, orgID, err))
+				continue
+			}
+
+			target := eventTarget
+			if organization, ok := organizations[orgID]; ok && target == nil {
+				target = organization
+			}
+
+			remaining := 0
+			for _, user := range found {
+				if !s.isOrphan(platformClient, scope, user) {
+					continue
+				}
+
+				key := platformName + "/" + strconv.Itoa(user.ID)
+				since, ok := s.firstSeen[key]
+				if !ok {
+					since = now
+				}
+				seen[key] = since
+				if now.Sub(since) < s.GracePeriod {
+					continue
+				}
+
+				orphan := Orphan{Platform: platformName, OrgID: orgID, UserID: user.ID, Username: user.Username, Since: since}
+				report.Orphans = append(report.Orphans, orphan)
+
+				if !s.Delete {
+					remaining++
+					s.event(ctx, target, corev1.EventTypeWarning, platformv1.ReasonOrphanedUser,
+						fmt.Sprintf("platform user %s (id %d) in org %d is not tracked by any PixoServiceAccount", user.Username, user.ID, orgID))
+					continue
+				}
+
+				if err = deleteOrphan(ctx, platformClient, user.ID); err != nil {
+					remaining++
+					errs = append(errs, fmt.Errorf("platform %s: deleting user %s: %w", platformName, user.Username, err))
+					continue
+				}
+
+				delete(seen, key)
+				report.Deleted = append(report.Deleted, orphan)
+				orphanedUsersDeleted.WithLabelValues(platformName).Inc()
+				s.event(ctx, target, corev1.EventTypeNormal, platformv1.ReasonOrphanedUserDeleted,
+					fmt.Sprintf("deleted platform user %s (id %d) in org %d that no PixoServiceAccount tracked", user.Username, user.ID, orgID))
+			}
+
+			orphanedUsers.WithLabelValues(platformName, strconv.Itoa(orgID)).Set(float64(remaining))
+		}
+	}
+	s.firstSeen = seen
+
+	return report, errors.Join(errs...)
+}
+
+// scopes groups the accounts in all namespaces by the connection their users
+// are on. The orgs of the organizations are swept on the operator's
+// platform.
+func (s *OrphanSweeper) scopes(ctx context.Context, organizations map[int]*platformv1.PixoOrganization) (map[string]*sweepScope, error) {
+	serviceAccounts := &platformv1.PixoServiceAccountList{}
+	if err := s.List(ctx, serviceAccounts); err != nil {
+		return nil, err
+	}
+
+	scopes := map[string]*sweepScope{defaultPlatform: newSweepScope(nil)}
+	for _, orgID := range s.OrgIDs {
+		scopes[defaultPlatform].orgIDs[orgID] = true
+	}
+	for orgID := range organizations {
+		scopes[defaultPlatform].orgIDs[orgID] = true
+	}
+
+	for _, serviceAccount := range serviceAccounts.Items {
+		platformName := defaultPlatform
+		key, ok := serviceAccount.ConnectionRefKey()
+		if ok {
+			platformName = key.String()
+		}
+
+		scope := scopes[platformName]
+		if scope == nil {
+			scope = newSweepScope(&key)
+			scopes[platformName] = scope
+		}
+
+		scope.usernames[serviceAccount.Name] = true
+		if serviceAccount.Status.Username != "" {
+			scope.usernames[serviceAccount.Status.Username] = true
+		}
+		if serviceAccount.Status.ID != 0 {
+			scope.userIDs[serviceAccount.Status.ID] = true
+		}
+		for _, orgID := range []int{serviceAccount.Spec.OrgID, serviceAccount.Status.OrgID} {
+			if orgID != 0 {
+				scope.orgIDs[orgID] = true
+			}
+		}
+	}
+
+	return scopes, nil
+}
+
+func newSweepScope(connection *types.NamespacedName) *sweepScope {
+	return &sweepScope{
+		connection: connection,
+		orgIDs:     map[int]bool{},
+		usernames:  map[string]bool{},
+		userIDs:    map[int]bool{},
+	}
+}
+
+// track adds the users of other's accounts to the scope, and with orgs its
+// orgs too.
+func (s *sweepScope) track(other *sweepScope, orgs bool) {
+	for username := range other.usernames {
+		s.usernames[username] = true
+	}
+	for userID := range other.userIDs {
+		s.userIDs[userID] = true
+	}
+	if !orgs {
+		return
+	}
+	for orgID := range other.orgIDs {
+		s.orgIDs[orgID] = true
+	}
+}
+
+// platforms resolves the client of every scope and merges the scopes whose
+// clients talk to the same platform URL, so a connection to the operator's
+// own platform, or two connections to one platform, never report each
+// other's users as orphans. The accounts of a scope whose connection can't
+// be resolved could be on any platform, so their users are kept on all of
+// them. The operator's own platform comes first and names its merged scope.
+func (s *OrphanSweeper) platforms(ctx context.Context, scopes map[string]*sweepScope) ([]*sweepPlatform, []error) {
+	names := slices.DeleteFunc(sortedKeys(scopes), func(name string) bool { return name == defaultPlatform })
+	names = append([]string{defaultPlatform}, names...)
+
+	var platforms []*sweepPlatform
+	var errs []error
+	byURL := map[string]*sweepPlatform{}
+	unresolved := newSweepScope(nil)
+	for _, name := range names {
+		scope := scopes[name]
+		platformClient, eventTarget, err := s.scopeClient(ctx, scope)
+		if err != nil {
+			if _, notReady := asNotReady(err); notReady {
+				// accounts on a connection that is gone or not set up yet
+				// wait for it, and so does the sweep
+				log.FromContext(ctx).Info("skipping platform", "platform", name, "reason", err.Error())
+			} else {
+				errs = append(errs, fmt.Errorf("platform %s: %w", name, err))
+			}
+			unresolved.track(scope, false)
+			continue
+		}
+
+		url := platformClient.GetURL()
+		sweep, ok := byURL[url]
+		if !ok {
+			sweep = &sweepPlatform{name: name, client: platformClient, eventTarget: eventTarget, scope: newSweepScope(nil)}
+			byURL[url] = sweep
+			platforms = append(platforms, sweep)
+		} else {
+			log.FromContext(ctx).V(1).Info("sweeping platform with another", "platform", name, "with", sweep.name, "url", url)
+		}
+		sweep.scope.track(scope, true)
+	}
+
+	for _, sweep := range platforms {
+		sweep.scope.track(unresolved, false)
+	}
+
+	return platforms, errs
+}
+
+// organizationsByID returns the PixoOrganizations by the ID of their
+// platform org. Events about orphans in an org are recorded on its
+// organization.
+func (s *OrphanSweeper) organizationsByID(ctx context.Context) (map[int]*platformv1.PixoOrganization, error) {
+	organizations := &platformv1.PixoOrganizationList{}
+	if err := s.List(ctx, organizations); err != nil {
+		return nil, err
+	}
+
+	byID := map[int]*platformv1.PixoOrganization{}
+	for i := range organizations.Items {
+		if orgID := organizations.Items[i].Status.OrgID; orgID != 0 {
+			byID[orgID] = &organizations.Items[i]
+		}
+	}
+
+	return byID, nil
+}
+
+// scopeClient returns the platform client of the scope and, for a
+// connection, the connection to record events on.
+func (s *OrphanSweeper) scopeClient(ctx context.Context, scope *sweepScope) (graphql.PlatformClient, client.Object, error) {
+	if scope.connection == nil {
+		return s.PlatformClient, nil, nil
+	}
+
+	platformClient, connection, err := connectionClient(ctx, s.Client, s.Connections, *scope.connection, scope.connection.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return platformClient, connection, nil
+}
+
+// isOrphan reports whether user looks like one of the operator's users but
+// no account in the scope tracks it. The operator's own user never is.
+func (s *OrphanSweeper) isOrphan(platformClient graphql.PlatformClient, scope *sweepScope, user *platform.User) bool {
+	if user == nil || user.ID == 0 || user.ID == platformClient.ActiveUserID() {
+		return false
+	}
+
+	if !s.UsernamePattern.MatchString(user.Username) {
+		return false
+	}
+
+	return !scope.usernames[user.Username] && !scope.userIDs[user.ID]
+}
+
+// deleteOrphan revokes the api keys of an orphaned user and deletes it.
+func deleteOrphan(ctx context.Context, platformClient graphql.PlatformClient, userID int) error {
+	apiKeys, err := platformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &userID})
+	if err != nil && !platformclient.IsNotFound(err) {
+		return err
+	}
+
+	for _, apiKey := range apiKeys {
+		if err = platformClient.DeleteAPIKey(ctx, apiKey.ID); err != nil && !platformclient.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if err = platformClient.DeleteUser(ctx, userID); err != nil && !platformclient.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// event logs the message and records it on object, if there is one.
+func (s *OrphanSweeper) event(ctx context.Context, object client.Object, eventType, reason, message string) {
+	log.FromContext(ctx).Info(message, "reason", reason)
+
+	if s.Recorder == nil || object == nil {
+		return
+	}
+
+	s.Recorder.Event(object, eventType, reason, message)
+}
+
+func sortedKeys[K string | int, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
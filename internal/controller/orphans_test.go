@@ -0,0 +1,159 @@
+package controller_test
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/internal/platformclient/fake"
+	"regexp"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
+)
+
+var _ = Describe("OrphanSweeper", func() {
+
+	var (
+		ctx            context.Context
+		platformClient *fake.Client
+		recorder       *record.FakeRecorder
+		sweeper        *controller.OrphanSweeper
+		orgID          int
+		now            time.Time
+		tracked        *platformv1.PixoServiceAccount
+		orphan         *platform.User
+	)
+
+	nextOrgID := 9000
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		recorder = record.NewFakeRecorder(20)
+		nextOrgID++
+		orgID = nextOrgID
+		now = time.Now()
+
+		organization := &platformv1.PixoOrganization{ObjectMeta: metav1.ObjectMeta{Name: "sweep-" + strings.ToLower(faker.Username()), Namespace: Namespace}}
+		Expect(k8sClient.Create(ctx, organization)).To(Succeed())
+		patch := runtime.MergeFrom(organization.DeepCopy())
+		organization.Status.OrgID = orgID
+		Expect(k8sClient.Status().Patch(ctx, organization, patch)).To(Succeed())
+
+		tracked = NewTestServiceAccount(Namespace, "sweep-"+strings.ToLower(faker.Username()), "admin")
+		tracked.Spec.OrgID = orgID
+		Expect(k8sClient.Create(ctx, tracked)).To(Succeed())
+		platformClient.AddUser(platform.User{Username: tracked.Name, OrgID: orgID}, "")
+		platformClient.AddUser(platform.User{Username: "jane-" + strings.ToLower(faker.Username()), OrgID: orgID}, "")
+		orphan = platformClient.AddUser(platform.User{Username: "sweep-" + strings.ToLower(faker.Username()), OrgID: orgID}, "")
+
+		sweeper = &controller.OrphanSweeper{
+			Client:          k8sClient,
+			PlatformClient:  platformClient,
+			Recorder:        recorder,
+			UsernamePattern: regexp.MustCompile("^sweep-"),
+			GracePeriod:     time.Hour,
+		}
+	})
+
+	It("should report users no account tracks once the grace period passed", func() {
+		report, err := sweeper.Sweep(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Orphans).To(BeEmpty())
+
+		report, err = sweeper.Sweep(ctx, now.Add(2*time.Hour))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Orphans).To(ConsistOf(And(
+			HaveField("UserID", orphan.ID),
+			HaveField("OrgID", orgID),
+			HaveField("Since", now),
+		)))
+		Expect(report.Deleted).To(BeEmpty())
+		_, exists := platformClient.User(orphan.Username)
+		Expect(exists).To(BeTrue())
+		Expect(ReceivedEvents(recorder, platformv1.ReasonOrphanedUser)).To(ConsistOf(ContainSubstring(orphan.Username)))
+	})
+
+	It("should delete orphans and their api keys when enabled", func() {
+		sweeper.Delete = true
+		_, err := platformClient.CreateAPIKey(ctx, platform.APIKey{UserID: orphan.ID})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sweeper.Sweep(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := sweeper.Sweep(ctx, now.Add(2*time.Hour))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(ConsistOf(HaveField("UserID", orphan.ID)))
+		_, exists := platformClient.User(orphan.Username)
+		Expect(exists).To(BeFalse())
+		Expect(platformClient.APIKeysForUser(orphan.ID)).To(BeEmpty())
+		_, exists = platformClient.User(tracked.Name)
+		Expect(exists).To(BeTrue())
+		Expect(ReceivedEvents(recorder, platformv1.ReasonOrphanedUserDeleted)).To(HaveLen(1))
+	})
+
+	It("should keep users of accounts on other connections to the same platform", func() {
+		sweeper.Delete = true
+		sweeper.Connections = platformclient.NewPool(func(platformclient.ConnectionConfig) (graphql.PlatformClient, error) {
+			return platformClient, nil
+		}, platformclient.Options{})
+
+		var connected []*platform.User
+		for _, name := range []string{"blue", "green"} {
+			name = name + "-" + strings.ToLower(faker.Username())
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name + "-credentials", Namespace: Namespace},
+				StringData: map[string]string{platformclient.CredentialsAPIKeyFile: name},
+			})).To(Succeed())
+			Expect(k8sClient.Create(ctx, &platformv1.PixoPlatformConnection{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+				Spec: platformv1.PixoPlatformConnectionSpec{
+					Lifecycle:            "dev",
+					CredentialsSecretRef: corev1.LocalObjectReference{Name: name + "-credentials"},
+				},
+			})).To(Succeed())
+
+			serviceAccount := NewTestServiceAccount(Namespace, "sweep-"+strings.ToLower(faker.Username()), "admin")
+			serviceAccount.Spec.OrgID = orgID
+			serviceAccount.Spec.ConnectionRef = name
+			Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+			connected = append(connected, platformClient.AddUser(platform.User{Username: serviceAccount.Name, OrgID: orgID}, ""))
+		}
+		_, err := sweeper.Sweep(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := sweeper.Sweep(ctx, now.Add(2*time.Hour))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(ConsistOf(HaveField("UserID", orphan.ID)))
+		for _, user := range append(connected, &platform.User{Username: tracked.Name}) {
+			_, exists := platformClient.User(user.Username)
+			Expect(exists).To(BeTrue())
+		}
+	})
+
+	It("should forget a user an account tracks again within the grace period", func() {
+		_, err := sweeper.Sweep(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+		adopting := NewTestServiceAccount(Namespace, orphan.Username, "admin")
+		adopting.Spec.OrgID = orgID
+		Expect(k8sClient.Create(ctx, adopting)).To(Succeed())
+
+		report, err := sweeper.Sweep(ctx, now.Add(2*time.Hour))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Orphans).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,545 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+)
+
+const apiKeyFinalizerName = "apikey.platform.pixovr.com"
+
+// PixoAPIKeyReconciler reconciles a PixoAPIKey object
+type PixoAPIKeyReconciler struct {
+	client.Client
+	Scheme         *runtime.Scheme
+	PlatformClient graphql.PlatformClient
+	Recorder       record.EventRecorder
+
+	// Connections holds the clients of the PixoPlatformConnections service
+	// accounts reference. Keys are managed on their service account's
+	// connection.
+	Connections *platformclient.Pool
+
+	// DryRun plans every reconcile instead of acting on it, as if each
+	// object had the dry-run annotation.
+	DryRun bool
+}
+
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoapikeys,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoapikeys/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoapikeys/finalizers,verbs=update
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoplatformconnections,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile issues an API key for the referenced service account's user,
+// writes it to the key's own Secret, rotates it when it is due and revokes it
+// when it expires or the PixoAPIKey is deleted.
+func (r *PixoAPIKeyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withRequestLogger(ctx, req)
+
+	apiKey := &platformv1.PixoAPIKey{}
+	if err := r.Get(ctx, req.NamespacedName, apiKey); err != nil {
+		if errors.IsNotFound(err) {
+			log.FromContext(ctx).V(1).Info("api key not found")
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+	ctx = withStatusBase(ctx, apiKey)
+
+	platformClient, err := r.platformClient(ctx, apiKey)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, apiKey, "failed to resolve platform connection", err))
+	}
+	reconciler := *r
+	reconciler.PlatformClient = platformClient
+
+	if isDryRun(r.DryRun, apiKey) {
+		return reconciler.dryRun(ctx, apiKey)
+	}
+
+	if err := clearPlan(ctx, r.Client, apiKey, &apiKey.Status.Plan, &apiKey.Status.Conditions); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return reconciler.reconcile(ctx, apiKey)
+}
+
+// platformClient returns the client of the connection the key's service
+// account is managed on. A key whose service account is gone falls back to
+// the operator's own connection.
+func (r *PixoAPIKeyReconciler) platformClient(ctx context.Context, apiKey *platformv1.PixoAPIKey) (graphql.PlatformClient, error) {
+	serviceAccount := &platformv1.PixoServiceAccount{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: apiKey.Namespace, Name: apiKey.Spec.ServiceAccountName}, serviceAccount); err != nil {
+		if errors.IsNotFound(err) {
+			return r.PlatformClient, nil
+		}
+
+		return nil, err
+	}
+
+	return PlatformClientFor(ctx, r.Client, r.Connections, r.PlatformClient, serviceAccount)
+}
+
+// dryRun runs the reconcile of the key against clients that only record what
+// it would change, and publishes the result.
+func (r *PixoAPIKeyReconciler) dryRun(ctx context.Context, apiKey *platformv1.PixoAPIKey) (ctrl.Result, error) {
+	p := &plan{}
+	planner := *r
+	planner.Client = &planClient{Client: r.Client, plan: p}
+	planner.PlatformClient = platformclient.NewPlanningClient(r.PlatformClient, p.add)
+
+	_, err := planner.reconcile(withPlan(ctx, p), apiKey.DeepCopy())
+	if recordErr := recordPlan(ctx, r.Client, r.Recorder, apiKey, &apiKey.Status.Plan, &apiKey.Status.Conditions, p, err); recordErr != nil {
+		return ctrl.Result{}, recordErr
+	}
+
+	return result(err)
+}
+
+func (r *PixoAPIKeyReconciler) reconcile(ctx context.Context, apiKey *platformv1.PixoAPIKey) (ctrl.Result, error) {
+	if apiKey.GetDeletionTimestamp() != nil {
+		if !controllerutil.ContainsFinalizer(apiKey, apiKeyFinalizerName) {
+			return ctrl.Result{}, nil
+		}
+
+		if err := r.revoke(ctx, apiKey); err != nil {
+			return result(r.handleStatusUpdate(ctx, apiKey, "failed to revoke api key", err))
+		}
+
+		controllerutil.RemoveFinalizer(apiKey, apiKeyFinalizerName)
+		return ctrl.Result{}, r.Update(ctx, apiKey)
+	}
+
+	if !controllerutil.ContainsFinalizer(apiKey, apiKeyFinalizerName) {
+		controllerutil.AddFinalizer(apiKey, apiKeyFinalizerName)
+		if err := r.Update(ctx, apiKey); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if apiKey.Expired(time.Now()) {
+		if err := r.revoke(ctx, apiKey); err != nil {
+			return result(r.handleStatusUpdate(ctx, apiKey, "failed to revoke expired api key", err))
+		}
+
+		// an expired key stays revoked, so there is nothing to requeue for
+		_ = r.handleStatusUpdate(ctx, apiKey, "", newNotReadyError(platformv1.ReasonExpired,
+			"api key expired at %s", apiKey.Spec.ExpiresAt.UTC().Format(time.RFC3339)))
+		return ctrl.Result{}, nil
+	}
+
+	serviceAccount, err := r.serviceAccount(ctx, apiKey)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, apiKey, "", err))
+	}
+
+	if serviceAccount.IsSuspended() || serviceAccount.Status.Suspended || !serviceAccount.IsEnabled() {
+		if serviceAccount.Status.AccessRevoked && apiKey.Status.APIKeyID != 0 {
+			patch := client.MergeFrom(apiKey.DeepCopy())
+			if err = r.revoke(ctx, apiKey); err != nil {
+				return result(r.handleStatusUpdate(ctx, apiKey, "failed to revoke api key of inactive service account", err))
+			}
+			if err = r.Status().Patch(ctx, apiKey, patch); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		// a new key is issued once the service account is resumed or enabled
+		return result(r.handleStatusUpdate(ctx, apiKey, "", newNotReadyError(platformv1.ReasonServiceAccountNotReady,
+			"service account %s is suspended or disabled", serviceAccount.Name)))
+	}
+
+	if err = r.ensureKey(ctx, apiKey, serviceAccount); err != nil {
+		return result(r.handleStatusUpdate(ctx, apiKey, "failed to issue api key", err))
+	}
+
+	if err = r.handleStatusUpdate(ctx, apiKey, "", nil); err != nil {
+		return result(err)
+	}
+
+	return ctrl.Result{RequeueAfter: nextKeyEvent(apiKey, time.Now())}, nil
+}
+
+// serviceAccount returns the service account the key is issued for, once it
+// has a platform user.
+func (r *PixoAPIKeyReconciler) serviceAccount(ctx context.Context, apiKey *platformv1.PixoAPIKey) (*platformv1.PixoServiceAccount, error) {
+	key := types.NamespacedName{Namespace: apiKey.Namespace, Name: apiKey.Spec.ServiceAccountName}
+
+	serviceAccount := &platformv1.PixoServiceAccount{}
+	if err := r.Get(ctx, key, serviceAccount); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, newNotReadyError(platformv1.ReasonServiceAccountNotReady, "service account %s not found", key.Name)
+		}
+
+		return nil, err
+	}
+
+	if serviceAccount.Status.ID == 0 {
+		return nil, newNotReadyError(platformv1.ReasonServiceAccountNotReady, "service account %s has no platform user yet", key.Name)
+	}
+
+	return serviceAccount, nil
+}
+
+// ensureKey makes sure the Secret holds a live key for the service account's
+// user. A key is issued when there is none, when the user was replaced or
+// when rotation is due; the key it replaces is revoked only after the Secret
+// and status point at the new one.
+func (r *PixoAPIKeyReconciler) ensureKey(ctx context.Context, apiKey *platformv1.PixoAPIKey, serviceAccount *platformv1.PixoServiceAccount) error {
+	current, err := r.currentKey(ctx, apiKey, serviceAccount)
+	if err != nil {
+		return err
+	}
+
+	var issued *platform.APIKey
+	due, rotates := apiKey.RotationDue()
+	if current == nil || (rotates && !time.Now().Before(due)) {
+		if issued, err = r.issueKey(ctx, apiKey, serviceAccount); err != nil {
+			return err
+		}
+	}
+
+	written := current
+	if issued != nil {
+		written = issued
+	}
+	if err = r.writeSecret(ctx, apiKey, serviceAccount, written); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(apiKey.DeepCopy())
+	staleSecret := apiKey.Status.SecretName
+	apiKey.Status.SecretName = apiKey.SecretName()
+	if staleSecret != "" && staleSecret != apiKey.SecretName() {
+		if err = r.deleteSecret(ctx, apiKey, staleSecret); err != nil {
+			return err
+		}
+	}
+
+	if issued == nil {
+		return nil
+	}
+
+	// status only moves to the new key once the Secret holds it, and
+	// records it before the old one is revoked, so a failure in between
+	// never leaves status pointing at a revoked key
+	now := metav1.Now()
+	apiKey.Status.APIKeyID = issued.ID
+	apiKey.Status.UserID = serviceAccount.Status.ID
+	apiKey.Status.IssuedAt = &now
+	apiKey.Status.RequestedAt = nil
+	apiKey.Status.PendingAPIKeyID = 0
+	apiKey.Status.PriorAPIKeyIDs = nil
+	apiKey.Status.NextRotationAt = nil
+	if due, ok := apiKey.RotationDue(); ok {
+		apiKey.Status.NextRotationAt = &metav1.Time{Time: due}
+	}
+	if err = r.Status().Patch(ctx, apiKey, patch); err != nil {
+		return err
+	}
+
+	if current != nil {
+		if err = r.PlatformClient.DeleteAPIKey(ctx, current.ID); err != nil && !platformclient.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("revoked rotated api key", "apiKeyId", current.ID)
+	}
+
+	return nil
+}
+
+// issueKey creates a key for the service account's user. The request, with
+// the user's existing keys, and then the issued key are recorded in status
+// before the Secret is written, so a retry after a failure in between picks
+// up the key it already minted instead of minting another.
+func (r *PixoAPIKeyReconciler) issueKey(ctx context.Context, apiKey *platformv1.PixoAPIKey, serviceAccount *platformv1.PixoServiceAccount) (*platform.APIKey, error) {
+	if apiKey.Status.RequestedAt != nil {
+		pending, err := r.findRequestedKey(ctx, apiKey, serviceAccount)
+		if err != nil || pending != nil {
+			return pending, err
+		}
+	} else {
+		prior, err := apiKeyIDs(ctx, r.PlatformClient, serviceAccount.Status.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		patch := client.MergeFrom(apiKey.DeepCopy())
+		now := metav1.Now()
+		apiKey.Status.RequestedAt = &now
+		apiKey.Status.PendingAPIKeyID = 0
+		apiKey.Status.PriorAPIKeyIDs = prior
+		if err = r.Status().Patch(ctx, apiKey, patch); err != nil {
+			return nil, err
+		}
+	}
+
+	issued, err := r.PlatformClient.CreateAPIKey(ctx, platform.APIKey{UserID: serviceAccount.Status.ID})
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("issued api key", "apiKeyId", issued.ID, "userId", serviceAccount.Status.ID)
+
+	patch := client.MergeFrom(apiKey.DeepCopy())
+	apiKey.Status.PendingAPIKeyID = issued.ID
+	if err = r.Status().Patch(ctx, apiKey, patch); err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+// findRequestedKey returns the key an interrupted issueKey minted: the
+// pending key recorded in status, or else the newest key of the user that
+// wasn't there before the request and that no account, api key or exchange
+// ledger records.
+func (r *PixoAPIKeyReconciler) findRequestedKey(ctx context.Context, apiKey *platformv1.PixoAPIKey, serviceAccount *platformv1.PixoServiceAccount) (*platform.APIKey, error) {
+	userID := serviceAccount.Status.ID
+	keys, err := r.PlatformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &userID})
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey.Status.PendingAPIKeyID != 0 {
+		for _, key := range keys {
+			if key.ID == apiKey.Status.PendingAPIKeyID {
+				log.FromContext(ctx).Info("recovered api key of an interrupted reconcile", "apiKeyId", key.ID)
+				return key, nil
+			}
+		}
+	}
+
+	claimed, err := claimedAPIKeys(ctx, r.Client, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+	claimed[serviceAccount.Status.APIKeyID] = true
+
+	found := mintedAPIKey(keys, apiKey.Status.PriorAPIKeyIDs, claimed)
+	if found != nil {
+		log.FromContext(ctx).Info("recovered api key of an interrupted reconcile", "apiKeyId", found.ID)
+	}
+	return found, nil
+}
+
+// currentKey returns the key recorded in status if it still exists on the
+// platform and belongs to the service account's current user.
+func (r *PixoAPIKeyReconciler) currentKey(ctx context.Context, apiKey *platformv1.PixoAPIKey, serviceAccount *platformv1.PixoServiceAccount) (*platform.APIKey, error) {
+	if apiKey.Status.APIKeyID == 0 || apiKey.Status.UserID != serviceAccount.Status.ID {
+		return nil, nil
+	}
+
+	userID := serviceAccount.Status.ID
+	keys, err := r.PlatformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &userID})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if key.ID == apiKey.Status.APIKeyID {
+			return key, nil
+		}
+	}
+
+	log.FromContext(ctx).Info("api key no longer exists on the platform", "apiKeyId", apiKey.Status.APIKeyID)
+	return nil, nil
+}
+
+func (r *PixoAPIKeyReconciler) writeSecret(ctx context.Context, apiKey *platformv1.PixoAPIKey, serviceAccount *platformv1.PixoServiceAccount, key *platform.APIKey) error {
+	secret := apiKey.GenerateSecretSpec()
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if secret.CreationTimestamp.IsZero() {
+			if err := controllerutil.SetControllerReference(apiKey, secret, r.Client.Scheme()); err != nil {
+				return err
+			}
+		} else if !metav1.IsControlledBy(secret, apiKey) {
+			return fmt.Errorf("secret %s already exists and is not managed by this api key", secret.Name)
+		}
+
+		secret.Labels = map[string]string{
+			"platform.pixovr.com/service-account-name": serviceAccount.Name,
+			"platform.pixovr.com/api-key-name":         apiKey.Name,
+			"platform.pixovr.com/api-key-id":           fmt.Sprint(key.ID),
+			"platform.pixovr.com/user-id":              fmt.Sprint(serviceAccount.Status.ID),
+		}
+		secret.Data = map[string][]byte{
+			"username": []byte(serviceAccount.Status.Username),
+			"api-key":  []byte(key.Key),
+		}
+		return nil
+	})
+
+	return err
+}
+
+// revoke deletes the platform key and the Secret holding it.
+func (r *PixoAPIKeyReconciler) revoke(ctx context.Context, apiKey *platformv1.PixoAPIKey) error {
+	if apiKey.Status.APIKeyID != 0 {
+		if err := r.PlatformClient.DeleteAPIKey(ctx, apiKey.Status.APIKeyID); err != nil && !platformclient.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("revoked api key", "apiKeyId", apiKey.Status.APIKeyID)
+	}
+
+	// a key issued by an interrupted reconcile never reached the Secret
+	if pending := apiKey.Status.PendingAPIKeyID; pending != 0 && pending != apiKey.Status.APIKeyID {
+		if err := r.PlatformClient.DeleteAPIKey(ctx, pending); err != nil && !platformclient.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("revoked pending api key", "apiKeyId", pending)
+	}
+
+	secretName := apiKey.Status.SecretName
+	if secretName == "" {
+		secretName = apiKey.SecretName()
+	}
+
+	if err := r.deleteSecret(ctx, apiKey, secretName); err != nil {
+		return err
+	}
+
+	apiKey.Status.APIKeyID = 0
+	apiKey.Status.RequestedAt = nil
+	apiKey.Status.PendingAPIKeyID = 0
+	apiKey.Status.PriorAPIKeyIDs = nil
+	apiKey.Status.IssuedAt = nil
+	apiKey.Status.NextRotationAt = nil
+	apiKey.Status.SecretName = ""
+	return nil
+}
+
+// deleteSecret deletes the named Secret if this api key manages it.
+func (r *PixoAPIKeyReconciler) deleteSecret(ctx context.Context, apiKey *platformv1.PixoAPIKey, name string) error {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: apiKey.Namespace, Name: name}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if !metav1.IsControlledBy(secret, apiKey) {
+		return nil
+	}
+
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+func (r *PixoAPIKeyReconciler) handleStatusUpdate(ctx context.Context, apiKey *platformv1.PixoAPIKey, msg string, err error) error {
+	logger := log.FromContext(ctx).WithValues("apiKeyId", apiKey.Status.APIKeyID)
+
+	ready := metav1.Condition{
+		Type:               platformv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             platformv1.ReasonReconciled,
+		Message:            "api key is issued and written to its secret",
+		ObservedGeneration: apiKey.Generation,
+	}
+
+	if err != nil {
+		reason, transient := conditionReason(err)
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reason
+		ready.Message = err.Error()
+		if msg != "" {
+			ready.Message = fmt.Sprintf("%s: %v", msg, err)
+		}
+
+		if transient {
+			logger.Info(ready.Message)
+		} else {
+			logger.Error(err, msg)
+			apiKey.Status.Error = err.Error()
+		}
+	} else {
+		apiKey.Status.Error = ""
+	}
+
+	meta.SetStatusCondition(&apiKey.Status.Conditions, ready)
+
+	if updateErr := r.Status().Patch(ctx, apiKey, statusPatch(ctx, apiKey)); updateErr != nil {
+		logger.Error(updateErr, "failed to update status")
+	}
+
+	return err
+}
+
+// nextKeyEvent returns how long until the key is due for rotation or
+// expires, or zero if neither is scheduled.
+func nextKeyEvent(apiKey *platformv1.PixoAPIKey, now time.Time) time.Duration {
+	var next time.Duration
+	for _, at := range []*metav1.Time{apiKey.Status.NextRotationAt, apiKey.Spec.ExpiresAt} {
+		if at == nil {
+			continue
+		}
+
+		if until := at.Sub(now); next == 0 || until < next {
+			next = max(until, time.Second)
+		}
+	}
+
+	return next
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PixoAPIKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.PixoAPIKey{}).
+		Owns(&corev1.Secret{}).
+		Watches(
+			&platformv1.PixoServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(r.findAPIKeysForServiceAccount),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+func (r *PixoAPIKeyReconciler) findAPIKeysForServiceAccount(ctx context.Context, serviceAccount client.Object) []reconcile.Request {
+	apiKeys := &platformv1.PixoAPIKeyList{}
+	if err := r.List(ctx, apiKeys, client.InNamespace(serviceAccount.GetNamespace())); err != nil {
+		return []reconcile.Request{}
+	}
+
+	var requests []reconcile.Request
+	for _, item := range apiKeys.Items {
+		if item.Spec.ServiceAccountName == serviceAccount.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+	}
+	return requests
+}
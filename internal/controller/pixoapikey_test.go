@@ -0,0 +1,262 @@
+package controller_test
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
+)
+
+var _ = Describe("PixoAPIKey", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoAPIKeyReconciler
+		platformClient *fake.Client
+		serviceAccount *platformv1.PixoServiceAccount
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoAPIKeyReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+
+		serviceAccountReconciler := controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		serviceAccount = CreateTestServiceAccount(ctx, Namespace)
+		_, err := serviceAccountReconciler.Reconcile(ctx, NewRequest(serviceAccount))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+	})
+
+	It("can issue a key for the service account's user into its own secret", func() {
+		apiKey := CreateTestAPIKey(ctx, serviceAccount)
+
+		_, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).NotTo(BeZero())
+		Expect(apiKey.Status.APIKeyID).NotTo(Equal(serviceAccount.Status.APIKeyID))
+		ExpectAPIKeyReady(apiKey, metav1.ConditionTrue, platformv1.ReasonReconciled)
+		issued, ok := platformClient.APIKey(apiKey.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		Expect(issued.UserID).To(Equal(serviceAccount.Status.ID))
+		secret := GetAPIKeySecret(ctx, apiKey)
+		Expect(string(secret.Data["api-key"])).To(Equal(issued.Key))
+		Expect(metav1.IsControlledBy(secret, apiKey)).To(BeTrue())
+
+		calls := platformClient.Calls("CreateAPIKey")
+		_, err = reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(calls))
+		Expect(platformClient.APIKeysForUser(serviceAccount.Status.ID)).To(ContainElement(HaveField("ID", apiKey.Status.APIKeyID)))
+	})
+
+	It("can reuse the key it issued when writing the secret failed", func() {
+		apiKey := CreateTestAPIKey(ctx, serviceAccount)
+		foreign := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: apiKey.SecretName(), Namespace: Namespace}}
+		Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+		calls := platformClient.Calls("CreateAPIKey")
+
+		_, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).To(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).To(BeZero())
+		Expect(apiKey.Status.PendingAPIKeyID).NotTo(BeZero())
+		Expect(apiKey.Status.Error).To(ContainSubstring("not managed by this api key"))
+		pending := apiKey.Status.PendingAPIKeyID
+
+		Expect(k8sClient.Delete(ctx, foreign)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(calls + 1))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).To(Equal(pending))
+		Expect(apiKey.Status.PendingAPIKeyID).To(BeZero())
+		Expect(apiKey.Status.RequestedAt).To(BeNil())
+		Expect(apiKey.Status.Error).To(BeEmpty())
+		Expect(platformClient.APIKeysForUser(serviceAccount.Status.ID)).To(HaveLen(2))
+	})
+
+	It("can reuse a key whose creation response was lost", func() {
+		apiKey := CreateTestAPIKey(ctx, serviceAccount)
+		platformClient.InjectFault(fake.Fault{Operation: "CreateAPIKey", StatusCode: http.StatusBadGateway, Times: 1, Lost: true})
+		calls := platformClient.Calls("CreateAPIKey")
+
+		_, _ = reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.RequestedAt).NotTo(BeNil())
+		Expect(apiKey.Status.PendingAPIKeyID).To(BeZero())
+		keys, err := platformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &serviceAccount.Status.ID})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveEach(HaveField("CreatedAt", BeZero())))
+
+		_, err = reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(calls + 1))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).NotTo(BeZero())
+		Expect(apiKey.Status.PriorAPIKeyIDs).To(BeEmpty())
+		Expect(platformClient.APIKeysForUser(serviceAccount.Status.ID)).To(HaveLen(2))
+	})
+
+	It("can revoke one key without affecting the others", func() {
+		blue := CreateTestAPIKey(ctx, serviceAccount)
+		green := CreateTestAPIKey(ctx, serviceAccount)
+		_, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(blue))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconciler.Reconcile(ctx, NewAPIKeyRequest(green))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(blue), blue)).To(Succeed())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(green), green)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, blue)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, NewAPIKeyRequest(blue))
+
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := platformClient.APIKey(blue.Status.APIKeyID)
+		Expect(ok).To(BeFalse())
+		_, ok = platformClient.APIKey(green.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		_, ok = platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(blue), blue)).NotTo(Succeed())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(blue.GenerateSecretSpec()), &corev1.Secret{})).NotTo(Succeed())
+	})
+
+	It("can rotate the key once it is due", func() {
+		apiKey := NewTestAPIKey(serviceAccount)
+		apiKey.Spec.RotationPeriod = &metav1.Duration{Duration: time.Nanosecond}
+		Expect(k8sClient.Create(ctx, apiKey)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		first := apiKey.Status.APIKeyID
+
+		result, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).NotTo(Equal(first))
+		_, ok := platformClient.APIKey(first)
+		Expect(ok).To(BeFalse())
+		rotated, ok := platformClient.APIKey(apiKey.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		Expect(string(GetAPIKeySecret(ctx, apiKey).Data["api-key"])).To(Equal(rotated.Key))
+	})
+
+	It("can revoke the key and remove its secret once it expires", func() {
+		apiKey := CreateTestAPIKey(ctx, serviceAccount)
+		_, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		issued := apiKey.Status.APIKeyID
+		apiKey.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+		Expect(k8sClient.Update(ctx, apiKey)).To(Succeed())
+
+		result, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		_, ok := platformClient.APIKey(issued)
+		Expect(ok).To(BeFalse())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey.GenerateSecretSpec()), &corev1.Secret{})).NotTo(Succeed())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).To(BeZero())
+		Expect(apiKey.Status.SecretName).To(BeEmpty())
+		Expect(apiKey.Status.IssuedAt).To(BeNil())
+		ExpectAPIKeyReady(apiKey, metav1.ConditionFalse, platformv1.ReasonExpired)
+	})
+
+	It("can replace a key that was revoked on the platform", func() {
+		apiKey := CreateTestAPIKey(ctx, serviceAccount)
+		_, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(platformClient.DeleteAPIKey(ctx, apiKey.Status.APIKeyID)).To(Succeed())
+		revoked := apiKey.Status.APIKeyID
+
+		_, err = reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).NotTo(Equal(revoked))
+		replacement, ok := platformClient.APIKey(apiKey.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		Expect(string(GetAPIKeySecret(ctx, apiKey).Data["api-key"])).To(Equal(replacement.Key))
+	})
+
+	It("can wait for a service account that doesn't exist yet", func() {
+		apiKey := NewTestAPIKey(serviceAccount)
+		apiKey.Spec.ServiceAccountName = "missing"
+		Expect(k8sClient.Create(ctx, apiKey)).To(Succeed())
+
+		result, err := reconciler.Reconcile(ctx, NewAPIKeyRequest(apiKey))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey), apiKey)).To(Succeed())
+		Expect(apiKey.Status.APIKeyID).To(BeZero())
+		ExpectAPIKeyReady(apiKey, metav1.ConditionFalse, platformv1.ReasonServiceAccountNotReady)
+	})
+
+})
+
+func NewTestAPIKey(serviceAccount *platformv1.PixoServiceAccount) *platformv1.PixoAPIKey {
+	return &platformv1.PixoAPIKey{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      strings.ToLower(faker.Username()),
+			Namespace: serviceAccount.Namespace,
+		},
+		Spec: platformv1.PixoAPIKeySpec{
+			ServiceAccountName: serviceAccount.Name,
+		},
+	}
+}
+
+func CreateTestAPIKey(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount) *platformv1.PixoAPIKey {
+	apiKey := NewTestAPIKey(serviceAccount)
+	Expect(k8sClient.Create(ctx, apiKey)).To(Succeed())
+	return apiKey
+}
+
+func NewAPIKeyRequest(apiKey *platformv1.PixoAPIKey) ctrl.Request {
+	return ctrl.Request{NamespacedName: runtime.ObjectKeyFromObject(apiKey)}
+}
+
+func GetAPIKeySecret(ctx context.Context, apiKey *platformv1.PixoAPIKey) *corev1.Secret {
+	secret := &corev1.Secret{}
+	Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(apiKey.GenerateSecretSpec()), secret)).To(Succeed())
+	return secret
+}
+
+func ExpectAPIKeyReady(apiKey *platformv1.PixoAPIKey, status metav1.ConditionStatus, reason string) {
+	condition := meta.FindStatusCondition(apiKey.Status.Conditions, platformv1.ConditionReady)
+	Expect(condition).NotTo(BeNil())
+	Expect(condition.Status).To(Equal(status))
+	Expect(condition.Reason).To(Equal(reason))
+}
@@ -0,0 +1,439 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"slices"
+)
+
+const bindingFinalizerName = "binding.platform.pixovr.com"
+
+// PixoCredentialBindingReconciler reconciles a PixoCredentialBinding object
+type PixoCredentialBindingReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// DryRun plans every reconcile instead of acting on it, as if each
+	// object had the dry-run annotation.
+	DryRun bool
+}
+
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixocredentialbindings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixocredentialbindings/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixocredentialbindings/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch
+
+// Reconcile injects the credentials of the bound service account into every
+// Deployment the binding's selectors match, and removes them from the ones
+// that stopped matching or when the binding is deleted.
+func (r *PixoCredentialBindingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withRequestLogger(ctx, req)
+
+	binding := &platformv1.PixoCredentialBinding{}
+	if err := r.Get(ctx, req.NamespacedName, binding); err != nil {
+		if errors.IsNotFound(err) {
+			log.FromContext(ctx).V(1).Info("credential binding not found")
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+	ctx = withStatusBase(ctx, binding)
+
+	if isDryRun(r.DryRun, binding) {
+		return r.dryRun(ctx, binding)
+	}
+
+	if err := clearPlan(ctx, r.Client, binding, &binding.Status.Plan, &binding.Status.Conditions); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return r.reconcile(ctx, binding)
+}
+
+// dryRun runs the reconcile of the binding against a client that only
+// records what it would change, and publishes the result.
+func (r *PixoCredentialBindingReconciler) dryRun(ctx context.Context, binding *platformv1.PixoCredentialBinding) (ctrl.Result, error) {
+	p := &plan{}
+	planner := *r
+	planner.Client = &planClient{Client: r.Client, plan: p}
+
+	_, err := planner.reconcile(withPlan(ctx, p), binding.DeepCopy())
+	if recordErr := recordPlan(ctx, r.Client, r.Recorder, binding, &binding.Status.Plan, &binding.Status.Conditions, p, err); recordErr != nil {
+		return ctrl.Result{}, recordErr
+	}
+
+	return result(err)
+}
+
+func (r *PixoCredentialBindingReconciler) reconcile(ctx context.Context, binding *platformv1.PixoCredentialBinding) (ctrl.Result, error) {
+	if binding.GetDeletionTimestamp() != nil {
+		if !controllerutil.ContainsFinalizer(binding, bindingFinalizerName) {
+			return ctrl.Result{}, nil
+		}
+
+		if err := r.unbind(ctx, binding, binding.Status.MatchedWorkloads); err != nil {
+			return result(r.handleStatusUpdate(ctx, binding, "failed to remove credentials from workloads", err))
+		}
+
+		controllerutil.RemoveFinalizer(binding, bindingFinalizerName)
+		return ctrl.Result{}, r.Update(ctx, binding)
+	}
+
+	if !controllerutil.ContainsFinalizer(binding, bindingFinalizerName) {
+		controllerutil.AddFinalizer(binding, bindingFinalizerName)
+		if err := r.Update(ctx, binding); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	serviceAccount, err := r.serviceAccount(ctx, binding)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, binding, "", err))
+	}
+
+	matched, err := r.matchingDeployments(ctx, binding)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, binding, "failed to find matching workloads", err))
+	}
+
+	var names []string
+	for i := range matched {
+		deployment := &matched[i]
+		names = append(names, deployment.Name)
+
+		updated := deployment.DeepCopy()
+		if previous := binding.Status.InjectedSecretName; previous != "" && previous != serviceAccount.AuthSecretName() {
+			ejectCredentials(updated, binding, previous, "")
+		}
+		ejectCredentials(updated, binding, serviceAccount.AuthSecretName(), binding.InjectionStyle())
+		injectCredentials(updated, binding, serviceAccount)
+
+		if equality.Semantic.DeepEqual(deployment.Spec.Template, updated.Spec.Template) {
+			continue
+		}
+		if err = r.Update(ctx, updated); err != nil {
+			return result(r.handleStatusUpdate(ctx, binding, "failed to inject credentials into deployment "+deployment.Name, err))
+		}
+		log.FromContext(ctx).Info("injected credentials", "deployment", deployment.Name, "injection", binding.InjectionStyle())
+	}
+	slices.Sort(names)
+
+	var stale []string
+	for _, name := range binding.Status.MatchedWorkloads {
+		if !slices.Contains(names, name) {
+			stale = append(stale, name)
+		}
+	}
+	if err = r.unbind(ctx, binding, stale); err != nil {
+		return result(r.handleStatusUpdate(ctx, binding, "failed to remove credentials from workloads", err))
+	}
+
+	binding.Status.MatchedWorkloads = names
+	binding.Status.InjectedSecretName = serviceAccount.AuthSecretName()
+	return result(r.handleStatusUpdate(ctx, binding, "", nil))
+}
+
+// serviceAccount returns the service account the binding injects, once it
+// has a platform user.
+func (r *PixoCredentialBindingReconciler) serviceAccount(ctx context.Context, binding *platformv1.PixoCredentialBinding) (*platformv1.PixoServiceAccount, error) {
+	key := types.NamespacedName{Namespace: binding.Namespace, Name: binding.Spec.ServiceAccountName}
+
+	serviceAccount := &platformv1.PixoServiceAccount{}
+	if err := r.Get(ctx, key, serviceAccount); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, newNotReadyError(platformv1.ReasonServiceAccountNotReady, "service account %s not found", key.Name)
+		}
+
+		return nil, err
+	}
+
+	if serviceAccount.Status.ID == 0 {
+		return nil, newNotReadyError(platformv1.ReasonServiceAccountNotReady, "service account %s has no platform user yet", key.Name)
+	}
+
+	return serviceAccount, nil
+}
+
+// matchingDeployments returns the Deployments in the binding's namespace
+// that match all of its selectors.
+func (r *PixoCredentialBindingReconciler) matchingDeployments(ctx context.Context, binding *platformv1.PixoCredentialBinding) ([]appsv1.Deployment, error) {
+	workloadSelector, err := bindingSelector(binding.Spec.WorkloadSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workloadSelector: %w", err)
+	}
+	podSelector, err := bindingSelector(binding.Spec.PodSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid podSelector: %w", err)
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err = r.List(ctx, deployments, client.InNamespace(binding.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var matched []appsv1.Deployment
+	for _, deployment := range deployments.Items {
+		if deployment.DeletionTimestamp != nil {
+			continue
+		}
+		if workloadSelector.Matches(labels.Set(deployment.Labels)) && podSelector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+			matched = append(matched, deployment)
+		}
+	}
+
+	return matched, nil
+}
+
+// bindingSelector converts a selector of the binding; one that isn't set
+// matches everything, since the other one narrows the match.
+func bindingSelector(selector *metav1.LabelSelector) (labels.Selector, error) {
+	if selector == nil {
+		return labels.Everything(), nil
+	}
+
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+// unbind removes the credentials the binding injected from the named
+// Deployments. Deployments that no longer exist are skipped.
+func (r *PixoCredentialBindingReconciler) unbind(ctx context.Context, binding *platformv1.PixoCredentialBinding, names []string) error {
+	secretName := binding.Status.InjectedSecretName
+	if secretName == "" {
+		return nil
+	}
+
+	for _, name := range names {
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: name}, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+
+		updated := deployment.DeepCopy()
+		ejectCredentials(updated, binding, secretName, "")
+		if equality.Semantic.DeepEqual(deployment.Spec.Template, updated.Spec.Template) {
+			continue
+		}
+		if err := r.Update(ctx, updated); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("removed credentials", "deployment", name)
+	}
+
+	return nil
+}
+
+// injectCredentials adds the service account's credentials to every
+// container of the deployment in the binding's injection style.
+func injectCredentials(deployment *appsv1.Deployment, binding *platformv1.PixoCredentialBinding, serviceAccount *platformv1.PixoServiceAccount) {
+	secretName := serviceAccount.AuthSecretName()
+	podSpec := &deployment.Spec.Template.Spec
+
+	switch binding.InjectionStyle() {
+	case platformv1.InjectEnv:
+		addOrUpdateEnvVars(deployment, serviceAccount)
+	case platformv1.InjectEnvFrom:
+		for i := range podSpec.Containers {
+			container := &podSpec.Containers[i]
+			if !slices.ContainsFunc(container.EnvFrom, envFromSecret(secretName)) {
+				container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+					SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}},
+				})
+			}
+		}
+	case platformv1.InjectVolume:
+		volume := corev1.Volume{
+			Name:         binding.VolumeName(),
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secretName}},
+		}
+		if i := slices.IndexFunc(podSpec.Volumes, namedVolume(volume.Name)); i >= 0 {
+			podSpec.Volumes[i].VolumeSource = volume.VolumeSource
+		} else {
+			podSpec.Volumes = append(podSpec.Volumes, volume)
+		}
+
+		mount := corev1.VolumeMount{Name: volume.Name, MountPath: binding.MountPath(), ReadOnly: true}
+		for i := range podSpec.Containers {
+			container := &podSpec.Containers[i]
+			if j := slices.IndexFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == mount.Name }); j >= 0 {
+				container.VolumeMounts[j] = mount
+			} else {
+				container.VolumeMounts = append(container.VolumeMounts, mount)
+			}
+		}
+	}
+}
+
+// ejectCredentials removes what the binding injected for secretName in every
+// style except keep. Environment variables are left alone on deployments
+// that also ask for an account through the annotation, which owns them.
+func ejectCredentials(deployment *appsv1.Deployment, binding *platformv1.PixoCredentialBinding, secretName string, keep platformv1.InjectionStyle) {
+	podSpec := &deployment.Spec.Template.Spec
+	_, annotated := deployment.Annotations[AnnotationKey]
+
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+
+		if keep != platformv1.InjectEnv && !annotated {
+			fromSecret := func(envVar corev1.EnvVar) bool {
+				ref := envVar.ValueFrom
+				return ref != nil && ref.SecretKeyRef != nil && ref.SecretKeyRef.Name == secretName
+			}
+			if slices.ContainsFunc(container.Env, fromSecret) {
+				container.Env = slices.DeleteFunc(container.Env, func(envVar corev1.EnvVar) bool {
+					return envVar.Name == "PIXO_USERNAME" || fromSecret(envVar)
+				})
+			}
+		}
+
+		if keep != platformv1.InjectEnvFrom {
+			container.EnvFrom = slices.DeleteFunc(container.EnvFrom, envFromSecret(secretName))
+		}
+
+		if keep != platformv1.InjectVolume {
+			container.VolumeMounts = slices.DeleteFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == binding.VolumeName() })
+		}
+	}
+
+	if keep != platformv1.InjectVolume {
+		podSpec.Volumes = slices.DeleteFunc(podSpec.Volumes, namedVolume(binding.VolumeName()))
+	}
+}
+
+func envFromSecret(secretName string) func(corev1.EnvFromSource) bool {
+	return func(source corev1.EnvFromSource) bool {
+		return source.SecretRef != nil && source.SecretRef.Name == secretName
+	}
+}
+
+func namedVolume(name string) func(corev1.Volume) bool {
+	return func(volume corev1.Volume) bool {
+		return volume.Name == name
+	}
+}
+
+func (r *PixoCredentialBindingReconciler) handleStatusUpdate(ctx context.Context, binding *platformv1.PixoCredentialBinding, msg string, err error) error {
+	logger := log.FromContext(ctx)
+
+	ready := metav1.Condition{
+		Type:               platformv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             platformv1.ReasonReconciled,
+		Message:            fmt.Sprintf("credentials are injected into %d workloads", len(binding.Status.MatchedWorkloads)),
+		ObservedGeneration: binding.Generation,
+	}
+
+	if err != nil {
+		reason, transient := conditionReason(err)
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reason
+		ready.Message = err.Error()
+		if msg != "" {
+			ready.Message = fmt.Sprintf("%s: %v", msg, err)
+		}
+
+		if transient {
+			logger.Info(ready.Message)
+		} else {
+			logger.Error(err, msg)
+			binding.Status.Error = err.Error()
+		}
+	} else {
+		binding.Status.Error = ""
+	}
+
+	meta.SetStatusCondition(&binding.Status.Conditions, ready)
+
+	if updateErr := r.Status().Patch(ctx, binding, statusPatch(ctx, binding)); updateErr != nil {
+		logger.Error(updateErr, "failed to update status")
+	}
+
+	return err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PixoCredentialBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.PixoCredentialBinding{}).
+		Watches(
+			&platformv1.PixoServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(r.findBindingsForServiceAccount),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Watches(
+			&appsv1.Deployment{},
+			handler.EnqueueRequestsFromMapFunc(r.findBindingsInNamespace),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+func (r *PixoCredentialBindingReconciler) findBindingsForServiceAccount(ctx context.Context, serviceAccount client.Object) []reconcile.Request {
+	bindings := &platformv1.PixoCredentialBindingList{}
+	if err := r.List(ctx, bindings, client.InNamespace(serviceAccount.GetNamespace())); err != nil {
+		return []reconcile.Request{}
+	}
+
+	var requests []reconcile.Request
+	for _, item := range bindings.Items {
+		if item.Spec.ServiceAccountName == serviceAccount.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+	}
+	return requests
+}
+
+// findBindingsInNamespace requeues every binding in the namespace of a
+// Deployment, since a label change can make it start or stop matching.
+func (r *PixoCredentialBindingReconciler) findBindingsInNamespace(ctx context.Context, deployment client.Object) []reconcile.Request {
+	bindings := &platformv1.PixoCredentialBindingList{}
+	if err := r.List(ctx, bindings, client.InNamespace(deployment.GetNamespace())); err != nil {
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, len(bindings.Items))
+	for i, item := range bindings.Items {
+		requests[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)}
+	}
+	return requests
+}
@@ -0,0 +1,168 @@
+package controller_test
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("PixoCredentialBinding", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoCredentialBindingReconciler
+		serviceAccount *platformv1.PixoServiceAccount
+		binding        *platformv1.PixoCredentialBinding
+		req            ctrl.Request
+	)
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, binding)).To(Succeed())
+	}
+
+	labelled := func(name string, labels map[string]string) *v1.Deployment {
+		deployment := NewTestDeployment(Namespace, name, "")
+		deployment.Annotations = nil
+		deployment.Labels = labels
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+		return deployment
+	}
+
+	get := func(deployment *v1.Deployment) *v1.Deployment {
+		updated := &v1.Deployment{}
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), updated)).To(Succeed())
+		return updated
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		reconciler = controller.PixoCredentialBindingReconciler{Client: k8sClient}
+
+		serviceAccountReconciler := controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: fake.New(),
+		}
+		serviceAccount = CreateTestServiceAccount(ctx, Namespace)
+		_, err := serviceAccountReconciler.Reconcile(ctx, NewRequest(serviceAccount))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+
+		binding = &platformv1.PixoCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: serviceAccount.Name + "-analytics", Namespace: Namespace},
+			Spec: platformv1.PixoCredentialBindingSpec{
+				ServiceAccountName: serviceAccount.Name,
+				WorkloadSelector:   &metav1.LabelSelector{MatchLabels: map[string]string{"team": serviceAccount.Name}},
+			},
+		}
+		req = ctrl.Request{NamespacedName: runtime.ObjectKeyFromObject(binding)}
+	})
+
+	It("should inject env vars into matching workloads and report them", func() {
+		matching := labelled(serviceAccount.Name+"-a", map[string]string{"team": serviceAccount.Name})
+		other := labelled(serviceAccount.Name+"-b", map[string]string{"team": "other"})
+		Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+
+		reconcile()
+
+		Expect(binding.Status.MatchedWorkloads).To(Equal([]string{matching.Name}))
+		Expect(binding.Status.InjectedSecretName).To(Equal(serviceAccount.AuthSecretName()))
+		ExpectBindingReady(binding, metav1.ConditionTrue, platformv1.ReasonReconciled)
+		env := get(matching).Spec.Template.Spec.Containers[0].Env
+		Expect(env).To(ContainElement(HaveField("Name", "PIXO_USERNAME")))
+		Expect(env).To(ContainElement(HaveField("ValueFrom.SecretKeyRef.Name", serviceAccount.AuthSecretName())))
+		Expect(get(other).Spec.Template.Spec.Containers[0].Env).To(BeEmpty())
+	})
+
+	It("can mount the auth secret as a volume selected by pod labels", func() {
+		deployment := labelled(serviceAccount.Name+"-volume", nil)
+		binding.Spec.WorkloadSelector = nil
+		binding.Spec.PodSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": deployment.Name}}
+		binding.Spec.Injection = platformv1.InjectVolume
+		Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+
+		reconcile()
+
+		podSpec := get(deployment).Spec.Template.Spec
+		Expect(podSpec.Volumes).To(ContainElement(And(
+			HaveField("Name", binding.VolumeName()),
+			HaveField("Secret.SecretName", serviceAccount.AuthSecretName()),
+		)))
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(And(
+			HaveField("MountPath", platformv1.DefaultCredentialsMountPath),
+			HaveField("ReadOnly", true),
+		)))
+		Expect(podSpec.Containers[0].Env).To(BeEmpty())
+	})
+
+	It("should switch injection styles without leaving the old one behind", func() {
+		deployment := labelled(serviceAccount.Name+"-switch", map[string]string{"team": serviceAccount.Name})
+		Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+		reconcile()
+
+		binding.Spec.Injection = platformv1.InjectEnvFrom
+		Expect(k8sClient.Update(ctx, binding)).To(Succeed())
+		reconcile()
+
+		container := get(deployment).Spec.Template.Spec.Containers[0]
+		Expect(container.Env).To(BeEmpty())
+		Expect(container.EnvFrom).To(ConsistOf(HaveField("SecretRef.Name", serviceAccount.AuthSecretName())))
+	})
+
+	It("should remove credentials from workloads that stop matching or when deleted", func() {
+		leaving := labelled(serviceAccount.Name+"-leaving", map[string]string{"team": serviceAccount.Name})
+		staying := labelled(serviceAccount.Name+"-staying", map[string]string{"team": serviceAccount.Name})
+		Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+		reconcile()
+		Expect(binding.Status.MatchedWorkloads).To(HaveLen(2))
+
+		leaving = get(leaving)
+		leaving.Labels = map[string]string{"team": "other"}
+		Expect(k8sClient.Update(ctx, leaving)).To(Succeed())
+		reconcile()
+
+		Expect(binding.Status.MatchedWorkloads).To(Equal([]string{staying.Name}))
+		Expect(get(leaving).Spec.Template.Spec.Containers[0].Env).To(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, binding)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(get(staying).Spec.Template.Spec.Containers[0].Env).To(BeEmpty())
+	})
+
+	It("should wait for its service account", func() {
+		binding.Spec.ServiceAccountName = "missing"
+		Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+
+		res, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(k8sClient.Get(ctx, req.NamespacedName, binding)).To(Succeed())
+		ExpectBindingReady(binding, metav1.ConditionFalse, platformv1.ReasonServiceAccountNotReady)
+	})
+
+	It("should reject a binding without a selector", func() {
+		binding.Spec.WorkloadSelector = nil
+
+		Expect(k8sClient.Create(ctx, binding)).NotTo(Succeed())
+	})
+
+})
+
+func ExpectBindingReady(binding *platformv1.PixoCredentialBinding, status metav1.ConditionStatus, reason string) {
+	ready := meta.FindStatusCondition(binding.Status.Conditions, platformv1.ConditionReady)
+	Expect(ready).NotTo(BeNil())
+	Expect(ready.Status).To(Equal(status))
+	Expect(ready.Reason).To(Equal(reason))
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strings"
+)
+
+const orgFinalizerName = "organization.platform.pixovr.com"
+
+// PixoOrganizationReconciler reconciles a PixoOrganization object
+type PixoOrganizationReconciler struct {
+	client.Client
+	Scheme         *runtime.Scheme
+	PlatformClient graphql.PlatformClient
+	Recorder       record.EventRecorder
+
+	// DryRun plans every reconcile instead of acting on it, as if each
+	// object had the dry-run annotation.
+	DryRun bool
+}
+
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoorganizations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoorganizations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoorganizations/finalizers,verbs=update
+
+// Reconcile creates, adopts or updates the platform org for a
+// PixoOrganization. Deletion waits until no service account references the
+// organization any more.
+func (r *PixoOrganizationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withRequestLogger(ctx, req)
+
+	org := &platformv1.PixoOrganization{}
+	if err := r.Get(ctx, req.NamespacedName, org); err != nil {
+		if errors.IsNotFound(err) {
+			log.FromContext(ctx).V(1).Info("organization not found")
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+	ctx = withStatusBase(ctx, org)
+
+	if isDryRun(r.DryRun, org) {
+		return r.dryRun(ctx, org)
+	}
+
+	if err := clearPlan(ctx, r.Client, org, &org.Status.Plan, &org.Status.Conditions); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return r.reconcile(ctx, org)
+}
+
+// dryRun runs the reconcile of the organization against clients that only record what
+// it would change, and publishes the result.
+func (r *PixoOrganizationReconciler) dryRun(ctx context.Context, org *platformv1.PixoOrganization) (ctrl.Result, error) {
+	p := &plan{}
+	planner := *r
+	planner.Client = &planClient{Client: r.Client, plan: p}
+	planner.PlatformClient = platformclient.NewPlanningClient(r.PlatformClient, p.add)
+
+	_, err := planner.reconcile(withPlan(ctx, p), org.DeepCopy())
+	if recordErr := recordPlan(ctx, r.Client, r.Recorder, org, &org.Status.Plan, &org.Status.Conditions, p, err); recordErr != nil {
+		return ctrl.Result{}, recordErr
+	}
+
+	return result(err)
+}
+
+func (r *PixoOrganizationReconciler) reconcile(ctx context.Context, org *platformv1.PixoOrganization) (ctrl.Result, error) {
+	if org.GetDeletionTimestamp() != nil {
+		return r.delete(ctx, org)
+	}
+
+	orgs, err := platformclient.Orgs(r.PlatformClient)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, org, "", nil, err))
+	}
+
+	if !controllerutil.ContainsFinalizer(org, orgFinalizerName) {
+		controllerutil.AddFinalizer(org, orgFinalizerName)
+		if err = r.Update(ctx, org); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	observed, err := r.ensureOrg(ctx, org, orgs)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, org, "failed to sync platform org", nil, err))
+	}
+
+	return result(r.handleStatusUpdate(ctx, org, "", observed, nil))
+}
+
+// ensureOrg finds the org by the ID in status, or by name if it has none,
+// creates it if it doesn't exist and pushes spec changes to it. An org found
+// by name that the operator didn't create is recorded as adopted.
+func (r *PixoOrganizationReconciler) ensureOrg(ctx context.Context, org *platformv1.PixoOrganization, orgs platformclient.OrgClient) (*platform.Org, error) {
+	desired := org.GenerateOrgSpec()
+
+	var observed *platform.Org
+	if org.Status.OrgID != 0 {
+		found, err := orgs.GetOrg(ctx, org.Status.OrgID)
+		if err != nil && !platformclient.IsNotFound(err) {
+			return nil, err
+		}
+		observed = found
+	}
+
+	if observed == nil {
+		found, err := orgs.GetOrgByName(ctx, desired.Name)
+		switch {
+		case err == nil:
+			log.FromContext(ctx).Info("adopting existing org", "orgId", found.ID)
+			observed = found
+			org.Status.Adopted = true
+		case platformclient.IsNotFound(err):
+			if observed, err = orgs.CreateOrg(ctx, *desired); err != nil {
+				return nil, err
+			}
+			log.FromContext(ctx).Info("created org", "orgId", observed.ID)
+			org.Status.Adopted = false
+		default:
+			return nil, err
+		}
+	}
+
+	if observed.Name != desired.Name || (desired.Type != "" && observed.Type != desired.Type) {
+		desired.ID = observed.ID
+		updated, err := orgs.UpdateOrg(ctx, *desired)
+		if err != nil {
+			return nil, err
+		}
+		log.FromContext(ctx).Info("updated org", "orgId", updated.ID)
+		observed = updated
+	}
+
+	return observed, nil
+}
+
+// delete releases the organization once nothing references it, deleting the
+// platform org first if the deletion policy asks for it and the operator
+// created it. Only that deletion needs a client that supports orgs.
+func (r *PixoOrganizationReconciler) delete(ctx context.Context, org *platformv1.PixoOrganization) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(org, orgFinalizerName) {
+		return ctrl.Result{}, nil
+	}
+
+	serviceAccounts, err := serviceAccountsReferencingOrg(ctx, r.Client, client.ObjectKeyFromObject(org))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if len(serviceAccounts) > 0 {
+		names := make([]string, len(serviceAccounts))
+		for i, serviceAccount := range serviceAccounts {
+			names[i] = client.ObjectKeyFromObject(&serviceAccount).String()
+		}
+
+		err = newNotReadyError(platformv1.ReasonInUse, "still referenced by service accounts: %s", strings.Join(names, ", "))
+		return result(r.handleStatusUpdate(ctx, org, "waiting to delete organization", nil, err))
+	}
+
+	shouldDeleteOrg := org.Spec.DeletionPolicy == platformv1.OrgDeletionPolicyDelete && !org.Status.Adopted && org.Status.OrgID != 0
+	if shouldDeleteOrg {
+		orgs, err := platformclient.Orgs(r.PlatformClient)
+		if err != nil {
+			return result(r.handleStatusUpdate(ctx, org, "failed to delete platform org", nil, err))
+		}
+		if err = orgs.DeleteOrg(ctx, org.Status.OrgID); err != nil && !platformclient.IsNotFound(err) {
+			return result(r.handleStatusUpdate(ctx, org, "failed to delete platform org", nil, err))
+		}
+		log.FromContext(ctx).Info("deleted org", "orgId", org.Status.OrgID)
+	}
+
+	controllerutil.RemoveFinalizer(org, orgFinalizerName)
+	return ctrl.Result{}, r.Update(ctx, org)
+}
+
+func (r *PixoOrganizationReconciler) handleStatusUpdate(ctx context.Context, org *platformv1.PixoOrganization, msg string, observed *platform.Org, err error) error {
+	logger := log.FromContext(ctx).WithValues("orgId", org.Status.OrgID)
+	if err != nil {
+		logger.Error(err, msg)
+	}
+
+	ready := metav1.Condition{
+		Type:               platformv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             platformv1.ReasonReconciled,
+		Message:            "organization is in sync with the platform",
+		ObservedGeneration: org.Generation,
+	}
+
+	if err != nil {
+		reason, transient := conditionReason(err)
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reason
+		ready.Message = err.Error()
+		if msg != "" {
+			ready.Message = fmt.Sprintf("%s: %v", msg, err)
+		}
+
+		if !transient {
+			org.Status.Error = err.Error()
+		}
+	} else {
+		org.Status.Error = ""
+	}
+
+	if observed != nil {
+		org.Status.OrgID = observed.ID
+		org.Status.Name = observed.Name
+		org.Status.Type = observed.Type
+	}
+
+	meta.SetStatusCondition(&org.Status.Conditions, ready)
+
+	if updateErr := r.Status().Patch(ctx, org, statusPatch(ctx, org)); updateErr != nil {
+		logger.Error(updateErr, "failed to update status")
+	}
+
+	return err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PixoOrganizationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.PixoOrganization{}).
+		Watches(
+			&platformv1.PixoServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(r.findOrgForServiceAccount),
+			builder.WithPredicates(orgRefChangedPredicate),
+		).
+		Complete(r)
+}
+
+// orgRefChangedPredicate passes service account updates that can change
+// which organizations are referenced: an orgRef change, or the start of a
+// deletion. Both the old and the new organization are enqueued.
+var orgRefChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldServiceAccount, ok := e.ObjectOld.(*platformv1.PixoServiceAccount)
+		if !ok {
+			return true
+		}
+		newServiceAccount, ok := e.ObjectNew.(*platformv1.PixoServiceAccount)
+		if !ok {
+			return true
+		}
+
+		oldKey, oldOK := oldServiceAccount.OrgRefKey()
+		newKey, newOK := newServiceAccount.OrgRefKey()
+		return oldKey != newKey || oldOK != newOK ||
+			!oldServiceAccount.GetDeletionTimestamp().Equal(newServiceAccount.GetDeletionTimestamp())
+	},
+}
+
+func (r *PixoOrganizationReconciler) findOrgForServiceAccount(ctx context.Context, serviceAccount client.Object) []reconcile.Request {
+	key, ok := serviceAccount.(*platformv1.PixoServiceAccount).OrgRefKey()
+	if !ok {
+		return []reconcile.Request{}
+	}
+
+	return []reconcile.Request{{NamespacedName: key}}
+}
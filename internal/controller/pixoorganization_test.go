@@ -0,0 +1,196 @@
+package controller_test
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("PixoOrganization", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoOrganizationReconciler
+		platformClient *fake.Client
+		org            *platformv1.PixoOrganization
+		req            ctrl.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoOrganizationReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		org = CreateTestOrganization(ctx, Namespace)
+		req = ctrl.Request{NamespacedName: runtime.ObjectKeyFromObject(org)}
+	})
+
+	It("can create the platform org and record its id", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).To(Succeed())
+		Expect(org.Status.OrgID).NotTo(BeZero())
+		Expect(org.Status.Adopted).To(BeFalse())
+		Expect(platformClient.Orgs()).To(ContainElement(HaveField("Name", org.Name)))
+		Expect(meta.IsStatusConditionTrue(org.Status.Conditions, platformv1.ConditionReady)).To(BeTrue())
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateOrg")).To(Equal(1))
+	})
+
+	It("can adopt an existing org with the same name", func() {
+		existing := platformClient.AddOrg(platform.Org{Name: org.Name})
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateOrg")).To(BeZero())
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).To(Succeed())
+		Expect(org.Status.OrgID).To(Equal(existing.ID))
+		Expect(org.Status.Adopted).To(BeTrue())
+	})
+
+	It("can push a renamed org to the platform", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).To(Succeed())
+		org.Spec.DisplayName = "Renamed Org"
+		Expect(reconciler.Update(ctx, org)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).To(Succeed())
+		Expect(org.Status.Name).To(Equal("Renamed Org"))
+		Expect(platformClient.Orgs()).To(ContainElement(HaveField("Name", "Renamed Org")))
+		Expect(platformClient.Calls("CreateOrg")).To(Equal(1))
+	})
+
+	It("can block deletion while a service account references it", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		serviceAccount := NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		serviceAccount.Spec.OrgRef = org.Name
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		Expect(reconciler.Delete(ctx, org)).To(Succeed())
+
+		result, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).To(Succeed())
+		ready := meta.FindStatusCondition(org.Status.Conditions, platformv1.ConditionReady)
+		Expect(ready.Reason).To(Equal(platformv1.ReasonInUse))
+		Expect(ready.Message).To(ContainSubstring(serviceAccount.Name))
+
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).NotTo(Succeed())
+		Expect(platformClient.Orgs()).To(ContainElement(HaveField("Name", org.Name)))
+	})
+
+	It("can delete the platform org when the deletion policy asks for it", func() {
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).To(Succeed())
+		org.Spec.DeletionPolicy = platformv1.OrgDeletionPolicyDelete
+		Expect(reconciler.Update(ctx, org)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Delete(ctx, org)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Orgs()).NotTo(ContainElement(HaveField("Name", org.Name)))
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).NotTo(Succeed())
+	})
+
+	It("can release an organization when the platform client can't manage orgs", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		reconciler.PlatformClient = struct{ graphql.PlatformClient }{platformClient}
+		Expect(reconciler.Delete(ctx, org)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, org)).NotTo(Succeed())
+	})
+
+	Context("when a service account references the organization", func() {
+
+		var (
+			serviceAccountReconciler controller.PixoServiceAccountReconciler
+			serviceAccount           *platformv1.PixoServiceAccount
+			serviceAccountReq        ctrl.Request
+		)
+
+		BeforeEach(func() {
+			serviceAccountReconciler = controller.PixoServiceAccountReconciler{
+				Client:         k8sClient,
+				PlatformClient: platformClient,
+			}
+			serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+			serviceAccount.Spec.OrgID = 0
+			serviceAccount.Spec.OrgRef = Namespace + "/" + org.Name
+			Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+			serviceAccountReq = NewRequest(serviceAccount)
+		})
+
+		It("can wait for the organization before creating the user", func() {
+			result, err := serviceAccountReconciler.Reconcile(ctx, serviceAccountReq)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+			Expect(platformClient.Calls("CreateUser")).To(BeZero())
+			Expect(serviceAccountReconciler.Get(ctx, serviceAccountReq.NamespacedName, serviceAccount)).To(Succeed())
+			Expect(serviceAccount.Status.Error).To(BeEmpty())
+			ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonOrgNotReady)
+		})
+
+		It("can create the user in the referenced org", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reconciler.Get(ctx, req.NamespacedName, org)).To(Succeed())
+
+			_, err = serviceAccountReconciler.Reconcile(ctx, serviceAccountReq)
+
+			Expect(err).NotTo(HaveOccurred())
+			user, ok := platformClient.User(serviceAccount.Name)
+			Expect(ok).To(BeTrue())
+			Expect(user.OrgID).To(Equal(org.Status.OrgID))
+			Expect(serviceAccountReconciler.Get(ctx, serviceAccountReq.NamespacedName, serviceAccount)).To(Succeed())
+			Expect(serviceAccount.Status.OrgID).To(Equal(org.Status.OrgID))
+		})
+
+	})
+
+})
+
+func CreateTestOrganization(ctx context.Context, namespace string) *platformv1.PixoOrganization {
+	org := &platformv1.PixoOrganization{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      strings.ToLower(faker.Username()),
+			Namespace: namespace,
+		},
+	}
+	Expect(k8sClient.Create(ctx, org)).To(Succeed())
+	return org
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// PixoPlatformConnectionReconciler reconciles a PixoPlatformConnection object
+type PixoPlatformConnectionReconciler struct {
+	client.Client
+	Scheme      *runtime.Scheme
+	Connections *platformclient.Pool
+}
+
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoplatformconnections,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoplatformconnections/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+// Reconcile builds the connection's client into the pool and checks that the
+// platform accepts its credentials. Deleted connections are dropped from the
+// pool.
+func (r *PixoPlatformConnectionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withRequestLogger(ctx, req)
+
+	connection := &platformv1.PixoPlatformConnection{}
+	if err := r.Get(ctx, req.NamespacedName, connection); err != nil {
+		if errors.IsNotFound(err) {
+			log.FromContext(ctx).V(1).Info("platform connection not found")
+			r.Connections.Remove(req.NamespacedName.String())
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+	ctx = withStatusBase(ctx, connection)
+
+	platformClient, _, err := connectionClient(ctx, r.Client, r.Connections, req.NamespacedName, req.Namespace)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, connection, "failed to build platform client", nil, err))
+	}
+
+	if _, err = platformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{}); err != nil {
+		return result(r.handleStatusUpdate(ctx, connection, "platform rejected the connection", platformClient, err))
+	}
+
+	return result(r.handleStatusUpdate(ctx, connection, "", platformClient, nil))
+}
+
+func (r *PixoPlatformConnectionReconciler) handleStatusUpdate(ctx context.Context, connection *platformv1.PixoPlatformConnection, msg string, platformClient graphql.PlatformClient, err error) error {
+	logger := log.FromContext(ctx)
+	if err != nil {
+		logger.Error(err, msg)
+	}
+
+	ready := metav1.Condition{
+		Type:               platformv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             platformv1.ReasonReconciled,
+		Message:            "platform accepts the connection's credentials",
+		ObservedGeneration: connection.Generation,
+	}
+
+	if err != nil {
+		reason, transient := conditionReason(err)
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reason
+		ready.Message = err.Error()
+		if msg != "" {
+			ready.Message = msg + ": " + err.Error()
+		}
+
+		if !transient {
+			connection.Status.Error = err.Error()
+		}
+	} else {
+		connection.Status.Error = ""
+	}
+
+	if platformClient != nil {
+		connection.Status.URL = platformClient.GetURL()
+	}
+
+	meta.SetStatusCondition(&connection.Status.Conditions, ready)
+
+	if updateErr := r.Status().Patch(ctx, connection, statusPatch(ctx, connection)); updateErr != nil {
+		logger.Error(updateErr, "failed to update status")
+	}
+
+	return err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PixoPlatformConnectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.PixoPlatformConnection{}).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.findConnectionsForSecret),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+func (r *PixoPlatformConnectionReconciler) findConnectionsForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	connections := &platformv1.PixoPlatformConnectionList{}
+	if err := r.List(ctx, connections, client.InNamespace(secret.GetNamespace())); err != nil {
+		return []reconcile.Request{}
+	}
+
+	var requests []reconcile.Request
+	for _, item := range connections.Items {
+		if item.Spec.CredentialsSecretRef.Name == secret.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,168 @@
+package controller_test
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("PixoPlatformConnection", func() {
+
+	var (
+		ctx              context.Context
+		operatorClient   *fake.Client
+		connectionClient *fake.Client
+		connections      *platformclient.Pool
+		connection       *platformv1.PixoPlatformConnection
+		built            []platformclient.ConnectionConfig
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		operatorClient = fake.New()
+		connectionClient = fake.New()
+		built = nil
+		connections = platformclient.NewPool(func(config platformclient.ConnectionConfig) (graphql.PlatformClient, error) {
+			built = append(built, config)
+			return connectionClient, nil
+		}, platformclient.Options{})
+
+		name := "stage-" + strings.ToLower(faker.Username())
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-credentials", Namespace: Namespace},
+			StringData: map[string]string{platformclient.CredentialsAPIKeyFile: "stage-key\n"},
+		})).To(Succeed())
+		connection = &platformv1.PixoPlatformConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+			Spec: platformv1.PixoPlatformConnectionSpec{
+				Lifecycle:            "stage",
+				Region:               "saudi",
+				CredentialsSecretRef: corev1.LocalObjectReference{Name: name + "-credentials"},
+			},
+		}
+	})
+
+	reconcileServiceAccount := func(serviceAccount *platformv1.PixoServiceAccount) ctrl.Result {
+		reconciler := controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: operatorClient,
+			Connections:    connections,
+		}
+		res, err := reconciler.Reconcile(ctx, NewRequest(serviceAccount))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+		return res
+	}
+
+	It("should report the connection ready with its URL", func() {
+		Expect(k8sClient.Create(ctx, connection)).To(Succeed())
+		reconciler := controller.PixoPlatformConnectionReconciler{Client: k8sClient, Connections: connections}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: runtime.ObjectKeyFromObject(connection)})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(connection), connection)).To(Succeed())
+		Expect(connection.Status.URL).To(Equal(fake.URL))
+		Expect(meta.IsStatusConditionTrue(connection.Status.Conditions, platformv1.ConditionReady)).To(BeTrue())
+		Expect(built).To(ConsistOf(platformclient.ConnectionConfig{
+			Lifecycle:   "stage",
+			Region:      "saudi",
+			Credentials: platformclient.Credentials{APIKey: "stage-key"},
+		}))
+	})
+
+	It("should manage an account's user on the connection it references", func() {
+		Expect(k8sClient.Create(ctx, connection)).To(Succeed())
+		serviceAccount := NewTestServiceAccount(Namespace, connection.Name+"-account", "admin")
+		serviceAccount.Spec.ConnectionRef = connection.Name
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		reconcileServiceAccount(serviceAccount)
+
+		_, onConnection := connectionClient.User(serviceAccount.Name)
+		_, onOperator := operatorClient.User(serviceAccount.Name)
+		Expect(onConnection).To(BeTrue())
+		Expect(onOperator).To(BeFalse())
+		ExpectReadyCondition(serviceAccount, metav1.ConditionTrue, platformv1.ReasonReconciled)
+	})
+
+	It("should store and inject the endpoints of the account's connection", func() {
+		Expect(k8sClient.Create(ctx, connection)).To(Succeed())
+		serviceAccount := NewTestServiceAccount(Namespace, connection.Name+"-endpoints", "admin")
+		serviceAccount.Spec.ConnectionRef = connection.Name
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name, serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		reconcileServiceAccount(serviceAccount)
+
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(string(secret.Data["lifecycle"])).To(Equal("stage"))
+		Expect(string(secret.Data["region"])).To(Equal("saudi"))
+		Expect(string(secret.Data["api-url"])).To(Equal("https://saudi.api.apex.stage.pixovr.com"))
+		Expect(string(secret.Data["graphql-url"])).To(Equal("https://saudi.apex.stage.pixovr.com/v2/query"))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(And(
+			HaveField("Name", "PIXO_REGION"),
+			HaveField("ValueFrom.SecretKeyRef.Key", "region"),
+		)))
+	})
+
+	It("should only let accounts in namespaces the connection selects use it", func() {
+		Expect(k8sClient.Create(ctx, connection)).To(Succeed())
+		tenant := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "tenant-" + strings.ToLower(faker.Username()),
+			Labels: map[string]string{"platform.pixovr.com/stage": "true"},
+		}}
+		Expect(k8sClient.Create(ctx, tenant)).To(Succeed())
+		serviceAccount := NewTestServiceAccount(tenant.Name, connection.Name+"-tenant", "admin")
+		serviceAccount.Spec.ConnectionRef = Namespace + "/" + connection.Name
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		reconcileServiceAccount(serviceAccount)
+
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonConnectionNotReady)
+		Expect(connectionClient.Calls("CreateUser")).To(BeZero())
+
+		connection.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: tenant.Labels}
+		Expect(k8sClient.Update(ctx, connection)).To(Succeed())
+		reconcileServiceAccount(serviceAccount)
+
+		_, onConnection := connectionClient.User(serviceAccount.Name)
+		Expect(onConnection).To(BeTrue())
+		ExpectReadyCondition(serviceAccount, metav1.ConditionTrue, platformv1.ReasonReconciled)
+	})
+
+	It("should reject an account with both a connectionRef and an orgRef", func() {
+		serviceAccount := NewTestServiceAccount(Namespace, connection.Name+"-org", "admin")
+		serviceAccount.Spec.ConnectionRef = connection.Name
+		serviceAccount.Spec.OrgRef = "some-org"
+
+		Expect(k8sClient.Create(ctx, serviceAccount)).NotTo(Succeed())
+	})
+
+	It("should wait for a connection that doesn't exist", func() {
+		serviceAccount := NewTestServiceAccount(Namespace, connection.Name+"-waiting", "admin")
+		serviceAccount.Spec.ConnectionRef = connection.Name
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		res := reconcileServiceAccount(serviceAccount)
+
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonConnectionNotReady)
+		Expect(operatorClient.Calls("CreateUser")).To(BeZero())
+	})
+
+})
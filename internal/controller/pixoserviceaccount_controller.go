@@ -22,9 +22,13 @@ import (
 	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"time"
 )
 
 var (
@@ -40,39 +44,113 @@ type PixoServiceAccountReconciler struct {
 	client.Client
 	Scheme         *runtime.Scheme
 	PlatformClient graphql.PlatformClient
+	Recorder       record.EventRecorder
+
+	// Lifecycle, Region and Internal are those of PlatformClient. The
+	// endpoints they resolve to are stored in auth Secrets and injected into
+	// workloads.
+	Lifecycle string
+	Region    string
+	Internal  bool
+
+	// Connections holds the clients of the PixoPlatformConnections accounts
+	// reference. Accounts without a connectionRef use PlatformClient.
+	Connections *platformclient.Pool
+
+	// DryRun plans every reconcile instead of acting on it, as if each
+	// object had the dry-run annotation.
+	DryRun bool
 }
 
 //+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoserviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoserviceaccounts/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoserviceaccounts/finalizers,verbs=update
-//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoorganizations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoplatformconnections,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *PixoServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withRequestLogger(ctx, req)
 
 	serviceAccount := &platformv1.PixoServiceAccount{}
 	if err := r.Get(ctx, req.NamespacedName, serviceAccount); err != nil {
 		if errors.IsNotFound(err) {
-			serviceAccount.Log("service account not found", nil)
+			log.FromContext(ctx).V(1).Info("service account not found")
 			return ctrl.Result{}, nil
 		}
 
 		return ctrl.Result{}, err
 	}
 
+	reconciler, err := r.forConnection(ctx, serviceAccount)
+	if err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to resolve platform connection", 0, nil, err))
+	}
+
+	if isDryRun(r.DryRun, serviceAccount) {
+		return reconciler.dryRun(ctx, serviceAccount)
+	}
+
+	if err := clearPlan(ctx, r.Client, serviceAccount, &serviceAccount.Status.Plan, &serviceAccount.Status.Conditions); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return reconciler.reconcile(ctx, serviceAccount)
+}
+
+// dryRun runs the reconcile of the account against clients that only record what
+// it would change, and publishes the result.
+func (r *PixoServiceAccountReconciler) dryRun(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount) (ctrl.Result, error) {
+	p := &plan{}
+	planner := *r
+	planner.Client = &planClient{Client: r.Client, plan: p}
+	planner.PlatformClient = platformclient.NewPlanningClient(r.PlatformClient, p.add)
+
+	_, err := planner.reconcile(withPlan(ctx, p), serviceAccount.DeepCopy())
+	if recordErr := recordPlan(ctx, r.Client, r.Recorder, serviceAccount, &serviceAccount.Status.Plan, &serviceAccount.Status.Conditions, p, err); recordErr != nil {
+		return ctrl.Result{}, recordErr
+	}
+
+	return result(err)
+}
+
+func (r *PixoServiceAccountReconciler) reconcile(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount) (ctrl.Result, error) {
+	if serviceAccount.IsSuspended() {
+		return result(r.suspend(ctx, serviceAccount))
+	}
+
+	if err := r.resume(ctx, serviceAccount); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if serviceAccount.GetDeletionTimestamp() != nil {
+		if err := r.guardDeletion(ctx, serviceAccount); err != nil {
+			return result(r.HandleStatusUpdate(ctx, serviceAccount, "waiting to delete service account", 0, nil, err))
+		}
 
 		if err := r.cleanup(ctx, serviceAccount); err != nil {
-			return ctrl.Result{}, err
+			return result(err)
 		}
 
 		if err := r.removeFinalizer(ctx, serviceAccount); err != nil {
-			return ctrl.Result{}, err
+			return result(err)
 		}
 
-		return ctrl.Result{}, r.HandleStatusUpdate(ctx, serviceAccount, "deleted user and api key", 0, nil, nil)
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "deleted user and api key", 0, nil, nil))
+	}
+
+	if expiresAt, ok := serviceAccount.ExpiresAt(); ok && !time.Now().Before(expiresAt) {
+		return result(r.expire(ctx, serviceAccount, expiresAt))
+	}
+
+	requeueAfter, err := r.trackExpiry(ctx, serviceAccount, time.Now())
+	if err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to track expiry", 0, nil, err))
 	}
 
 	if err := r.addFinalizer(ctx, serviceAccount); err != nil {
@@ -80,42 +158,104 @@ func (r *PixoServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.R
 	}
 
 	var msg string
-	var user *platform.User
-	var err error
-	var password string
 
-	if user, err = r.PlatformClient.GetUserByUsername(ctx, req.Name); err == nil {
-		if err = r.HandleUpdate(ctx, serviceAccount, user); err != nil {
-			return ctrl.Result{}, err
-		}
+	orgID, err := r.resolveOrgID(ctx, serviceAccount)
+	if err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to resolve org", 0, nil, err))
+	}
 
-		secret, err := r.getSecret(ctx, serviceAccount)
-		if err == nil {
-			password = string(secret.Data["password"])
+	user, exists, err := r.lookupUser(ctx, serviceAccount.Name)
+	if err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to look up pixo user account", 0, nil, err))
+	}
+
+	secret, err := r.getAuthSecret(ctx, serviceAccount)
+	if err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to get auth secret", 0, nil, err))
+	}
+
+	credentials := authCredentials{}
+	if secret != nil {
+		credentials = readAuthCredentials(secret)
+	}
+
+	if err = checkAdoption(serviceAccount, user, exists); err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to adopt pixo user account", 0, nil, err))
+	}
+
+	if exists {
+		if serviceAccount.Status.CreationPhase == platformv1.CreationPending {
+			// an earlier reconcile created the user with the password in the
+			// Secret but stopped before recording it
+			if err = r.recordUser(ctx, serviceAccount, user); err != nil {
+				return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to record pixo user account", 0, user, err))
+			}
 		}
 
+		if err = r.HandleUpdate(ctx, serviceAccount, user, orgID); err != nil {
+			return result(err)
+		}
 	} else {
-		if user, err = r.createUser(ctx, serviceAccount); err != nil {
-			return ctrl.Result{}, r.HandleStatusUpdate(ctx, serviceAccount, "failed to create pixo user account", 0, user, err)
+		if user, credentials, err = r.createUser(ctx, serviceAccount, orgID, credentials, secret); err != nil {
+			return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to create pixo user account", 0, nil, err))
 		}
-		password = user.Password
 		msg = "successfully created user"
 	}
 
-	if exists := r.authSecretExists(ctx, serviceAccount); !exists {
-		if err = r.createAPIKey(ctx, serviceAccount, user, password); err != nil {
-			return ctrl.Result{}, err
+	if !serviceAccount.IsEnabled() {
+		if err = r.disable(ctx, serviceAccount, user); err != nil {
+			return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to disable user", 0, user, err))
+		}
+
+		if err = r.HandleStatusUpdate(ctx, serviceAccount, "user is disabled", 0, user, nil); err != nil {
+			return result(err)
 		}
+
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	if err = r.enable(ctx, serviceAccount, user); err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to enable user", 0, user, err))
+	}
+
+	if serviceAccount.Status.AccessRevoked {
+		// the credentials left in the Secret were revoked while suspended or
+		// disabled
+		credentials.APIKey, credentials.APIKeyID, credentials.Password = "", 0, ""
+	}
+
+	if credentials, err = r.adoptAPIKey(ctx, serviceAccount, user, credentials); err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to adopt api key", 0, user, err))
+	}
+
+	if err = r.ensureCredentials(ctx, serviceAccount, user, credentials, secret); err != nil {
+		return result(err)
+	}
+
+	if err = r.restoreAccess(ctx, serviceAccount); err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to update status", 0, user, err))
+	}
+
+	if err = r.syncSinks(ctx, serviceAccount); err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to push credentials to secret sinks", 0, user, err))
 	}
 
 	if err = r.addEnvVarsToDeployments(ctx, serviceAccount); err != nil {
-		return ctrl.Result{}, r.HandleStatusUpdate(ctx, serviceAccount, "failed to list deployments", 0, user, err)
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to list deployments", 0, user, err))
+	}
+
+	if err = r.pruneAuthSecrets(ctx, serviceAccount); err != nil {
+		return result(r.HandleStatusUpdate(ctx, serviceAccount, "failed to delete previous auth secret", 0, user, err))
+	}
+
+	if err = r.HandleStatusUpdate(ctx, serviceAccount, msg, 0, user, nil); err != nil {
+		return result(err)
 	}
 
-	return ctrl.Result{}, r.HandleStatusUpdate(ctx, serviceAccount, msg, 0, user, err)
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func (r *PixoServiceAccountReconciler) HandleUpdate(ctx context.Context, pixoServiceAccount *platformv1.PixoServiceAccount, user *platform.User) error {
+func (r *PixoServiceAccountReconciler) HandleUpdate(ctx context.Context, pixoServiceAccount *platformv1.PixoServiceAccount, user *platform.User, orgID int) error {
 	var shouldUpdate bool
 
 	if pixoServiceAccount.Spec.FirstName != user.FirstName {
@@ -133,9 +273,9 @@ func (r *PixoServiceAccountReconciler) HandleUpdate(ctx context.Context, pixoSer
 		user.Role = pixoServiceAccount.Spec.Role
 	}
 
-	if pixoServiceAccount.Spec.OrgID != user.OrgID {
+	if orgID != user.OrgID {
 		shouldUpdate = true
-		user.OrgID = pixoServiceAccount.Spec.OrgID
+		user.OrgID = orgID
 	}
 
 	if shouldUpdate {
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	graphql_api "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
 	"github.com/go-faker/faker/v4"
+	hasura "github.com/hasura/go-graphql-client"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	platformv1 "pixovr.com/platform/api/v1"
 	"pixovr.com/platform/internal/controller"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -23,12 +26,12 @@ var _ = Describe("Pixoserviceaccount", func() {
 	var (
 		ctx            context.Context
 		reconciler     controller.PixoServiceAccountReconciler
-		platformClient *graphql_api.MockGraphQLClient
+		platformClient *mockPlatformClient
 	)
 
 	BeforeEach(func() {
 		ctx = context.Background()
-		platformClient = &graphql_api.MockGraphQLClient{}
+		platformClient = &mockPlatformClient{MockGraphQLClient: &graphql_api.MockGraphQLClient{}}
 		reconciler = controller.PixoServiceAccountReconciler{
 			Client:         k8sClient,
 			PlatformClient: platformClient,
@@ -63,7 +66,7 @@ var _ = Describe("Pixoserviceaccount", func() {
 		})
 
 		It("can update the status if user doesnt exist and there is an error creating the user", func() {
-			platformClient.GetUserError = true
+			platformClient.UserNotFound = true
 			platformClient.CreateUserError = true
 
 			result, err := reconciler.Reconcile(ctx, req)
@@ -76,11 +79,25 @@ var _ = Describe("Pixoserviceaccount", func() {
 			Expect(serviceAccount.Status.Error).To(Equal("error creating user"))
 		})
 
-		It("can create a user if the service account is found", func() {
+		It("should not create a user if looking up the existing user fails", func() {
 			platformClient.GetUserError = true
 
 			result, err := reconciler.Reconcile(ctx, req)
 
+			Expect(result).To(Equal(ctrl.Result{}))
+			Expect(err).To(HaveOccurred())
+			Expect(platformClient.CalledGetUser).To(BeTrue())
+			Expect(platformClient.CalledCreateUser).To(BeFalse())
+			Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+			Expect(serviceAccount.Status.Error).To(Equal("error getting user"))
+			ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonReconcileError)
+		})
+
+		It("can create a user if the service account is found", func() {
+			platformClient.UserNotFound = true
+
+			result, err := reconciler.Reconcile(ctx, req)
+
 			Expect(result).To(Equal(ctrl.Result{}))
 			Expect(err).NotTo(HaveOccurred())
 			Expect(platformClient.CalledCreateUser).To(BeTrue())
@@ -106,6 +123,31 @@ var _ = Describe("Pixoserviceaccount", func() {
 			Expect(serviceAccount.Status.Error).To(Equal(""))
 		})
 
+		It("should make the service account the owner of its auth secret", func() {
+			platformClient.UserNotFound = true
+
+			_, err := reconciler.Reconcile(ctx, req)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+			secret := serviceAccount.GenerateAuthSecretSpec()
+			Expect(reconciler.Get(ctx, runtime.ObjectKeyFromObject(secret), secret)).To(Succeed())
+			Expect(metav1.IsControlledBy(secret, serviceAccount)).To(BeTrue())
+		})
+
+		It("should adopt an auth secret that has no owner", func() {
+			secret := CreateTestSecret(ctx, serviceAccount)
+			Expect(secret.OwnerReferences).To(BeEmpty())
+
+			_, err := reconciler.Reconcile(ctx, req)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+			Expect(reconciler.Get(ctx, runtime.ObjectKeyFromObject(secret), secret)).To(Succeed())
+			Expect(metav1.IsControlledBy(secret, serviceAccount)).To(BeTrue())
+			Expect(string(secret.Data["password"])).To(Equal("test-password"))
+		})
+
 		It("can update a user if the service account is found", func() {
 			_ = CreateTestSecret(ctx, serviceAccount)
 			result, err := reconciler.Reconcile(ctx, req)
@@ -132,7 +174,7 @@ var _ = Describe("Pixoserviceaccount", func() {
 		})
 
 		It("can delete a user and api key if the service account is deleted", func() {
-			platformClient.GetUserError = true
+			platformClient.UserNotFound = true
 			result, err := reconciler.Reconcile(ctx, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(Equal(ctrl.Result{}))
@@ -152,7 +194,7 @@ var _ = Describe("Pixoserviceaccount", func() {
 		})
 
 		It("can do nothing but update the status if the service account is deleted but the api key delete fails", func() {
-			platformClient.GetUserError = true
+			platformClient.UserNotFound = true
 			result, err := reconciler.Reconcile(ctx, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(Equal(ctrl.Result{}))
@@ -171,7 +213,7 @@ var _ = Describe("Pixoserviceaccount", func() {
 		})
 
 		It("can do nothing but update the status if the service account is deleted but the user delete fails", func() {
-			platformClient.GetUserError = true
+			platformClient.UserNotFound = true
 			result, err := reconciler.Reconcile(ctx, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(Equal(ctrl.Result{}))
@@ -189,7 +231,7 @@ var _ = Describe("Pixoserviceaccount", func() {
 		})
 
 		It("should add environment variables if the correct annotation is present", func() {
-			platformClient.GetUserError = true
+			platformClient.UserNotFound = true
 			result, err := reconciler.Reconcile(ctx, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(Equal(ctrl.Result{}))
@@ -229,7 +271,7 @@ var _ = Describe("Pixoserviceaccount", func() {
 		})
 
 		It("should create an api key for a service account that exists but has no api key", func() {
-			platformClient.GetUserError = true
+			platformClient.UserNotFound = true
 			result, err := reconciler.Reconcile(ctx, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(Equal(ctrl.Result{}))
@@ -238,7 +280,7 @@ var _ = Describe("Pixoserviceaccount", func() {
 			secretSpec := serviceAccount.GenerateAuthSecretSpec()
 			Expect(k8sClient.Delete(ctx, secretSpec)).To(Succeed())
 
-			platformClient.GetUserError = false
+			platformClient.UserNotFound = false
 			platformClient.CalledCreateUser = false
 			platformClient.CalledCreateAPIKey = false
 			result, err = reconciler.Reconcile(ctx, req)
@@ -255,15 +297,36 @@ var _ = Describe("Pixoserviceaccount", func() {
 
 })
 
+// mockPlatformClient extends the upstream mock, which can only fail user
+// lookups with an unclassified error, with the not-found answer the platform
+// gives for a missing user.
+type mockPlatformClient struct {
+	*graphql_api.MockGraphQLClient
+	UserNotFound bool
+}
+
+func (m *mockPlatformClient) GetUserByUsername(ctx context.Context, username string) (*platform.User, error) {
+	if m.UserNotFound {
+		m.CalledGetUser = true
+		return nil, hasura.Errors{{Message: "user not found", Path: []interface{}{"user"}}}
+	}
+
+	return m.MockGraphQLClient.GetUserByUsername(ctx, username)
+}
+
 func ExpectEnvVarsToExist(deployment v1.Deployment, serviceAccount *platformv1.PixoServiceAccount) {
 	Expect(deployment.Spec.Template.Spec.Containers).To(HaveLen(1))
-	Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(HaveLen(3))
+	Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(HaveLen(7))
 	Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
 		Name:  "PIXO_USERNAME",
 		Value: serviceAccount.ObjectMeta.Name,
 	}))
 	ExpectEnvVarsToContain(deployment, "PIXO_PASSWORD")
 	ExpectEnvVarsToContain(deployment, "PIXO_API_KEY")
+	ExpectEnvVarsToContain(deployment, "PIXO_API_URL")
+	ExpectEnvVarsToContain(deployment, "PIXO_GRAPHQL_URL")
+	ExpectEnvVarsToContain(deployment, "PIXO_LIFECYCLE")
+	ExpectEnvVarsToContain(deployment, "PIXO_REGION")
 }
 
 func ExpectEnvVarsToContain(deployment v1.Deployment, key string) {
@@ -285,6 +348,22 @@ func ExpectStatusToEqualSpec(serviceAccount *platformv1.PixoServiceAccount) {
 	Expect(serviceAccount.Status.APIKeyID).NotTo(BeZero())
 }
 
+// ReceivedEvents drains the events recorded so far and returns the ones with
+// the given reason.
+func ReceivedEvents(recorder *record.FakeRecorder, reason string) []string {
+	var received []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.Contains(event, " "+reason+" ") {
+				received = append(received, event)
+			}
+		default:
+			return received
+		}
+	}
+}
+
 func NewRequest(serviceAccount *platformv1.PixoServiceAccount) ctrl.Request {
 	return ctrl.Request{
 		NamespacedName: types.NamespacedName{
@@ -0,0 +1,325 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"slices"
+	"text/template"
+)
+
+// PixoServiceAccountTemplateReconciler reconciles a PixoServiceAccountTemplate object
+type PixoServiceAccountTemplateReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// DryRun plans every reconcile instead of acting on it, as if each
+	// object had the dry-run annotation.
+	DryRun bool
+}
+
+// namespaceTemplateData is what the fields of a service account template
+// are rendered with.
+type namespaceTemplateData struct {
+	Namespace string
+	Labels    map[string]string
+}
+
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoserviceaccounttemplates,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoserviceaccounttemplates/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=platform.pixovr.com,resources=pixoserviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// Reconcile creates the template's PixoServiceAccount in every namespace the
+// selector matches, updates the ones that drifted from the template and
+// deletes the ones in namespaces that stopped matching. The accounts are
+// owned by the template, so deleting it deletes them.
+func (r *PixoServiceAccountTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withRequestLogger(ctx, req)
+
+	accountTemplate := &platformv1.PixoServiceAccountTemplate{}
+	if err := r.Get(ctx, req.NamespacedName, accountTemplate); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.FromContext(ctx).V(1).Info("service account template not found")
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+	ctx = withStatusBase(ctx, accountTemplate)
+
+	if isDryRun(r.DryRun, accountTemplate) {
+		return r.dryRun(ctx, accountTemplate)
+	}
+
+	if err := clearPlan(ctx, r.Client, accountTemplate, &accountTemplate.Status.Plan, &accountTemplate.Status.Conditions); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return r.reconcile(ctx, accountTemplate)
+}
+
+// dryRun runs the reconcile of the template against a client that only
+// records what it would change, and publishes the result.
+func (r *PixoServiceAccountTemplateReconciler) dryRun(ctx context.Context, accountTemplate *platformv1.PixoServiceAccountTemplate) (ctrl.Result, error) {
+	p := &plan{}
+	planner := *r
+	planner.Client = &planClient{Client: r.Client, plan: p}
+
+	_, err := planner.reconcile(withPlan(ctx, p), accountTemplate.DeepCopy())
+	if recordErr := recordPlan(ctx, r.Client, r.Recorder, accountTemplate, &accountTemplate.Status.Plan, &accountTemplate.Status.Conditions, p, err); recordErr != nil {
+		return ctrl.Result{}, recordErr
+	}
+
+	return result(err)
+}
+
+func (r *PixoServiceAccountTemplateReconciler) reconcile(ctx context.Context, accountTemplate *platformv1.PixoServiceAccountTemplate) (ctrl.Result, error) {
+	if accountTemplate.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	namespaces, err := r.matchingNamespaces(ctx, accountTemplate)
+	if err != nil {
+		return result(r.handleStatusUpdate(ctx, accountTemplate, "failed to find matching namespaces", err))
+	}
+
+	var managed []string
+	var errs []error
+	for _, namespace := range namespaces {
+		key, err := r.stamp(ctx, accountTemplate, &namespace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", namespace.Name, err))
+			continue
+		}
+		managed = append(managed, key)
+	}
+	slices.Sort(managed)
+
+	if err = r.prune(ctx, accountTemplate, managed); err != nil {
+		errs = append(errs, err)
+	}
+
+	accountTemplate.Status.ServiceAccounts = managed
+	if err = errors.Join(errs...); err != nil {
+		return result(r.handleStatusUpdate(ctx, accountTemplate, "failed to sync service accounts", err))
+	}
+
+	return result(r.handleStatusUpdate(ctx, accountTemplate, "", nil))
+}
+
+// matchingNamespaces returns the namespaces the template's selector matches,
+// except the ones being deleted.
+func (r *PixoServiceAccountTemplateReconciler) matchingNamespaces(ctx context.Context, accountTemplate *platformv1.PixoServiceAccountTemplate) ([]corev1.Namespace, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&accountTemplate.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespaceSelector: %w", err)
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err = r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	var matched []corev1.Namespace
+	for _, namespace := range namespaces.Items {
+		if namespace.DeletionTimestamp == nil {
+			matched = append(matched, namespace)
+		}
+	}
+
+	return matched, nil
+}
+
+// stamp creates or updates the template's account in namespace and returns
+// it as "namespace/name". An account of that name the template doesn't own
+// is left alone.
+func (r *PixoServiceAccountTemplateReconciler) stamp(ctx context.Context, accountTemplate *platformv1.PixoServiceAccountTemplate, namespace *corev1.Namespace) (string, error) {
+	data := namespaceTemplateData{Namespace: namespace.Name, Labels: namespace.Labels}
+	spec := accountTemplate.Spec.Template.Spec.DeepCopy()
+
+	name, err := renderField("name", accountTemplate.Spec.Template.Name, data)
+	if err != nil {
+		return "", err
+	}
+	if spec.FirstName, err = renderField("firstName", spec.FirstName, data); err != nil {
+		return "", err
+	}
+	if spec.LastName, err = renderField("lastName", spec.LastName, data); err != nil {
+		return "", err
+	}
+
+	serviceAccount := &platformv1.PixoServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace.Name}}
+	if err = r.Get(ctx, client.ObjectKeyFromObject(serviceAccount), serviceAccount); err == nil && !metav1.IsControlledBy(serviceAccount, accountTemplate) {
+		return "", fmt.Errorf("service account %s already exists and is not managed by the template", name)
+	} else if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	operation, err := controllerutil.CreateOrUpdate(ctx, r.Client, serviceAccount, func() error {
+		if serviceAccount.Labels == nil {
+			serviceAccount.Labels = map[string]string{}
+		}
+		for key, value := range accountTemplate.Spec.Template.Labels {
+			serviceAccount.Labels[key] = value
+		}
+		serviceAccount.Labels[platformv1.LabelServiceAccountTemplate] = accountTemplate.Name
+
+		if len(accountTemplate.Spec.Template.Annotations) > 0 && serviceAccount.Annotations == nil {
+			serviceAccount.Annotations = map[string]string{}
+		}
+		for key, value := range accountTemplate.Spec.Template.Annotations {
+			serviceAccount.Annotations[key] = value
+		}
+
+		serviceAccount.Spec = *spec
+		return controllerutil.SetControllerReference(accountTemplate, serviceAccount, r.Scheme)
+	})
+	if err != nil {
+		return "", err
+	}
+	if operation != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("synced service account from template", "serviceAccount", client.ObjectKeyFromObject(serviceAccount), "operation", operation)
+	}
+
+	return client.ObjectKeyFromObject(serviceAccount).String(), nil
+}
+
+// prune deletes the accounts the template created that it no longer
+// manages, because their namespace stopped matching or their name changed.
+func (r *PixoServiceAccountTemplateReconciler) prune(ctx context.Context, accountTemplate *platformv1.PixoServiceAccountTemplate, managed []string) error {
+	serviceAccounts := &platformv1.PixoServiceAccountList{}
+	if err := r.List(ctx, serviceAccounts, client.MatchingLabels{platformv1.LabelServiceAccountTemplate: accountTemplate.Name}); err != nil {
+		return err
+	}
+
+	for i := range serviceAccounts.Items {
+		serviceAccount := &serviceAccounts.Items[i]
+		key := client.ObjectKeyFromObject(serviceAccount).String()
+		if slices.Contains(managed, key) || !metav1.IsControlledBy(serviceAccount, accountTemplate) || serviceAccount.DeletionTimestamp != nil {
+			continue
+		}
+
+		if err := r.Delete(ctx, serviceAccount); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("deleted service account no longer matched by template", "serviceAccount", key)
+	}
+
+	return nil
+}
+
+// renderField renders a field of the template for a namespace.
+func renderField(field, text string, data namespaceTemplateData) (string, error) {
+	tmpl, err := template.New(field).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template for %s: %w", field, err)
+	}
+
+	var rendered bytes.Buffer
+	if err = tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", field, err)
+	}
+
+	return rendered.String(), nil
+}
+
+func (r *PixoServiceAccountTemplateReconciler) handleStatusUpdate(ctx context.Context, accountTemplate *platformv1.PixoServiceAccountTemplate, msg string, err error) error {
+	logger := log.FromContext(ctx)
+
+	ready := metav1.Condition{
+		Type:               platformv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             platformv1.ReasonReconciled,
+		Message:            fmt.Sprintf("service accounts are in sync in %d namespaces", len(accountTemplate.Status.ServiceAccounts)),
+		ObservedGeneration: accountTemplate.Generation,
+	}
+
+	if err != nil {
+		reason, transient := conditionReason(err)
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reason
+		ready.Message = err.Error()
+		if msg != "" {
+			ready.Message = fmt.Sprintf("%s: %v", msg, err)
+		}
+
+		if transient {
+			logger.Info(ready.Message)
+		} else {
+			logger.Error(err, msg)
+			accountTemplate.Status.Error = err.Error()
+		}
+	} else {
+		accountTemplate.Status.Error = ""
+	}
+
+	meta.SetStatusCondition(&accountTemplate.Status.Conditions, ready)
+
+	if updateErr := r.Status().Patch(ctx, accountTemplate, statusPatch(ctx, accountTemplate)); updateErr != nil {
+		logger.Error(updateErr, "failed to update status")
+	}
+
+	return err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PixoServiceAccountTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.PixoServiceAccountTemplate{}).
+		Owns(&platformv1.PixoServiceAccount{}).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.findTemplatesForNamespace),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+// findTemplatesForNamespace enqueues every template, since a namespace
+// whose labels changed may start or stop matching any of them.
+func (r *PixoServiceAccountTemplateReconciler) findTemplatesForNamespace(ctx context.Context, _ client.Object) []reconcile.Request {
+	templates := &platformv1.PixoServiceAccountTemplateList{}
+	if err := r.List(ctx, templates); err != nil {
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, len(templates.Items))
+	for i, item := range templates.Items {
+		requests[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)}
+	}
+	return requests
+}
@@ -0,0 +1,136 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccountTemplate", func() {
+
+	var (
+		ctx             context.Context
+		reconciler      controller.PixoServiceAccountTemplateReconciler
+		tenant          string
+		accountTemplate *platformv1.PixoServiceAccountTemplate
+	)
+
+	namespace := func(labels map[string]string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "tenant-" + strings.ToLower(faker.Username()),
+			Labels: labels,
+		}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		return ns
+	}
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: runtime.ObjectKeyFromObject(accountTemplate)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(accountTemplate), accountTemplate)).To(Succeed())
+	}
+
+	stamped := func(ns *corev1.Namespace) (*platformv1.PixoServiceAccount, error) {
+		serviceAccount := &platformv1.PixoServiceAccount{}
+		err := k8sClient.Get(ctx, runtime.ObjectKey{Namespace: ns.Name, Name: ns.Name + "-ci"}, serviceAccount)
+		return serviceAccount, err
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		reconciler = controller.PixoServiceAccountTemplateReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		tenant = strings.ToLower(faker.Username())
+
+		accountTemplate = &platformv1.PixoServiceAccountTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci-" + tenant},
+			Spec: platformv1.PixoServiceAccountTemplateSpec{
+				NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": tenant}},
+				Template: platformv1.ServiceAccountTemplate{
+					Name:   "{{ .Namespace }}-ci",
+					Labels: map[string]string{"team": "platform"},
+					Spec: platformv1.PixoServiceAccountSpec{
+						FirstName: `{{ index .Labels "team" }}`,
+						LastName:  "CI",
+						OrgID:     1,
+						Role:      "admin",
+					},
+				},
+			},
+		}
+	})
+
+	It("should stamp out an account in each matching namespace", func() {
+		matching := namespace(map[string]string{"tenant": tenant, "team": "analytics"})
+		other := namespace(map[string]string{"tenant": "other"})
+		Expect(k8sClient.Create(ctx, accountTemplate)).To(Succeed())
+
+		reconcile()
+
+		serviceAccount, err := stamped(matching)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(serviceAccount.Spec.FirstName).To(Equal("analytics"))
+		Expect(serviceAccount.Spec.LastName).To(Equal("CI"))
+		Expect(serviceAccount.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(serviceAccount.Labels).To(HaveKeyWithValue(platformv1.LabelServiceAccountTemplate, accountTemplate.Name))
+		Expect(metav1.IsControlledBy(serviceAccount, accountTemplate)).To(BeTrue())
+		_, err = stamped(other)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(accountTemplate.Status.ServiceAccounts).To(Equal([]string{matching.Name + "/" + matching.Name + "-ci"}))
+		Expect(meta.IsStatusConditionTrue(accountTemplate.Status.Conditions, platformv1.ConditionReady)).To(BeTrue())
+	})
+
+	It("should keep the accounts in sync with the template", func() {
+		ns := namespace(map[string]string{"tenant": tenant})
+		Expect(k8sClient.Create(ctx, accountTemplate)).To(Succeed())
+		reconcile()
+
+		accountTemplate.Spec.Template.Spec.Role = "developer"
+		Expect(k8sClient.Update(ctx, accountTemplate)).To(Succeed())
+		reconcile()
+
+		serviceAccount, err := stamped(ns)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(serviceAccount.Spec.Role).To(Equal("developer"))
+	})
+
+	It("should remove the account from a namespace that stops matching", func() {
+		ns := namespace(map[string]string{"tenant": tenant})
+		Expect(k8sClient.Create(ctx, accountTemplate)).To(Succeed())
+		reconcile()
+
+		ns.Labels = map[string]string{"tenant": "other"}
+		Expect(k8sClient.Update(ctx, ns)).To(Succeed())
+		reconcile()
+
+		_, err := stamped(ns)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(accountTemplate.Status.ServiceAccounts).To(BeEmpty())
+	})
+
+	It("should not take over an account it didn't create", func() {
+		ns := namespace(map[string]string{"tenant": tenant})
+		existing := NewTestServiceAccount(ns.Name, ns.Name+"-ci", "admin")
+		Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+		Expect(k8sClient.Create(ctx, accountTemplate)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: runtime.ObjectKeyFromObject(accountTemplate)})
+
+		Expect(err).To(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(accountTemplate), accountTemplate)).To(Succeed())
+		Expect(accountTemplate.Status.Error).To(ContainSubstring("not managed by the template"))
+		serviceAccount, err := stamped(ns)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(serviceAccount.Labels).NotTo(HaveKey(platformv1.LabelServiceAccountTemplate))
+	})
+
+})
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"time"
+)
+
+// platformErrorHandling maps each class of platform error to the Ready
+// condition reason it is reported under and how long to wait before the
+// account is reconciled again. Errors that won't clear on their own, like
+// rejected operator credentials, are also recorded in status.error. Classes
+// not listed here are treated as ordinary reconcile errors and left to the
+// controller's rate limiter.
+var platformErrorHandling = map[platformclient.ErrorClass]struct {
+	reason       string
+	requeueAfter time.Duration
+	transient    bool
+}{
+	platformclient.ClassRetryable: {platformv1.ReasonPlatformUnavailable, 30 * time.Second, true},
+	platformclient.ClassAuth:      {platformv1.ReasonPlatformAuth, 15 * time.Minute, false},
+	platformclient.ClassConflict:  {platformv1.ReasonPlatformConflict, 5 * time.Second, true},
+	platformclient.ClassNotFound:  {platformv1.ReasonPlatformNotFound, time.Minute, true},
+}
+
+// conditionReason returns the Ready reason for err and whether err is a
+// transient platform error, or a wait on another object, that should stay out
+// of status.error.
+func conditionReason(err error) (string, bool) {
+	if notReady, ok := asNotReady(err); ok {
+		return notReady.reason, true
+	}
+
+	if handling, ok := platformErrorHandling[platformclient.Classify(err)]; ok {
+		return handling.reason, handling.transient
+	}
+
+	return platformv1.ReasonReconcileError, false
+}
+
+// result turns the outcome of a reconcile into the value returned to
+// controller-runtime. Classified platform errors are requeued after a fixed
+// delay (or the circuit breaker's hint) instead of being returned, so an
+// outage doesn't multiply into exponential retries from every account. Waits
+// on other objects are requeued the same way.
+func result(err error) (ctrl.Result, error) {
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+
+	if _, ok := asNotReady(err); ok {
+		return ctrl.Result{RequeueAfter: dependencyRequeueAfter}, nil
+	}
+
+	handling, ok := platformErrorHandling[platformclient.Classify(err)]
+	if !ok {
+		return ctrl.Result{}, err
+	}
+
+	if retryAfter, ok := platformclient.RetryAfter(err); ok {
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	}
+
+	return ctrl.Result{RequeueAfter: handling.requeueAfter}, nil
+}
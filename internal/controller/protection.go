@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "pixovr.com/platform/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slices"
+	"strings"
+)
+
+// guardDeletion keeps the user and credentials of an account that is being
+// deleted while Deployments still use it, since their next pods would fail
+// without them. The Deployments are listed in status and in the returned
+// error, and the force-delete annotation lets the deletion through anyway.
+func (r *PixoServiceAccountReconciler) guardDeletion(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	var blocking []string
+	if serviceAccount.Annotations[v1.AnnotationForceDelete] != "true" {
+		deployments, err := r.consumingDeployments(ctx, serviceAccount)
+		if err != nil {
+			return err
+		}
+
+		for _, deployment := range deployments {
+			if deployment.DeletionTimestamp == nil {
+				blocking = append(blocking, deployment.Name)
+			}
+		}
+	}
+
+	if !slices.Equal(blocking, serviceAccount.Status.BlockingWorkloads) {
+		patch := client.MergeFrom(serviceAccount.DeepCopy())
+		serviceAccount.Status.BlockingWorkloads = blocking
+		if err := r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+			return err
+		}
+
+		if len(blocking) > 0 {
+			r.event(ctx, serviceAccount, corev1.EventTypeWarning, v1.ReasonInUse,
+				fmt.Sprintf("deletion waits for deployments that still use the account: %s; set %s to \"true\" to delete it anyway",
+					strings.Join(blocking, ", "), v1.AnnotationForceDelete))
+		}
+	}
+
+	if len(blocking) == 0 {
+		return nil
+	}
+
+	return newNotReadyError(v1.ReasonInUse, "deletion waits for deployments that still use the account: %s", strings.Join(blocking, ", "))
+}
+
+// consumingDeployments returns the Deployments in the account's namespace
+// that get its credentials, through the operator's injection or because
+// their pods reference its auth Secret.
+func (r *PixoServiceAccountReconciler) consumingDeployments(ctx context.Context, serviceAccount *v1.PixoServiceAccount) ([]appsv1.Deployment, error) {
+	deployments := appsv1.DeploymentList{}
+	if err := r.List(ctx, &deployments, client.InNamespace(serviceAccount.Namespace)); err != nil {
+		return nil, err
+	}
+
+	bound, err := boundKubernetesServiceAccounts(ctx, r.Client, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	secretNames := []string{serviceAccount.AuthSecretName()}
+	if serviceAccount.Status.SecretName != "" {
+		secretNames = append(secretNames, serviceAccount.Status.SecretName)
+	}
+
+	var consuming []appsv1.Deployment
+	for _, deployment := range deployments.Items {
+		if consumesServiceAccount(&deployment, serviceAccount, bound) || referencesSecret(&deployment.Spec.Template.Spec, secretNames) {
+			consuming = append(consuming, deployment)
+		}
+	}
+
+	return consuming, nil
+}
+
+// referencesSecret reports whether pods with spec read one of the Secrets
+// through a volume or an environment variable.
+func referencesSecret(spec *corev1.PodSpec, secretNames []string) bool {
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil && slices.Contains(secretNames, volume.Secret.SecretName) {
+			return true
+		}
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.Secret != nil && slices.Contains(secretNames, source.Secret.Name) {
+				return true
+			}
+		}
+	}
+
+	for _, container := range slices.Concat(spec.InitContainers, spec.Containers) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil && slices.Contains(secretNames, envFrom.SecretRef.Name) {
+				return true
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && slices.Contains(secretNames, env.ValueFrom.SecretKeyRef.Name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
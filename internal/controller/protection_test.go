@@ -0,0 +1,112 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount deletion protection", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		recorder       *record.FakeRecorder
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	reconcile := func() ctrl.Result {
+		res, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		return res
+	}
+
+	deleted := func() bool {
+		err := k8sClient.Get(ctx, req.NamespacedName, serviceAccount)
+		return errors.IsNotFound(err)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		recorder = record.NewFakeRecorder(20)
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+			Recorder:       recorder,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, "protected-"+strings.ToLower(faker.Username()), "admin")
+		req = NewRequest(serviceAccount)
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+	})
+
+	It("should wait to delete an account while deployments use it", func() {
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name, serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+
+		res := reconcile()
+
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(deleted()).To(BeFalse())
+		Expect(serviceAccount.Status.BlockingWorkloads).To(Equal([]string{deployment.Name}))
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonInUse)
+		_, exists := platformClient.User(serviceAccount.Name)
+		Expect(exists).To(BeTrue())
+		Expect(ReceivedEvents(recorder, platformv1.ReasonInUse)).To(ConsistOf(ContainSubstring(deployment.Name)))
+
+		Expect(k8sClient.Delete(ctx, deployment)).To(Succeed())
+		reconcile()
+
+		Expect(deleted()).To(BeTrue())
+		_, exists = platformClient.User(serviceAccount.Name)
+		Expect(exists).To(BeFalse())
+	})
+
+	It("should count deployments that reference the auth secret", func() {
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name+"-secret-ref", "")
+		deployment.Annotations = nil
+		deployment.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{{
+			Name: "PIXO_API_KEY",
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: serviceAccount.AuthSecretName()},
+				Key:                  "api-key",
+			}},
+		}}
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+
+		reconcile()
+
+		Expect(deleted()).To(BeFalse())
+		Expect(serviceAccount.Status.BlockingWorkloads).To(Equal([]string{deployment.Name}))
+	})
+
+	It("should delete an account in use with the force-delete annotation", func() {
+		Expect(k8sClient.Create(ctx, NewTestDeployment(Namespace, serviceAccount.Name+"-forced", serviceAccount.Name))).To(Succeed())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		serviceAccount.Annotations = map[string]string{platformv1.AnnotationForceDelete: "true"}
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+
+		reconcile()
+
+		Expect(deleted()).To(BeTrue())
+		_, exists := platformClient.User(serviceAccount.Name)
+		Expect(exists).To(BeFalse())
+	})
+
+})
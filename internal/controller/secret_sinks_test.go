@@ -0,0 +1,142 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	"pixovr.com/platform/internal/secretsink/sinktest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount secret sinks", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		vault          *sinktest.Store
+		store          *sinktest.Store
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		vault = sinktest.NewVault("vault-token")
+		DeferCleanup(vault.Close)
+		store = sinktest.NewHTTP("http-token")
+		DeferCleanup(store.Close)
+
+		tokens := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(faker.Username()) + "-sink-tokens", Namespace: Namespace},
+			StringData: map[string]string{"vault": "vault-token", "http": "http-token"},
+		}
+		Expect(k8sClient.Create(ctx, tokens)).To(Succeed())
+
+		serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		serviceAccount.Spec.Sinks = []platformv1.SecretSink{
+			{
+				Name: "vault",
+				Vault: &platformv1.VaultSink{
+					Address: vault.URL,
+					Path:    "ci/" + serviceAccount.Name,
+					TokenSecretRef: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: tokens.Name},
+						Key:                  "vault",
+					},
+				},
+			},
+			{
+				Name: "uploader",
+				HTTP: &platformv1.HTTPSink{
+					URL: store.URL + "/credentials/" + serviceAccount.Name,
+					TokenSecretRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: tokens.Name},
+						Key:                  "http",
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		req = NewRequest(serviceAccount)
+	})
+
+	It("can push the credentials to every sink and propagate rotations and revocations", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		apiKey, ok := platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		ExpectSinksToHold(vault, store, serviceAccount, apiKey.Key)
+		Expect(serviceAccount.Status.Sinks).To(HaveLen(2))
+		for _, status := range serviceAccount.Status.Sinks {
+			Expect(status.Error).To(BeEmpty())
+			Expect(status.APIKeyID).To(Equal(apiKey.ID))
+			Expect(status.LastSyncedAt).NotTo(BeNil())
+		}
+
+		Expect(k8sClient.Delete(ctx, GetAuthSecret(ctx, serviceAccount))).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.APIKeyID).NotTo(Equal(apiKey.ID))
+		rotated, ok := platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		ExpectSinksToHold(vault, store, serviceAccount, rotated.Key)
+
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		_, ok = vault.Get("ci/" + serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+		_, ok = store.Get("/credentials/" + serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("can report a failing sink and retry it without pushing to the others again", func() {
+		store.Fail(1)
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).To(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.Sinks).To(ContainElement(And(HaveField("Name", "uploader"), HaveField("Error", ContainSubstring("503")))))
+		Expect(serviceAccount.Status.Sinks).To(ContainElement(And(HaveField("Name", "vault"), HaveField("Error", BeEmpty()))))
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonReconcileError)
+		vault.Fail(1)
+
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.Sinks).To(HaveEach(HaveField("Error", BeEmpty())))
+		apiKey, _ := platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		ExpectSinksToHold(vault, store, serviceAccount, apiKey.Key)
+	})
+
+})
+
+func ExpectSinksToHold(vault, store *sinktest.Store, serviceAccount *platformv1.PixoServiceAccount, key string) {
+	document, ok := vault.Get("ci/" + serviceAccount.Name)
+	Expect(ok).To(BeTrue())
+	Expect(document).To(HaveKeyWithValue("apiKey", key))
+	Expect(document).To(HaveKeyWithValue("username", serviceAccount.Name))
+	document, ok = store.Get("/credentials/" + serviceAccount.Name)
+	Expect(ok).To(BeTrue())
+	Expect(document).To(HaveKeyWithValue("apiKey", key))
+}
@@ -0,0 +1,216 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount secret template", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	helmTemplate := func() *platformv1.SecretTemplate {
+		return &platformv1.SecretTemplate{
+			Name:        serviceAccount.Name + "-credentials",
+			Keys:        platformv1.SecretKeys{APIKey: "apiKey"},
+			Labels:      map[string]string{"app.kubernetes.io/part-of": "pixo"},
+			Annotations: map[string]string{"reflector.v1.k8s.emberstack.com/reflection-allowed": "true"},
+			Data: map[string]string{
+				".env":        "PIXO_USERNAME={{ .Username }}\nPIXO_API_KEY={{ .APIKey }}\n",
+				"config.json": `{"url": {{ toJson .PlatformURL }}, "userId": {{ .UserID }}}`,
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		req = NewRequest(serviceAccount)
+	})
+
+	It("can write the credentials in the templated layout", func() {
+		serviceAccount.Spec.SecretTemplate = helmTemplate()
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.SecretName).To(Equal(serviceAccount.Name + "-credentials"))
+		apiKey, ok := platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(secret.Data).NotTo(HaveKey("api-key"))
+		Expect(string(secret.Data["apiKey"])).To(Equal(apiKey.Key))
+		Expect(string(secret.Data["username"])).To(Equal(serviceAccount.Name))
+		Expect(secret.Labels).To(HaveKeyWithValue("app.kubernetes.io/part-of", "pixo"))
+		Expect(secret.Labels).To(HaveKeyWithValue("platform.pixovr.com/service-account-name", serviceAccount.Name))
+		Expect(secret.Annotations).To(HaveKeyWithValue("reflector.v1.k8s.emberstack.com/reflection-allowed", "true"))
+		Expect(string(secret.Data[".env"])).To(ContainSubstring("PIXO_API_KEY=" + apiKey.Key))
+
+		config := map[string]interface{}{}
+		Expect(json.Unmarshal(secret.Data["config.json"], &config)).To(Succeed())
+		Expect(config).To(HaveKeyWithValue("url", fake.URL))
+		Expect(config).To(HaveKeyWithValue("userId", BeNumerically("==", serviceAccount.Status.ID)))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKey{Name: serviceAccount.DefaultAuthSecretName(), Namespace: Namespace}, &corev1.Secret{})).NotTo(Succeed())
+	})
+
+	It("can move the credentials when the template renames the secret and its keys", func() {
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		original := GetAuthSecret(ctx, serviceAccount)
+		deployment := NewTestDeployment(Namespace, "templated-deployment", serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		serviceAccount.Spec.SecretTemplate = helmTemplate()
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.SecretName).To(Equal(serviceAccount.Name + "-credentials"))
+		moved := GetAuthSecret(ctx, serviceAccount)
+		Expect(moved.Data["apiKey"]).To(Equal(original.Data["api-key"]))
+		Expect(moved.Data["password"]).To(Equal(original.Data["password"]))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(original), &corev1.Secret{})).NotTo(Succeed())
+
+		var updatedDeployment v1.Deployment
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), &updatedDeployment)).To(Succeed())
+		Expect(updatedDeployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(HaveField("ValueFrom.SecretKeyRef", And(
+			HaveField("Name", moved.Name),
+			HaveField("Key", "apiKey"),
+		))))
+
+		serviceAccount.Spec.SecretTemplate.Keys.APIKey = "PIXO_API_KEY"
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		rekeyed := GetAuthSecret(ctx, serviceAccount)
+		Expect(rekeyed.Data).NotTo(HaveKey("apiKey"))
+		Expect(rekeyed.Data["PIXO_API_KEY"]).To(Equal(original.Data["api-key"]))
+	})
+
+	It("can keep the previous secret while a deployment still references it", func() {
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		original := GetAuthSecret(ctx, serviceAccount)
+		deployment := NewTestDeployment(Namespace, "pinned-deployment", serviceAccount.Name)
+		delete(deployment.Annotations, controller.AnnotationKey)
+		deployment.Spec.Template.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: original.Name}},
+		}}
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		serviceAccount.Spec.SecretTemplate = helmTemplate()
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.SecretName).To(Equal(serviceAccount.Name + "-credentials"))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(original), &corev1.Secret{})).To(Succeed())
+
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+		deployment.Spec.Template.Spec.Containers[0].EnvFrom[0].SecretRef.Name = serviceAccount.AuthSecretName()
+		Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(original), &corev1.Secret{})).NotTo(Succeed())
+	})
+
+	It("can keep the labels and annotations other tools add to the secret", func() {
+		serviceAccount.Spec.SecretTemplate = helmTemplate()
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		secret := GetAuthSecret(ctx, serviceAccount)
+		secret.Labels["backup.example.com/policy"] = "daily"
+		secret.Annotations["reflector.v1.k8s.emberstack.com/reflected-version"] = "42"
+		Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+		serviceAccount.Spec.SecretTemplate.Labels = map[string]string{"app.kubernetes.io/name": "worker"}
+		serviceAccount.Spec.SecretTemplate.Annotations = nil
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		secret = GetAuthSecret(ctx, serviceAccount)
+		Expect(secret.Labels).To(HaveKeyWithValue("backup.example.com/policy", "daily"))
+		Expect(secret.Labels).To(HaveKeyWithValue("app.kubernetes.io/name", "worker"))
+		Expect(secret.Labels).NotTo(HaveKey("app.kubernetes.io/part-of"))
+		Expect(secret.Annotations).To(HaveKeyWithValue("reflector.v1.k8s.emberstack.com/reflected-version", "42"))
+		Expect(secret.Annotations).NotTo(HaveKey("reflector.v1.k8s.emberstack.com/reflection-allowed"))
+	})
+
+	It("can delete a previous secret written before auth secrets had an owner", func() {
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		original := GetAuthSecret(ctx, serviceAccount)
+		original.OwnerReferences = nil
+		Expect(k8sClient.Update(ctx, original)).To(Succeed())
+
+		serviceAccount.Spec.SecretTemplate = helmTemplate()
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.SecretName).To(Equal(serviceAccount.Name + "-credentials"))
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(original), &corev1.Secret{})).NotTo(Succeed())
+	})
+
+	It("can report a template that doesn't render", func() {
+		serviceAccount.Spec.SecretTemplate = &platformv1.SecretTemplate{
+			Data: map[string]string{"config.json": "{{ .Missing }}"},
+		}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).To(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Status.Error).To(ContainSubstring("config.json"))
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonReconcileError)
+	})
+
+})
+
+func GetAuthSecret(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount) *corev1.Secret {
+	secret := &corev1.Secret{}
+	Expect(k8sClient.Get(ctx, runtime.ObjectKey{Name: serviceAccount.AuthSecretName(), Namespace: serviceAccount.Namespace}, secret)).To(Succeed())
+	return secret
+}
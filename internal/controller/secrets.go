@@ -1,67 +1,514 @@
 package controller
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
 	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"slices"
+	"strconv"
+	"text/template"
 )
 
-func (r *PixoServiceAccountReconciler) getSecret(ctx context.Context, serviceAccount *v1.PixoServiceAccount) (*corev1.Secret, error) {
-	secret := &corev1.Secret{}
-	err := r.Get(ctx, types.NamespacedName{Name: serviceAccount.AuthSecretName(), Namespace: serviceAccount.Namespace}, secret)
-	return secret, err
+// secretKeysAnnotation records the keys an auth Secret was written with, so
+// its credentials can still be read after spec.secretTemplate.keys changes.
+const secretKeysAnnotation = "platform.pixovr.com/secret-keys"
+
+// templateMetadataAnnotation records the labels and annotations an auth
+// Secret got from its secret template, so the ones the template drops can be
+// removed without touching those other tools added.
+const templateMetadataAnnotation = "platform.pixovr.com/template-metadata"
+
+// templateMetadata is the value of templateMetadataAnnotation.
+type templateMetadata struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// authCredentials are the values kept in the auth Secret. They are also the
+// data the extra keys of a secret template are rendered with.
+type authCredentials struct {
+	Username    string
+	Password    string
+	APIKey      string
+	UserID      int
+	APIKeyID    int
+	PlatformURL string
+	APIURL      string
+	GraphQLURL  string
+	Lifecycle   string
+	Region      string
+}
+
+var secretTemplateFuncs = template.FuncMap{
+	"toJson": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// getAuthSecret returns the auth Secret the account currently uses, or nil if
+// it has none. It looks at the name recorded in status first, so a renamed
+// Secret is still found until its credentials have been moved, then at the
+// templated name and finally at the default name used before secret
+// templates existed.
+func (r *PixoServiceAccountReconciler) getAuthSecret(ctx context.Context, serviceAccount *v1.PixoServiceAccount) (*corev1.Secret, error) {
+	names := []string{serviceAccount.Status.SecretName, serviceAccount.AuthSecretName(), serviceAccount.DefaultAuthSecretName()}
+	for i, name := range names {
+		if name == "" || containsString(names[:i], name) {
+			continue
+		}
+
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: serviceAccount.Namespace}, secret)
+		if err == nil {
+			return secret, nil
+		}
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// readAuthCredentials reads the credentials from an auth Secret using the keys
+// it was written with.
+func readAuthCredentials(secret *corev1.Secret) authCredentials {
+	keys := v1.SecretKeys{}
+	if recorded, ok := secret.Annotations[secretKeysAnnotation]; ok {
+		_ = json.Unmarshal([]byte(recorded), &keys)
+	}
+	keys = keys.WithDefaults()
+
+	credentials := authCredentials{
+		Username: string(secret.Data[keys.Username]),
+		Password: string(secret.Data[keys.Password]),
+		APIKey:   string(secret.Data[keys.APIKey]),
+	}
+	credentials.UserID, _ = strconv.Atoi(secret.Labels["platform.pixovr.com/user-id"])
+	credentials.APIKeyID, _ = strconv.Atoi(secret.Labels["platform.pixovr.com/api-key-id"])
+
+	return credentials
+}
+
+// ensureCredentials issues the credentials the account asks for that the auth
+// Secret doesn't hold yet, revokes the API key if it no longer asks for one
+// and writes the Secret with the requested credentials only. A password that
+// isn't requested is dropped here, after it was only kept in the Secret while
+// the user was being created.
+func (r *PixoServiceAccountReconciler) ensureCredentials(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User, credentials authCredentials, previous *corev1.Secret) error {
+	if !serviceAccount.IssuesPassword() {
+		credentials.Password = ""
+	}
+
+	if serviceAccount.IssuesAPIKey() && credentials.APIKey == "" {
+		apiKey, err := r.mintAPIKey(ctx, serviceAccount, user)
+		if err != nil {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to create api key", 0, nil, err)
+		}
+
+		if err = r.HandleStatusUpdate(ctx, serviceAccount, "created api key", apiKey.ID, user, nil); err != nil {
+			return err
+		}
+		credentials.APIKey = apiKey.Key
+		credentials.APIKeyID = apiKey.ID
+	}
+
+	if !serviceAccount.IssuesAPIKey() {
+		if apiKeyID := max(credentials.APIKeyID, serviceAccount.Status.APIKeyID); apiKeyID != 0 {
+			if err := r.PlatformClient.DeleteAPIKey(ctx, apiKeyID); err != nil && !platformclient.IsNotFound(err) {
+				return r.HandleStatusUpdate(ctx, serviceAccount, "failed to revoke api key", 0, user, err)
+			}
+			serviceAccountLogger(ctx, serviceAccount).Info("revoked api key that is no longer requested", "apiKeyId", apiKeyID)
+		}
+		credentials.APIKey = ""
+		credentials.APIKeyID = 0
+
+		if serviceAccount.Status.APIKeyID != 0 {
+			patch := client.MergeFrom(serviceAccount.DeepCopy())
+			serviceAccount.Status.APIKeyID = 0
+			if err := r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+				return r.HandleStatusUpdate(ctx, serviceAccount, "failed to update status", 0, user, err)
+			}
+		}
+	}
+
+	if serviceAccount.IssuesPassword() && credentials.Password == "" {
+		// the password was discarded when it wasn't requested, or the Secret
+		// holding it was lost, so the user gets a new one
+		password := v1.GeneratePassword()
+		if _, err := r.PlatformClient.UpdateUser(ctx, platform.User{ID: user.ID, Password: password}); err != nil {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to reset password", 0, user, err)
+		}
+		credentials.Password = password
+	}
+
+	credentials.Username = user.Username
+	credentials.UserID = user.ID
+	if err := r.writeAuthSecret(ctx, serviceAccount, credentials, previous); err != nil {
+		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to write auth secret", 0, user, err)
+	}
+
+	if serviceAccount.Status.CreationPhase != v1.CreationComplete || serviceAccount.Status.APIKeyRequestedAt != nil {
+		patch := client.MergeFrom(serviceAccount.DeepCopy())
+		serviceAccount.Status.CreationPhase = v1.CreationComplete
+		serviceAccount.Status.APIKeyRequestedAt = nil
+		serviceAccount.Status.PriorAPIKeyIDs = nil
+		if err := r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to update status", 0, user, err)
+		}
+	}
+
+	return nil
+}
+
+// mintAPIKey issues an api key for the user. The attempt and the user's
+// existing keys are recorded in status first, so when an earlier attempt was
+// interrupted after the platform created its key, that key is returned
+// instead of minting another.
+func (r *PixoServiceAccountReconciler) mintAPIKey(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User) (*platform.APIKey, error) {
+	if serviceAccount.Status.APIKeyRequestedAt != nil {
+		apiKey, err := r.findRequestedAPIKey(ctx, serviceAccount, user)
+		if err != nil || apiKey != nil {
+			return apiKey, err
+		}
+	} else {
+		prior, err := apiKeyIDs(ctx, r.PlatformClient, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		patch := client.MergeFrom(serviceAccount.DeepCopy())
+		now := metav1.Now()
+		serviceAccount.Status.APIKeyRequestedAt = &now
+		serviceAccount.Status.PriorAPIKeyIDs = prior
+		if err = r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.PlatformClient.CreateAPIKey(ctx, platform.APIKey{UserID: user.ID})
+}
+
+// apiKeyIDs returns the IDs of the user's keys on the platform.
+func apiKeyIDs(ctx context.Context, platformClient graphql.PlatformClient, userID int) ([]int, error) {
+	keys, err := platformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &userID})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(keys))
+	for i, key := range keys {
+		ids[i] = key.ID
+	}
+	return ids, nil
+}
+
+// mintedAPIKey returns the newest of keys that is neither one of the prior
+// keys recorded before a mint nor claimed by anything else. The platform
+// doesn't report when a key was created, so this is how the key of an
+// interrupted mint is told apart.
+func mintedAPIKey(keys []*platform.APIKey, prior []int, claimed map[int]bool) *platform.APIKey {
+	var found *platform.APIKey
+	for _, key := range keys {
+		if slices.Contains(prior, key.ID) || claimed[key.ID] {
+			continue
+		}
+		if found == nil || key.ID > found.ID {
+			found = key
+		}
+	}
+	return found
+}
+
+// claimedAPIKeys returns the IDs of the user's keys that the account's
+// PixoAPIKeys and exchange ledger record, including keys a PixoAPIKey
+// issued but hasn't written to its Secret yet.
+func claimedAPIKeys(ctx context.Context, c client.Client, serviceAccount *v1.PixoServiceAccount) (map[int]bool, error) {
+	apiKeys := &v1.PixoAPIKeyList{}
+	if err := c.List(ctx, apiKeys, client.InNamespace(serviceAccount.Namespace)); err != nil {
+		return nil, err
+	}
+
+	claimed := map[int]bool{}
+	for _, apiKey := range apiKeys.Items {
+		if apiKey.Spec.ServiceAccountName == serviceAccount.Name {
+			claimed[apiKey.Status.APIKeyID] = true
+			claimed[apiKey.Status.PendingAPIKeyID] = true
+		}
+	}
+
+	ledger := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: serviceAccount.Namespace, Name: serviceAccount.ExchangeLedgerName()}, ledger); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	for id := range ledger.Data {
+		if apiKeyID, err := strconv.Atoi(id); err == nil {
+			claimed[apiKeyID] = true
+		}
+	}
+
+	return claimed, nil
+}
+
+// findRequestedAPIKey returns the key an interrupted mint created, leaving
+// out the keys PixoAPIKeys hold and the ones the token exchange issued.
+func (r *PixoServiceAccountReconciler) findRequestedAPIKey(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User) (*platform.APIKey, error) {
+	keys, err := r.PlatformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &user.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := claimedAPIKeys(ctx, r.Client, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	found := mintedAPIKey(keys, serviceAccount.Status.PriorAPIKeyIDs, claimed)
+	if found != nil {
+		serviceAccountLogger(ctx, serviceAccount).Info("recovered api key of an interrupted reconcile", "apiKeyId", found.ID)
+	}
+	return found, nil
 }
 
-func (r *PixoServiceAccountReconciler) createAPIKey(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User, password string) error {
-	apiKey, err := r.PlatformClient.CreateAPIKey(ctx, platform.APIKey{UserID: serviceAccount.Status.ID})
+// writeAuthSecret writes the credentials to the Secret described by the
+// account's secret template. When previous is a Secret with another name the
+// credentials are moved out of it: the new Secret is written and recorded in
+// status, and the old one is left for pruneAuthSecrets to delete once
+// nothing references it. An old Secret written before auth Secrets had an
+// owner is adopted first, as pruneAuthSecrets only deletes the account's own.
+func (r *PixoServiceAccountReconciler) writeAuthSecret(ctx context.Context, serviceAccount *v1.PixoServiceAccount, credentials authCredentials, previous *corev1.Secret) error {
+	if credentials.Username == "" {
+		credentials.Username = serviceAccount.Name
+	}
+	if credentials.UserID == 0 {
+		credentials.UserID = serviceAccount.Status.ID
+	}
+	if credentials.APIKeyID == 0 && credentials.APIKey != "" {
+		credentials.APIKeyID = serviceAccount.Status.APIKeyID
+	}
+	credentials.PlatformURL = r.PlatformClient.GetURL()
+	endpoints := platformclient.ResolveEndpoints(r.Lifecycle, r.Region, r.Internal)
+	credentials.APIURL = endpoints.APIURL
+	credentials.GraphQLURL = endpoints.GraphQLURL
+	credentials.Lifecycle = endpoints.Lifecycle
+	credentials.Region = endpoints.Region
+
+	data, err := renderAuthSecretData(serviceAccount, credentials)
 	if err != nil {
-		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to create api key", 0, nil, err)
+		return err
 	}
 
-	if err = r.HandleStatusUpdate(ctx, serviceAccount, "created api key", apiKey.ID, user, nil); err != nil {
+	keys, err := json.Marshal(serviceAccount.AuthSecretKeys())
+	if err != nil {
 		return err
 	}
 
 	secret := serviceAccount.GenerateAuthSecretSpec()
-	secret.Labels = map[string]string{
-		"platform.pixovr.com/service-account-name": serviceAccount.Name,
-		"platform.pixovr.com/api-key-id":           fmt.Sprint(apiKey.ID),
-		"platform.pixovr.com/user-id":              fmt.Sprint(user.ID),
-		"platform.pixovr.com/username":             user.Username,
-	}
-	secret.StringData = map[string]string{
-		"username": user.Username,
-		"password": password,
-		"api-key":  apiKey.Key,
-	}
-
-	if err = r.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
-		if errors.IsNotFound(err) {
-			if err = r.Create(ctx, secret); err != nil {
-				return r.HandleStatusUpdate(ctx, serviceAccount, "failed to create auth secret", 0, user, err)
+	if previous != nil && previous.Name != secret.Name && metav1.GetControllerOf(previous) == nil {
+		if err = r.adoptAuthSecret(ctx, serviceAccount, previous); err != nil {
+			return err
+		}
+	}
+
+	if _, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		// also adopts Secrets written before they had an owner, so garbage
+		// collection removes them if the finalizer never gets to
+		if err := controllerutil.SetControllerReference(serviceAccount, secret, r.Client.Scheme()); err != nil {
+			return err
+		}
+
+		if err := applyTemplateMetadata(secret, serviceAccount.Spec.SecretTemplate); err != nil {
+			return err
+		}
+
+		secret.Labels["platform.pixovr.com/service-account-name"] = serviceAccount.Name
+		if credentials.APIKeyID != 0 {
+			secret.Labels["platform.pixovr.com/api-key-id"] = fmt.Sprint(credentials.APIKeyID)
+		} else {
+			delete(secret.Labels, "platform.pixovr.com/api-key-id")
+		}
+		secret.Labels["platform.pixovr.com/user-id"] = fmt.Sprint(credentials.UserID)
+		secret.Labels["platform.pixovr.com/username"] = credentials.Username
+		secret.Annotations[secretKeysAnnotation] = string(keys)
+		secret.Data = data
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if serviceAccount.Status.SecretName != secret.Name {
+		patch := client.MergeFrom(serviceAccount.DeepCopy())
+		serviceAccount.Status.SecretName = secret.Name
+		if err = r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+			return err
+		}
+	}
+
+	if previous != nil && previous.Name != secret.Name {
+		serviceAccountLogger(ctx, serviceAccount).Info("moved auth secret", "from", previous.Name, "to", secret.Name)
+	}
+
+	return nil
+}
+
+// adoptAuthSecret makes the account the controller of an auth Secret that
+// has no owner and labels it as the account's, so pruneAuthSecrets finds it.
+func (r *PixoServiceAccountReconciler) adoptAuthSecret(ctx context.Context, serviceAccount *v1.PixoServiceAccount, secret *corev1.Secret) error {
+	patch := client.MergeFrom(secret.DeepCopy())
+	if err := controllerutil.SetControllerReference(serviceAccount, secret, r.Client.Scheme()); err != nil {
+		return err
+	}
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels["platform.pixovr.com/service-account-name"] = serviceAccount.Name
+
+	if err := r.Patch(ctx, secret, patch); err != nil {
+		return err
+	}
+	serviceAccountLogger(ctx, serviceAccount).Info("adopted previous auth secret", "secret", secret.Name)
+	return nil
+}
+
+// pruneAuthSecrets deletes the Secrets the account's credentials were moved
+// out of once no Deployment references them, so pods started before their
+// Deployment is moved over to the new Secret still find the old one.
+func (r *PixoServiceAccountReconciler) pruneAuthSecrets(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(serviceAccount.Namespace),
+		client.MatchingLabels{"platform.pixovr.com/service-account-name": serviceAccount.Name}); err != nil {
+		return err
+	}
+
+	var deployments *appsv1.DeploymentList
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		_, ledger := secret.Labels[v1.LabelExchangeLedger]
+		if secret.Name == serviceAccount.AuthSecretName() || ledger || !metav1.IsControlledBy(secret, serviceAccount) {
+			continue
+		}
+
+		if deployments == nil {
+			deployments = &appsv1.DeploymentList{}
+			if err := r.List(ctx, deployments, client.InNamespace(serviceAccount.Namespace)); err != nil {
+				return err
 			}
 		}
 
-		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to get auth secret", 0, user, err)
-	} else {
-		if err = r.Update(ctx, secret); err != nil {
-			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to update auth secret", 0, user, err)
+		var users []string
+		for _, deployment := range deployments.Items {
+			if referencesSecret(&deployment.Spec.Template.Spec, []string{secret.Name}) {
+				users = append(users, deployment.Name)
+			}
+		}
+		if len(users) > 0 {
+			serviceAccountLogger(ctx, serviceAccount).Info("keeping previous auth secret while deployments reference it",
+				"secret", secret.Name, "deployments", users)
+			continue
+		}
+
+		if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		serviceAccountLogger(ctx, serviceAccount).Info("deleted previous auth secret", "secret", secret.Name)
+	}
+
+	return nil
+}
+
+// applyTemplateMetadata replaces the labels and annotations the secret
+// template set on the Secret before with the ones it sets now.
+func applyTemplateMetadata(secret *corev1.Secret, secretTemplate *v1.SecretTemplate) error {
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+
+	previous := templateMetadata{}
+	if recorded, ok := secret.Annotations[templateMetadataAnnotation]; ok {
+		_ = json.Unmarshal([]byte(recorded), &previous)
+	}
+	for _, key := range previous.Labels {
+		delete(secret.Labels, key)
+	}
+	for _, key := range previous.Annotations {
+		delete(secret.Annotations, key)
+	}
+
+	current := templateMetadata{}
+	if secretTemplate != nil {
+		for key, value := range secretTemplate.Labels {
+			secret.Labels[key] = value
+			current.Labels = append(current.Labels, key)
+		}
+		for key, value := range secretTemplate.Annotations {
+			secret.Annotations[key] = value
+			current.Annotations = append(current.Annotations, key)
 		}
 	}
+	slices.Sort(current.Labels)
+	slices.Sort(current.Annotations)
 
-	return r.HandleStatusUpdate(ctx, serviceAccount, "created auth secret", apiKey.ID, user, nil)
+	recorded, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	secret.Annotations[templateMetadataAnnotation] = string(recorded)
+	return nil
 }
 
-func (r *PixoServiceAccountReconciler) authSecretExists(ctx context.Context, serviceAccount *v1.PixoServiceAccount) bool {
-	key := client.ObjectKeyFromObject(serviceAccount.GenerateAuthSecretSpec())
-	if err := r.Get(ctx, key, serviceAccount.GenerateAuthSecretSpec()); err != nil {
-		return false
+// renderAuthSecretData returns the data of the auth Secret: the credentials
+// under their configured keys, the platform endpoints they are valid for and
+// the rendered extra keys of the template.
+func renderAuthSecretData(serviceAccount *v1.PixoServiceAccount, credentials authCredentials) (map[string][]byte, error) {
+	keys := serviceAccount.AuthSecretKeys()
+
+	data := map[string][]byte{}
+	if serviceAccount.Spec.SecretTemplate != nil {
+		for key, text := range serviceAccount.Spec.SecretTemplate.Data {
+			tmpl, err := template.New(key).Funcs(secretTemplateFuncs).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template for secret key %q: %w", key, err)
+			}
+
+			var rendered bytes.Buffer
+			if err = tmpl.Execute(&rendered, credentials); err != nil {
+				return nil, fmt.Errorf("failed to render secret key %q: %w", key, err)
+			}
+			data[key] = rendered.Bytes()
+		}
+	}
+
+	values := map[string]string{
+		keys.Username: credentials.Username,
+		keys.Password: credentials.Password,
+		keys.APIKey:   credentials.APIKey,
+
+		v1.SecretKeyAPIURL:     credentials.APIURL,
+		v1.SecretKeyGraphQLURL: credentials.GraphQLURL,
+		v1.SecretKeyLifecycle:  credentials.Lifecycle,
+		v1.SecretKeyRegion:     credentials.Region,
+	}
+	for key, value := range values {
+		if value != "" {
+			data[key] = []byte(value)
+		}
 	}
 
-	return true
+	return data, nil
 }
@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	platformv1 "pixovr.com/platform/api/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -16,11 +17,27 @@ import (
 func (r *PixoServiceAccountReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&platformv1.PixoServiceAccount{}).
+		Owns(&corev1.Secret{}).
 		Watches(
 			&appsv1.Deployment{},
 			handler.EnqueueRequestsFromMapFunc(r.findObjectsForServiceAccount),
 			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
 		).
+		Watches(
+			&corev1.ServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForServiceAccount),
+			builder.WithPredicates(predicate.AnnotationChangedPredicate{}),
+		).
+		Watches(
+			&platformv1.PixoOrganization{},
+			handler.EnqueueRequestsFromMapFunc(r.findServiceAccountsForOrg),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Watches(
+			&platformv1.PixoPlatformConnection{},
+			handler.EnqueueRequestsFromMapFunc(r.findServiceAccountsForConnection),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
 		Complete(r)
 }
 
@@ -44,3 +61,29 @@ func (r *PixoServiceAccountReconciler) findObjectsForServiceAccount(ctx context.
 	}
 	return requests
 }
+
+func (r *PixoServiceAccountReconciler) findServiceAccountsForOrg(ctx context.Context, org client.Object) []reconcile.Request {
+	serviceAccounts, err := serviceAccountsReferencingOrg(ctx, r.Client, client.ObjectKeyFromObject(org))
+	if err != nil {
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, len(serviceAccounts))
+	for i, item := range serviceAccounts {
+		requests[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)}
+	}
+	return requests
+}
+
+func (r *PixoServiceAccountReconciler) findServiceAccountsForConnection(ctx context.Context, connection client.Object) []reconcile.Request {
+	serviceAccounts, err := serviceAccountsReferencingConnection(ctx, r.Client, client.ObjectKeyFromObject(connection))
+	if err != nil {
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, len(serviceAccounts))
+	for i, item := range serviceAccounts {
+		requests[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)}
+	}
+	return requests
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/secretsink"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// syncSinks pushes the credentials in the auth Secret to every sink that
+// hasn't received the current API key, failed its last push or changed since
+// then, and records the outcome of each sink in status.
+func (r *PixoServiceAccountReconciler) syncSinks(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	if len(serviceAccount.Spec.Sinks) == 0 && len(serviceAccount.Status.Sinks) == 0 {
+		return nil
+	}
+
+	secret, err := r.getAuthSecret(ctx, serviceAccount)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return fmt.Errorf("auth secret %s not found", serviceAccount.AuthSecretName())
+	}
+	credentials := readAuthCredentials(secret)
+
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	statuses := make([]v1.SecretSinkStatus, 0, len(serviceAccount.Spec.Sinks))
+	var errs []error
+	for _, sinkSpec := range serviceAccount.Spec.Sinks {
+		status := v1.SecretSinkStatus{Name: sinkSpec.Name}
+		for _, existing := range serviceAccount.Status.Sinks {
+			if existing.Name == sinkSpec.Name {
+				status = existing
+			}
+		}
+
+		upToDate := status.Error == "" && status.APIKeyID == credentials.APIKeyID && status.ObservedGeneration == serviceAccount.Generation
+		if !upToDate {
+			err := r.pushToSink(ctx, serviceAccount, sinkSpec, credentials)
+			status.ObservedGeneration = serviceAccount.Generation
+			if err != nil {
+				status.Error = err.Error()
+				errs = append(errs, fmt.Errorf("sink %s: %w", sinkSpec.Name, err))
+			} else {
+				now := metav1.Now()
+				status.Error = ""
+				status.APIKeyID = credentials.APIKeyID
+				status.LastSyncedAt = &now
+				serviceAccountLogger(ctx, serviceAccount).Info("pushed credentials to sink", "sink", sinkSpec.Name, "apiKeyId", credentials.APIKeyID)
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	serviceAccount.Status.Sinks = statuses
+	if err = r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+		return err
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *PixoServiceAccountReconciler) pushToSink(ctx context.Context, serviceAccount *v1.PixoServiceAccount, sinkSpec v1.SecretSink, credentials authCredentials) error {
+	if p := planFrom(ctx); p != nil {
+		p.add(fmt.Sprintf("push credentials to sink %s", sinkSpec.Name))
+		return nil
+	}
+
+	sink, err := r.buildSink(ctx, serviceAccount, sinkSpec)
+	if err != nil {
+		return err
+	}
+
+	return sink.Write(ctx, secretsink.Credentials{
+		Username:    credentials.Username,
+		APIKey:      credentials.APIKey,
+		APIKeyID:    credentials.APIKeyID,
+		UserID:      credentials.UserID,
+		PlatformURL: r.PlatformClient.GetURL(),
+	})
+}
+
+// clearSinks removes the credentials from every sink once the account's API
+// key is revoked.
+func (r *PixoServiceAccountReconciler) clearSinks(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	var errs []error
+	for _, sinkSpec := range serviceAccount.Spec.Sinks {
+		if p := planFrom(ctx); p != nil {
+			p.add(fmt.Sprintf("clear credentials from sink %s", sinkSpec.Name))
+			continue
+		}
+
+		sink, err := r.buildSink(ctx, serviceAccount, sinkSpec)
+		if err == nil {
+			err = sink.Delete(ctx)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", sinkSpec.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *PixoServiceAccountReconciler) buildSink(ctx context.Context, serviceAccount *v1.PixoServiceAccount, sinkSpec v1.SecretSink) (secretsink.Sink, error) {
+	switch {
+	case sinkSpec.Vault != nil && sinkSpec.HTTP == nil:
+		token, err := r.secretValue(ctx, serviceAccount.Namespace, sinkSpec.Vault.TokenSecretRef)
+		if err != nil {
+			return nil, err
+		}
+
+		return &secretsink.Vault{
+			Address: sinkSpec.Vault.Address,
+			Mount:   sinkSpec.Vault.Mount,
+			Path:    sinkSpec.Vault.Path,
+			Token:   token,
+		}, nil
+	case sinkSpec.HTTP != nil && sinkSpec.Vault == nil:
+		sink := &secretsink.HTTP{URL: sinkSpec.HTTP.URL}
+		if sinkSpec.HTTP.TokenSecretRef != nil {
+			token, err := r.secretValue(ctx, serviceAccount.Namespace, *sinkSpec.HTTP.TokenSecretRef)
+			if err != nil {
+				return nil, err
+			}
+			sink.Token = token
+		}
+
+		return sink, nil
+	default:
+		return nil, errors.New("exactly one of vault or http must be set")
+	}
+}
+
+func (r *PixoServiceAccountReconciler) secretValue(ctx context.Context, namespace string, selector corev1.SecretKeySelector) (string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: selector.Name, Namespace: namespace}, secret); err != nil {
+		return "", err
+	}
+
+	value, ok := secret.Data[selector.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %q", selector.Name, selector.Key)
+	}
+
+	return string(value), nil
+}
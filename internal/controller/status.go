@@ -3,6 +3,8 @@ package controller
 import (
 	"context"
 	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/retry"
 	platformv1 "pixovr.com/platform/api/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -18,7 +20,12 @@ func (r *PixoServiceAccountReconciler) HandleStatusUpdate(ctx context.Context, s
 
 func (r *PixoServiceAccountReconciler) UpdateStatus(ctx context.Context, serviceAccount *platformv1.PixoServiceAccount, msg string, apiKeyID int, user *platform.User, err error) error {
 
-	serviceAccount.Log(msg, err)
+	logger := serviceAccountLogger(ctx, serviceAccount)
+	if err != nil {
+		logger.Error(err, msg)
+	} else if msg != "" {
+		logger.Info(msg)
+	}
 
 	update := false
 
@@ -27,10 +34,30 @@ func (r *PixoServiceAccountReconciler) UpdateStatus(ctx context.Context, service
 		serviceAccount.Status.APIKeyID = apiKeyID
 	}
 
-	hasNewErr := err != nil && serviceAccount.Status.Error != err.Error()
-	if hasNewErr {
-		update = true
-		serviceAccount.Status.Error = err.Error()
+	ready := metav1.Condition{
+		Type:               platformv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             platformv1.ReasonReconciled,
+		Message:            "service account is in sync with the platform",
+		ObservedGeneration: serviceAccount.Generation,
+	}
+
+	if err != nil {
+		reason, transient := conditionReason(err)
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reason
+		ready.Message = err.Error()
+		if msg != "" {
+			ready.Message = msg + ": " + err.Error()
+		}
+
+		// transient platform errors only go on the condition, status.error is
+		// kept for failures that need someone to look at them
+		hasNewErr := !transient && serviceAccount.Status.Error != err.Error()
+		if hasNewErr {
+			update = true
+			serviceAccount.Status.Error = err.Error()
+		}
 	}
 
 	shouldRemoveError := err == nil && serviceAccount.Status.Error != ""
@@ -39,6 +66,10 @@ func (r *PixoServiceAccountReconciler) UpdateStatus(ctx context.Context, service
 		serviceAccount.Status.Error = ""
 	}
 
+	if meta.SetStatusCondition(&serviceAccount.Status.Conditions, ready) {
+		update = true
+	}
+
 	if user != nil {
 		update = true
 		serviceAccount.Status.ID = user.ID
@@ -51,9 +82,32 @@ func (r *PixoServiceAccountReconciler) UpdateStatus(ctx context.Context, service
 
 	if update {
 		if updateErr := r.Status().Patch(ctx, serviceAccount, client.Merge); updateErr != nil {
-			serviceAccount.Log("failed to update status", updateErr)
+			logger.Error(updateErr, "failed to update status")
 		}
 	}
 
 	return err
 }
+
+type statusBaseKey struct{}
+
+// withStatusBase records object as it was read at the start of a reconcile.
+// Status patches made with statusPatch are computed against it, so fields
+// the reconcile cleared are removed from the stored status too.
+func withStatusBase(ctx context.Context, object client.Object) context.Context {
+	return context.WithValue(ctx, statusBaseKey{}, object.DeepCopyObject().(client.Object))
+}
+
+// statusPatch returns a merge patch from the object recorded by
+// withStatusBase to object. The base takes object's resourceVersion, so the
+// patch doesn't fail on the object's own updates earlier in the reconcile.
+func statusPatch(ctx context.Context, object client.Object) client.Patch {
+	recorded, ok := ctx.Value(statusBaseKey{}).(client.Object)
+	if !ok {
+		return client.Merge
+	}
+
+	base := recorded.DeepCopyObject().(client.Object)
+	base.SetResourceVersion(object.GetResourceVersion())
+	return client.MergeFrom(base)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	corev1 "k8s.io/api/core/v1"
+	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// suspend reconciles a suspended account. Nothing is changed on the platform
+// or in its workloads, not even when it is deleted, but its user is still
+// looked up so status stays current. With the RevokeAccess policy its api
+// key is revoked and its password replaced first, once.
+func (r *PixoServiceAccountReconciler) suspend(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	if !serviceAccount.Status.Suspended {
+		patch := client.MergeFrom(serviceAccount.DeepCopy())
+		serviceAccount.Status.Suspended = true
+		if err := r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+			return err
+		}
+		r.event(ctx, serviceAccount, corev1.EventTypeNormal, v1.ReasonSuspended, "reconciliation suspended")
+	}
+
+	user, exists, err := r.lookupUser(ctx, serviceAccount.Name)
+	if err != nil {
+		return r.HandleStatusUpdate(ctx, serviceAccount, "failed to look up pixo user account", 0, nil, err)
+	}
+	if !exists {
+		user = nil
+	}
+
+	if serviceAccount.Spec.SuspendPolicy == v1.SuspendRevokeAccess && !serviceAccount.Status.AccessRevoked {
+		if err = r.revokeAccess(ctx, serviceAccount, user, v1.ReasonSuspended); err != nil {
+			return r.HandleStatusUpdate(ctx, serviceAccount, "failed to revoke access", 0, user, err)
+		}
+	}
+
+	reason := "spec.suspend is set"
+	if !serviceAccount.Spec.Suspend {
+		reason = v1.AnnotationPaused + " is set"
+	}
+	if serviceAccount.GetDeletionTimestamp() != nil {
+		reason += ", deletion waits until it is resumed"
+	}
+	if serviceAccount.Status.AccessRevoked {
+		reason += ", access is revoked until it is resumed"
+	}
+
+	return r.HandleStatusUpdate(ctx, serviceAccount, "reconciliation is suspended", 0, user, newNotReadyError(v1.ReasonSuspended, "%s", reason))
+}
+
+// revokeAccess revokes the account's api key and replaces its password with
+// one that is thrown away, then records that in status under reason. The
+// Secret keeps the old values so workloads referencing it still start; they
+// are replaced once access is restored.
+func (r *PixoServiceAccountReconciler) revokeAccess(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User, reason string) error {
+	secret, err := r.getAuthSecret(ctx, serviceAccount)
+	if err != nil {
+		return err
+	}
+
+	apiKeyID := serviceAccount.Status.APIKeyID
+	if apiKeyID == 0 && secret != nil {
+		apiKeyID = readAuthCredentials(secret).APIKeyID
+	}
+
+	if apiKeyID != 0 {
+		if err = r.PlatformClient.DeleteAPIKey(ctx, apiKeyID); err != nil && !platformclient.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if user != nil {
+		if _, err = r.PlatformClient.UpdateUser(ctx, platform.User{ID: user.ID, Password: v1.GeneratePassword()}); err != nil {
+			return err
+		}
+	}
+
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Status.APIKeyID = 0
+	serviceAccount.Status.AccessRevoked = true
+	if err = r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+		return err
+	}
+
+	serviceAccountLogger(ctx, serviceAccount).Info("revoked access of service account", "apiKeyId", apiKeyID, "reason", reason)
+	r.event(ctx, serviceAccount, corev1.EventTypeNormal, reason, "revoked api key and password")
+	return nil
+}
+
+// resume clears the suspension recorded in status once the account is no
+// longer suspended. Access revoked while it was suspended is restored later
+// in the reconcile, by issuing new credentials.
+func (r *PixoServiceAccountReconciler) resume(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	if !serviceAccount.Status.Suspended {
+		return nil
+	}
+
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Status.Suspended = false
+	if err := r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+		return err
+	}
+
+	r.event(ctx, serviceAccount, corev1.EventTypeNormal, v1.ReasonResumed, "reconciliation resumed")
+	return nil
+}
+
+// restoreAccess records that the credentials revoked while the account was
+// suspended or disabled have been replaced.
+func (r *PixoServiceAccountReconciler) restoreAccess(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	if !serviceAccount.Status.AccessRevoked {
+		return nil
+	}
+
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Status.AccessRevoked = false
+	if err := r.Status().Patch(ctx, serviceAccount, patch); err != nil {
+		return err
+	}
+
+	r.event(ctx, serviceAccount, corev1.EventTypeNormal, v1.ReasonResumed, "issued new credentials")
+	return nil
+}
+
+// event records an event for the account. Nothing is recorded during a dry
+// run, whose status writes are dropped and would repeat it every time.
+func (r *PixoServiceAccountReconciler) event(ctx context.Context, serviceAccount *v1.PixoServiceAccount, eventType, reason, message string) {
+	if r.Recorder == nil || planFrom(ctx) != nil {
+		return
+	}
+
+	r.Recorder.Event(serviceAccount, eventType, reason, message)
+}
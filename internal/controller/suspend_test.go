@@ -0,0 +1,130 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount suspension", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		platformClient *fake.Client
+		serviceAccount *platformv1.PixoServiceAccount
+		req            ctrl.Request
+	)
+
+	reconcile := func() ctrl.Result {
+		res, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).To(Succeed())
+		return res
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, strings.ToLower(faker.Username()), "admin")
+		req = NewRequest(serviceAccount)
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+	})
+
+	It("should leave the platform and workloads alone while suspended", func() {
+		serviceAccount.Spec.Suspend = true
+		serviceAccount.Spec.FirstName = "Suspended"
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name+"-suspended", serviceAccount.Name)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		res := reconcile()
+
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(platformClient.Calls("UpdateUser")).To(BeZero())
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+		Expect(serviceAccount.Status.Suspended).To(BeTrue())
+		Expect(serviceAccount.Status.AccessRevoked).To(BeFalse())
+		Expect(serviceAccount.Status.ID).NotTo(BeZero())
+		ExpectReadyCondition(serviceAccount, metav1.ConditionFalse, platformv1.ReasonSuspended)
+		var updatedDeployment v1.Deployment
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), &updatedDeployment)).To(Succeed())
+		Expect(updatedDeployment.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(HaveField("Name", "PIXO_USERNAME")))
+
+		serviceAccount.Spec.Suspend = false
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+
+		Expect(serviceAccount.Status.Suspended).To(BeFalse())
+		Expect(serviceAccount.Status.FirstName).To(Equal("Suspended"))
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+		ExpectReadyCondition(serviceAccount, metav1.ConditionTrue, platformv1.ReasonReconciled)
+	})
+
+	It("should hold deletion while paused by annotation", func() {
+		serviceAccount.Annotations = map[string]string{platformv1.AnnotationPaused: "true"}
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, serviceAccount)).To(Succeed())
+
+		reconcile()
+
+		_, ok := platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeTrue())
+		Expect(serviceAccount.Status.Conditions).To(ContainElement(HaveField("Message", ContainSubstring("deletion waits"))))
+
+		delete(serviceAccount.Annotations, platformv1.AnnotationPaused)
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, req)
+
+		Expect(err).NotTo(HaveOccurred())
+		_, ok = platformClient.User(serviceAccount.Name)
+		Expect(ok).To(BeFalse())
+		Expect(reconciler.Get(ctx, req.NamespacedName, serviceAccount)).NotTo(Succeed())
+	})
+
+	It("can revoke access while suspended and restore it on resume", func() {
+		revokedKeyID := serviceAccount.Status.APIKeyID
+		revokedPassword := string(GetAuthSecret(ctx, serviceAccount).Data["password"])
+
+		serviceAccount.Spec.Suspend = true
+		serviceAccount.Spec.SuspendPolicy = platformv1.SuspendRevokeAccess
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+		reconcile()
+
+		Expect(serviceAccount.Status.AccessRevoked).To(BeTrue())
+		Expect(serviceAccount.Status.APIKeyID).To(BeZero())
+		_, ok := platformClient.APIKey(revokedKeyID)
+		Expect(ok).To(BeFalse())
+		Expect(platformClient.Calls("DeleteAPIKey")).To(Equal(1))
+		Expect(platformClient.Password(serviceAccount.Status.ID)).NotTo(Equal(revokedPassword))
+
+		serviceAccount.Spec.Suspend = false
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+		reconcile()
+
+		Expect(serviceAccount.Status.AccessRevoked).To(BeFalse())
+		Expect(serviceAccount.Status.APIKeyID).NotTo(BeZero())
+		Expect(serviceAccount.Status.APIKeyID).NotTo(Equal(revokedKeyID))
+		apiKey, ok := platformClient.APIKey(serviceAccount.Status.APIKeyID)
+		Expect(ok).To(BeTrue())
+		secret := GetAuthSecret(ctx, serviceAccount)
+		Expect(string(secret.Data["api-key"])).To(Equal(apiKey.Key))
+		Expect(string(secret.Data["password"])).To(Equal(platformClient.Password(serviceAccount.Status.ID)))
+	})
+
+})
@@ -3,16 +3,80 @@ package controller
 import (
 	"context"
 	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	corev1 "k8s.io/api/core/v1"
 	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (r *PixoServiceAccountReconciler) createUser(ctx context.Context, serviceAccount *v1.PixoServiceAccount) (*platform.User, error) {
-	input := serviceAccount.GenerateUserSpec()
+// lookupUser finds the platform user for username. Only a not-found answer
+// from the platform, or the empty user it returns for a null result, reports
+// the user as missing; every other error is returned so the caller doesn't
+// try to create a user that may already exist.
+func (r *PixoServiceAccountReconciler) lookupUser(ctx context.Context, username string) (*platform.User, bool, error) {
+	user, err := r.PlatformClient.GetUserByUsername(ctx, username)
+	if err != nil {
+		if platformclient.IsNotFound(err) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	if user == nil || user.ID == 0 {
+		return nil, false, nil
+	}
+
+	return user, true, nil
+}
+
+// createUser creates the account's platform user in steps that can each be
+// interrupted: the intent is recorded in status, a password is stored in the
+// auth Secret, the user is created with it and its ID is recorded. The
+// password is never only in memory, and a reconcile that stopped after the
+// user was created finds it by name and records it then.
+func (r *PixoServiceAccountReconciler) createUser(ctx context.Context, serviceAccount *v1.PixoServiceAccount, orgID int, credentials authCredentials, previous *corev1.Secret) (*platform.User, authCredentials, error) {
+	// a new user has no api key, whatever a leftover Secret says
+	credentials.APIKey, credentials.APIKeyID = "", 0
+
+	if err := r.setCreationPhase(ctx, serviceAccount, v1.CreationPending); err != nil {
+		return nil, credentials, err
+	}
+
+	input := serviceAccount.GenerateUserSpec(orgID)
+	if credentials.Password == "" {
+		credentials.Username = input.Username
+		credentials.Password = v1.GeneratePassword()
+		if err := r.writeAuthSecret(ctx, serviceAccount, credentials, previous); err != nil {
+			return nil, credentials, err
+		}
+	}
 
+	input.Password = credentials.Password
 	user, err := r.PlatformClient.CreateUser(ctx, *input)
 	if err != nil {
-		return nil, r.HandleStatusUpdate(ctx, serviceAccount, "failed to create pixo user account", 0, user, err)
+		return nil, credentials, err
+	}
+
+	return user, credentials, r.recordUser(ctx, serviceAccount, user)
+}
+
+// recordUser records the ID of a newly created user before anything that
+// depends on it runs.
+func (r *PixoServiceAccountReconciler) recordUser(ctx context.Context, serviceAccount *v1.PixoServiceAccount, user *platform.User) error {
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Status.ID = user.ID
+	serviceAccount.Status.Username = user.Username
+	serviceAccount.Status.CreationPhase = v1.CreationUserCreated
+	return r.Status().Patch(ctx, serviceAccount, patch)
+}
+
+func (r *PixoServiceAccountReconciler) setCreationPhase(ctx context.Context, serviceAccount *v1.PixoServiceAccount, phase v1.CreationPhase) error {
+	if serviceAccount.Status.CreationPhase == phase {
+		return nil
 	}
 
-	return user, nil
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	serviceAccount.Status.CreationPhase = phase
+	return r.Status().Patch(ctx, serviceAccount, patch)
 }
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "pixovr.com/platform/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slices"
+)
+
+// boundKubernetesServiceAccounts returns the Kubernetes ServiceAccounts whose
+// pods get the account's credentials: the ones in spec and the ones whose
+// annotation names the account.
+func boundKubernetesServiceAccounts(ctx context.Context, c client.Reader, serviceAccount *v1.PixoServiceAccount) ([]string, error) {
+	bound := slices.Clone(serviceAccount.Spec.KubernetesServiceAccounts)
+
+	serviceAccounts := &corev1.ServiceAccountList{}
+	if err := c.List(ctx, serviceAccounts, client.InNamespace(serviceAccount.Namespace)); err != nil {
+		return nil, err
+	}
+
+	for _, item := range serviceAccounts.Items {
+		if item.Annotations[v1.AnnotationPixoServiceAccount] == serviceAccount.Name && !slices.Contains(bound, item.Name) {
+			bound = append(bound, item.Name)
+		}
+	}
+
+	return bound, nil
+}
+
+// consumesServiceAccount reports whether the deployment gets the account's
+// credentials, either through its annotation or because its pods run as one
+// of the bound Kubernetes ServiceAccounts. The annotation wins when both
+// apply.
+func consumesServiceAccount(deployment *appsv1.Deployment, serviceAccount *v1.PixoServiceAccount, bound []string) bool {
+	if serviceAccountName, ok := deployment.Annotations[AnnotationKey]; ok {
+		return serviceAccountName == serviceAccount.Name
+	}
+
+	return slices.Contains(bound, podServiceAccountName(&deployment.Spec.Template.Spec))
+}
+
+// podServiceAccountName returns the Kubernetes ServiceAccount pods with spec
+// run as.
+func podServiceAccountName(spec *corev1.PodSpec) string {
+	if spec.ServiceAccountName == "" {
+		return "default"
+	}
+
+	return spec.ServiceAccountName
+}
+
+// BoundPixoServiceAccount returns the PixoServiceAccount pods running as the
+// Kubernetes ServiceAccount namespace/name get credentials from. It fails
+// when no account or more than one is bound to it.
+func BoundPixoServiceAccount(ctx context.Context, c client.Reader, namespace, name string) (*v1.PixoServiceAccount, error) {
+	kubernetesServiceAccount := &corev1.ServiceAccount{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, kubernetesServiceAccount); err != nil {
+		return nil, err
+	}
+
+	serviceAccounts := &v1.PixoServiceAccountList{}
+	if err := c.List(ctx, serviceAccounts, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	annotated := kubernetesServiceAccount.Annotations[v1.AnnotationPixoServiceAccount]
+	var bound []*v1.PixoServiceAccount
+	for i, item := range serviceAccounts.Items {
+		if item.Name == annotated || slices.Contains(item.Spec.KubernetesServiceAccounts, name) {
+			bound = append(bound, &serviceAccounts.Items[i])
+		}
+	}
+
+	switch len(bound) {
+	case 0:
+		return nil, fmt.Errorf("no PixoServiceAccount is bound to service account %s/%s", namespace, name)
+	case 1:
+		return bound[0], nil
+	default:
+		return nil, fmt.Errorf("%d PixoServiceAccounts are bound to service account %s/%s", len(bound), namespace, name)
+	}
+}
@@ -0,0 +1,94 @@
+package controller_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient/fake"
+	runtime "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+var _ = Describe("PixoServiceAccount bound to Kubernetes ServiceAccounts", func() {
+
+	var (
+		ctx            context.Context
+		reconciler     controller.PixoServiceAccountReconciler
+		serviceAccount *platformv1.PixoServiceAccount
+	)
+
+	runningAs := func(name, kubernetesServiceAccount string) *v1.Deployment {
+		deployment := NewTestDeployment(Namespace, name, "")
+		deployment.Annotations = nil
+		deployment.Spec.Template.Spec.ServiceAccountName = kubernetesServiceAccount
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+		return deployment
+	}
+
+	envOf := func(deployment *v1.Deployment) []corev1.EnvVar {
+		updated := &v1.Deployment{}
+		Expect(k8sClient.Get(ctx, runtime.ObjectKeyFromObject(deployment), updated)).To(Succeed())
+		return updated.Spec.Template.Spec.Containers[0].Env
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		reconciler = controller.PixoServiceAccountReconciler{
+			Client:         k8sClient,
+			PlatformClient: fake.New(),
+		}
+		serviceAccount = NewTestServiceAccount(Namespace, "identity-"+strings.ToLower(faker.Username()), "admin")
+	})
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, NewRequest(serviceAccount))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("should inject credentials into pods running as a listed ServiceAccount", func() {
+		serviceAccount.Spec.KubernetesServiceAccounts = []string{serviceAccount.Name + "-runner"}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		bound := runningAs(serviceAccount.Name+"-bound", serviceAccount.Name+"-runner")
+		unbound := runningAs(serviceAccount.Name+"-unbound", serviceAccount.Name+"-other")
+
+		reconcile()
+
+		Expect(envOf(bound)).To(ContainElement(HaveField("Name", "PIXO_API_KEY")))
+		Expect(envOf(unbound)).To(BeEmpty())
+	})
+
+	It("should inject credentials into pods running as an annotated ServiceAccount", func() {
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		Expect(k8sClient.Create(ctx, &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        serviceAccount.Name + "-runner",
+				Namespace:   Namespace,
+				Annotations: map[string]string{platformv1.AnnotationPixoServiceAccount: serviceAccount.Name},
+			},
+		})).To(Succeed())
+		bound := runningAs(serviceAccount.Name+"-annotated", serviceAccount.Name+"-runner")
+
+		reconcile()
+
+		Expect(envOf(bound)).To(ContainElement(HaveField("Name", "PIXO_USERNAME")))
+	})
+
+	It("should leave deployments whose annotation names another account alone", func() {
+		serviceAccount.Spec.KubernetesServiceAccounts = []string{serviceAccount.Name + "-runner"}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		deployment := NewTestDeployment(Namespace, serviceAccount.Name+"-other", "other-account")
+		deployment.Spec.Template.Spec.ServiceAccountName = serviceAccount.Name + "-runner"
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		reconcile()
+
+		Expect(envOf(deployment)).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,178 @@
+package exchange_test
+
+import (
+	"context"
+	"github.com/go-faker/faker/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	platformv1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/exchange"
+	"pixovr.com/platform/internal/platformclient/fake"
+	"pixovr.com/platform/pkg/tokenexchange"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Token exchange", func() {
+
+	var (
+		ctx            context.Context
+		platformClient *fake.Client
+		server         *exchange.Server
+		httpServer     *httptest.Server
+		serviceAccount *platformv1.PixoServiceAccount
+		runner         *corev1.ServiceAccount
+	)
+
+	// tokenFor writes a projected token of the ServiceAccount for audience
+	// to a file and returns a client that presents it.
+	tokenFor := func(kubernetesServiceAccount *corev1.ServiceAccount, audience string) *tokenexchange.Client {
+		request := &authenticationv1.TokenRequest{Spec: authenticationv1.TokenRequestSpec{Audiences: []string{audience}}}
+		Expect(k8sClient.SubResource("token").Create(ctx, kubernetesServiceAccount, request)).To(Succeed())
+
+		path := filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(path, []byte(request.Status.Token), 0o600)).To(Succeed())
+
+		exchangeClient := tokenexchange.New(httpServer.URL)
+		exchangeClient.TokenPath = path
+		exchangeClient.HTTPClient = httpServer.Client()
+		return exchangeClient
+	}
+
+	ledger := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: serviceAccount.ExchangeLedgerName()}, secret)).To(Succeed())
+		return secret
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		server = &exchange.Server{
+			Client:         k8sClient,
+			PlatformClient: platformClient,
+			Audience:       tokenexchange.DefaultAudience,
+			DefaultTTL:     15 * time.Minute,
+			MaxTTL:         time.Hour,
+		}
+		httpServer = httptest.NewTLSServer(server.Handler(ctx))
+		DeferCleanup(httpServer.Close)
+
+		name := strings.ToLower(faker.Username())
+		runner = &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name + "-runner", Namespace: Namespace}}
+		Expect(k8sClient.Create(ctx, runner)).To(Succeed())
+
+		serviceAccount = &platformv1.PixoServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+			Spec: platformv1.PixoServiceAccountSpec{
+				FirstName:                 faker.FirstName(),
+				LastName:                  faker.LastName(),
+				OrgID:                     fake.DefaultOrgID,
+				Role:                      "developer",
+				KubernetesServiceAccounts: []string{runner.Name},
+			},
+		}
+		Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+		reconciler := controller.PixoServiceAccountReconciler{Client: k8sClient, PlatformClient: platformClient}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(serviceAccount)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(serviceAccount), serviceAccount)).To(Succeed())
+	})
+
+	It("should exchange a bound ServiceAccount's token for a recorded short-lived api key", func() {
+		exchangeClient := tokenFor(runner, tokenexchange.DefaultAudience)
+		exchangeClient.TTL = 10 * time.Minute
+
+		credential, err := exchangeClient.Credential(ctx)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credential.Username).To(Equal(serviceAccount.Status.Username))
+		Expect(credential.ExpiresAt).To(BeTemporally("~", time.Now().Add(10*time.Minute), 5*time.Second))
+		apiKey, ok := platformClient.APIKey(credential.APIKeyID)
+		Expect(ok).To(BeTrue())
+		Expect(apiKey.Key).To(Equal(credential.APIKey))
+		Expect(apiKey.UserID).To(Equal(serviceAccount.Status.ID))
+		Expect(ledger().Data).To(HaveKey(strconv.Itoa(credential.APIKeyID)))
+
+		cached, err := exchangeClient.Credential(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached.APIKeyID).To(Equal(credential.APIKeyID))
+	})
+
+	It("should cap the lifetime a request asks for", func() {
+		exchangeClient := tokenFor(runner, tokenexchange.DefaultAudience)
+		exchangeClient.TTL = 24 * time.Hour
+
+		credential, err := exchangeClient.Exchange(ctx)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credential.ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), 5*time.Second))
+	})
+
+	It("should revoke keys once they expire", func() {
+		credential, err := tokenFor(runner, tokenexchange.DefaultAudience).Exchange(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(server.RevokeExpired(ctx, time.Now())).To(Succeed())
+		_, ok := platformClient.APIKey(credential.APIKeyID)
+		Expect(ok).To(BeTrue())
+
+		Expect(server.RevokeExpired(ctx, credential.ExpiresAt)).To(Succeed())
+		_, ok = platformClient.APIKey(credential.APIKeyID)
+		Expect(ok).To(BeFalse())
+		Expect(ledger().Data).To(BeEmpty())
+	})
+
+	It("should refuse a request body that is too large", func() {
+		token, err := os.ReadFile(tokenFor(runner, tokenexchange.DefaultAudience).TokenPath)
+		Expect(err).NotTo(HaveOccurred())
+		body := `{"ttlSeconds": 600, "padding": "` + strings.Repeat("x", 8<<10) + `"}`
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, httpServer.URL+tokenexchange.Path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+string(token))
+
+		resp, err := httpServer.Client().Do(req)
+
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+	})
+
+	It("should reject tokens for another audience", func() {
+		_, err := tokenFor(runner, "someone-else").Exchange(ctx)
+
+		Expect(err).To(MatchError(ContainSubstring("401")))
+		Expect(platformClient.Calls("CreateAPIKey")).To(Equal(1))
+	})
+
+	It("should refuse ServiceAccounts no PixoServiceAccount is bound to", func() {
+		stranger := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: serviceAccount.Name + "-stranger", Namespace: Namespace}}
+		Expect(k8sClient.Create(ctx, stranger)).To(Succeed())
+
+		_, err := tokenFor(stranger, tokenexchange.DefaultAudience).Exchange(ctx)
+
+		Expect(err).To(MatchError(ContainSubstring("403")))
+	})
+
+	It("should refuse while the PixoServiceAccount is suspended", func() {
+		serviceAccount.Spec.Suspend = true
+		Expect(k8sClient.Update(ctx, serviceAccount)).To(Succeed())
+
+		_, err := tokenFor(runner, tokenexchange.DefaultAudience).Exchange(ctx)
+
+		Expect(err).To(MatchError(ContainSubstring("503")))
+	})
+
+})
@@ -0,0 +1,362 @@
+// Package exchange serves the token exchange: a pod presents its projected
+// Kubernetes ServiceAccount token and receives a short-lived api key of the
+// PixoServiceAccount bound to its ServiceAccount. Every key it issues is
+// recorded in a ledger Secret and revoked once it expires, also across
+// restarts of the operator.
+package exchange
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net/http"
+	"path/filepath"
+	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/controller"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/pkg/tokenexchange"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+// maxRequestBytes bounds the body of an exchange, which only holds a TTL.
+const maxRequestBytes = 4 << 10
+
+// Server is the token exchange. It runs on every replica of the manager.
+type Server struct {
+	Client         client.Client
+	PlatformClient graphql.PlatformClient
+	// Connections holds the clients of the PixoPlatformConnections accounts
+	// reference. Keys of accounts without a connectionRef are issued with
+	// PlatformClient.
+	Connections *platformclient.Pool
+
+	// Addr is the address the exchange listens on.
+	Addr string
+	// CertDir holds the tls.crt and tls.key the exchange serves with. They
+	// are reloaded when they change, e.g. when cert-manager renews them.
+	CertDir string
+	// Audience is the audience presented tokens must be issued for.
+	Audience string
+	// DefaultTTL is the lifetime of a key when the request asks for none,
+	// MaxTTL the longest lifetime a request can ask for.
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+	// RevokeInterval is how often expired keys are revoked.
+	RevokeInterval time.Duration
+}
+
+// Start serves the exchange and revokes expired keys until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("token-exchange")
+	ctx = log.IntoContext(ctx, logger)
+
+	// tokens come in and api keys go out, so the exchange is only served
+	// over TLS
+	if s.CertDir == "" {
+		return errors.New("token exchange has no serving certificate")
+	}
+	certs, err := certwatcher.New(filepath.Join(s.CertDir, "tls.crt"), filepath.Join(s.CertDir, "tls.key"))
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.Handler(ctx),
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		},
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		if err := certs.Start(ctx); err != nil {
+			errs <- err
+		}
+	}()
+	go func() {
+		logger.Info("serving token exchange", "addr", s.Addr)
+		if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+
+	ticker := time.NewTicker(s.RevokeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.RevokeExpired(ctx, time.Now()); err != nil {
+				logger.Error(err, "failed to revoke expired api keys")
+			}
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return server.Shutdown(shutdownCtx)
+		}
+	}
+}
+
+// NeedLeaderElection returns false so every replica answers exchanges.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the HTTP handler of the exchange. Requests are logged with
+// the logger of ctx.
+func (s *Server) Handler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(tokenexchange.Path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+		credential, status, err := s.exchange(log.IntoContext(r.Context(), log.FromContext(ctx)), r)
+		if err != nil {
+			writeError(w, status, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(credential)
+	})
+	return mux
+}
+
+// exchange returns the credential for the request, or an error with the HTTP
+// status to answer it with.
+func (s *Server) exchange(ctx context.Context, r *http.Request) (*tokenexchange.Credential, int, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, http.StatusUnauthorized, errors.New("missing bearer token")
+	}
+
+	var request tokenexchange.Request
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, http.StatusRequestEntityTooLarge, err
+			}
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err)
+		}
+	}
+
+	namespace, name, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	serviceAccount, err := controller.BoundPixoServiceAccount(ctx, s.Client, namespace, name)
+	if err != nil {
+		return nil, http.StatusForbidden, err
+	}
+
+	if serviceAccount.Status.ID == 0 || serviceAccount.IsSuspended() || !serviceAccount.IsEnabled() || serviceAccount.Status.AccessRevoked {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("PixoServiceAccount %s is not ready to issue credentials", serviceAccount.Name)
+	}
+
+	ttl := s.DefaultTTL
+	if request.TTLSeconds > 0 {
+		ttl = min(time.Duration(request.TTLSeconds)*time.Second, s.MaxTTL)
+	}
+
+	credential, err := s.issue(ctx, serviceAccount, ttl)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to issue api key", "serviceAccount", client.ObjectKeyFromObject(serviceAccount))
+		return nil, http.StatusBadGateway, errors.New("failed to issue api key")
+	}
+
+	log.FromContext(ctx).Info("exchanged token for api key", "serviceAccount", client.ObjectKeyFromObject(serviceAccount),
+		"kubernetesServiceAccount", name, "apiKeyId", credential.APIKeyID, "expiresAt", credential.ExpiresAt)
+	return credential, http.StatusOK, nil
+}
+
+// authenticate validates token with a TokenReview and returns the
+// ServiceAccount it was issued to.
+func (s *Server) authenticate(ctx context.Context, token string) (string, string, error) {
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if s.Audience != "" {
+		review.Spec.Audiences = []string{s.Audience}
+	}
+	if err := s.Client.Create(ctx, review); err != nil {
+		return "", "", fmt.Errorf("reviewing token: %w", err)
+	}
+
+	if !review.Status.Authenticated {
+		return "", "", errors.New("token is not valid")
+	}
+
+	parts := strings.Split(review.Status.User.Username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return "", "", errors.New("token does not belong to a service account")
+	}
+
+	return parts[2], parts[3], nil
+}
+
+// issue mints a key for the account's user and records it in the ledger. A
+// key that can't be recorded is revoked right away, so none outlives its
+// TTL.
+func (s *Server) issue(ctx context.Context, serviceAccount *v1.PixoServiceAccount, ttl time.Duration) (*tokenexchange.Credential, error) {
+	platformClient, err := controller.PlatformClientFor(ctx, s.Client, s.Connections, s.PlatformClient, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.ensureLedger(ctx, serviceAccount); err != nil {
+		return nil, err
+	}
+
+	apiKey, err := platformClient.CreateAPIKey(ctx, platform.APIKey{UserID: serviceAccount.Status.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	entry := map[string]interface{}{
+		"data": map[string]interface{}{strconv.Itoa(apiKey.ID): []byte(expiresAt.Format(time.RFC3339))},
+	}
+	if err = s.patchLedger(ctx, serviceAccount.Namespace, serviceAccount.ExchangeLedgerName(), entry); err != nil {
+		if revokeErr := platformClient.DeleteAPIKey(ctx, apiKey.ID); revokeErr != nil {
+			return nil, errors.Join(err, revokeErr)
+		}
+		return nil, err
+	}
+
+	return &tokenexchange.Credential{
+		Username:  serviceAccount.Status.Username,
+		APIKey:    apiKey.Key,
+		APIKeyID:  apiKey.ID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// ensureLedger creates the account's ledger Secret, owned by the account so
+// it goes away with it.
+func (s *Server) ensureLedger(ctx context.Context, serviceAccount *v1.PixoServiceAccount) error {
+	ledger := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceAccount.ExchangeLedgerName(),
+			Namespace: serviceAccount.Namespace,
+			Labels: map[string]string{
+				v1.LabelExchangeLedger:                     "true",
+				"platform.pixovr.com/service-account-name": serviceAccount.Name,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	if err := controllerutil.SetOwnerReference(serviceAccount, ledger, s.Client.Scheme()); err != nil {
+		return err
+	}
+
+	if err := s.Client.Create(ctx, ledger); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+// patchLedger merge-patches a ledger, so concurrent exchanges and the
+// revoker only touch their own entries.
+func (s *Server) patchLedger(ctx context.Context, namespace, name string, patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	ledger := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	return s.Client.Patch(ctx, ledger, client.RawPatch(types.MergePatchType, data))
+}
+
+// RevokeExpired revokes every recorded key that expired at now and removes
+// it from its ledger.
+func (s *Server) RevokeExpired(ctx context.Context, now time.Time) error {
+	ledgers := &corev1.SecretList{}
+	if err := s.Client.List(ctx, ledgers, client.HasLabels{v1.LabelExchangeLedger}); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, ledger := range ledgers.Items {
+		platformClient, err := s.ledgerClient(ctx, &ledger)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		expired := map[string]interface{}{}
+		for id, value := range ledger.Data {
+			expiresAt, err := time.Parse(time.RFC3339, string(value))
+			if err == nil && now.Before(expiresAt) {
+				continue
+			}
+
+			apiKeyID, err := strconv.Atoi(id)
+			if err == nil {
+				if err = platformClient.DeleteAPIKey(ctx, apiKeyID); err != nil && !platformclient.IsNotFound(err) {
+					errs = append(errs, fmt.Errorf("revoking api key %d: %w", apiKeyID, err))
+					continue
+				}
+				log.FromContext(ctx).Info("revoked expired api key", "ledger", client.ObjectKeyFromObject(&ledger), "apiKeyId", apiKeyID)
+			}
+			expired[id] = nil
+		}
+
+		if len(expired) == 0 {
+			continue
+		}
+		if err := s.patchLedger(ctx, ledger.Namespace, ledger.Name, map[string]interface{}{"data": expired}); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ledgerClient returns the platform client of the account a ledger belongs
+// to. Ledgers go away with their account, so one whose account is gone falls
+// back to PlatformClient.
+func (s *Server) ledgerClient(ctx context.Context, ledger *corev1.Secret) (graphql.PlatformClient, error) {
+	serviceAccount := &v1.PixoServiceAccount{}
+	key := types.NamespacedName{Namespace: ledger.Namespace, Name: ledger.Labels["platform.pixovr.com/service-account-name"]}
+	if err := s.Client.Get(ctx, key, serviceAccount); err != nil {
+		if apierrors.IsNotFound(err) {
+			return s.PlatformClient, nil
+		}
+
+		return nil, err
+	}
+
+	return controller.PlatformClientFor(ctx, s.Client, s.Connections, s.PlatformClient, serviceAccount)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(tokenexchange.ErrorResponse{Error: message})
+}
@@ -0,0 +1,175 @@
+// Package importer turns platform users that were created by hand into
+// PixoServiceAccount manifests the operator adopts without re-creating the
+// users or their api keys.
+package importer
+
+import (
+	"context"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	"io"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/platformclient"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+	"strconv"
+	"strings"
+)
+
+// Options select the users to import and where their accounts go.
+type Options struct {
+	OrgID     int
+	Namespace string
+	// Exclude lists usernames that are left out.
+	Exclude []string
+}
+
+// Skipped is a user that could not be imported.
+type Skipped struct {
+	Username string
+	Reason   string
+}
+
+// Result is the outcome of an import.
+type Result struct {
+	ServiceAccounts []v1.PixoServiceAccount
+	Skipped         []Skipped
+}
+
+// Import lists the users of the org and returns an account for each one.
+// Accounts carry the adoption annotations with the user's ID and its newest
+// api key, and only ask for an api key: the user's password is unknown, and
+// asking for one would reset it. Users whose username isn't a valid object
+// name, and the operator's own user, are skipped.
+func Import(ctx context.Context, platformClient graphql.PlatformClient, options Options) (*Result, error) {
+	users, err := platformclient.UserList(platformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := users.GetUsers(ctx, options.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("listing users of org %d: %w", options.OrgID, err)
+	}
+
+	result := &Result{}
+	for _, user := range found {
+		if reason := skipReason(platformClient, options, user.ID, user.Username); reason != "" {
+			result.Skipped = append(result.Skipped, Skipped{Username: user.Username, Reason: reason})
+			continue
+		}
+
+		userID := user.ID
+		keys, err := platformClient.GetAPIKeys(ctx, &graphql.APIKeyQueryParams{UserID: &userID})
+		if err != nil {
+			return nil, fmt.Errorf("listing api keys of user %s: %w", user.Username, err)
+		}
+
+		annotations := map[string]string{v1.AnnotationAdoptUserID: strconv.Itoa(user.ID)}
+		newest := 0
+		for _, key := range keys {
+			newest = max(newest, key.ID)
+		}
+		if newest != 0 {
+			annotations[v1.AnnotationAdoptAPIKeyID] = strconv.Itoa(newest)
+		}
+
+		result.ServiceAccounts = append(result.ServiceAccounts, v1.PixoServiceAccount{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1.GroupVersion.String(),
+				Kind:       "PixoServiceAccount",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        user.Username,
+				Namespace:   options.Namespace,
+				Annotations: annotations,
+			},
+			Spec: v1.PixoServiceAccountSpec{
+				FirstName:   user.FirstName,
+				LastName:    user.LastName,
+				OrgID:       user.OrgID,
+				Role:        user.Role,
+				Credentials: v1.CredentialsAPIKey,
+			},
+		})
+	}
+
+	return result, nil
+}
+
+func skipReason(platformClient graphql.PlatformClient, options Options, userID int, username string) string {
+	for _, excluded := range options.Exclude {
+		if username == excluded {
+			return "excluded"
+		}
+	}
+
+	if userID == platformClient.ActiveUserID() {
+		return "the operator's own user"
+	}
+
+	if errs := validation.IsDNS1123Subdomain(username); len(errs) > 0 {
+		return "username is not a valid object name: " + strings.Join(errs, "; ")
+	}
+
+	return ""
+}
+
+// manifest is the part of an account written to YAML, leaving out the empty
+// status.
+type manifest struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        metav1.ObjectMeta         `json:"metadata"`
+	Spec            v1.PixoServiceAccountSpec `json:"spec"`
+}
+
+// WriteYAML writes the accounts as a multi-document YAML stream.
+func WriteYAML(w io.Writer, serviceAccounts []v1.PixoServiceAccount) error {
+	for i, serviceAccount := range serviceAccounts {
+		data, err := yaml.Marshal(manifest{
+			TypeMeta: serviceAccount.TypeMeta,
+			Metadata: metav1.ObjectMeta{
+				Name:        serviceAccount.Name,
+				Namespace:   serviceAccount.Namespace,
+				Annotations: serviceAccount.Annotations,
+			},
+			Spec: serviceAccount.Spec,
+		})
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			if _, err = io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Apply creates the accounts in the cluster. Accounts that already exist are
+// left alone and returned, so running an import twice is harmless.
+func Apply(ctx context.Context, c client.Client, serviceAccounts []v1.PixoServiceAccount) ([]string, error) {
+	var existing []string
+	for _, serviceAccount := range serviceAccounts {
+		serviceAccount := serviceAccount
+		if err := c.Create(ctx, &serviceAccount); err != nil {
+			if errors.IsAlreadyExists(err) {
+				existing = append(existing, serviceAccount.Name)
+				continue
+			}
+
+			return existing, fmt.Errorf("creating %s: %w", serviceAccount.Name, err)
+		}
+	}
+
+	return existing, nil
+}
@@ -0,0 +1,90 @@
+package importer_test
+
+import (
+	"bytes"
+	"context"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "pixovr.com/platform/api/v1"
+	"pixovr.com/platform/internal/importer"
+	"pixovr.com/platform/internal/platformclient/fake"
+	"sigs.k8s.io/yaml"
+	"strconv"
+	"strings"
+)
+
+var _ = Describe("Import", func() {
+
+	var (
+		ctx            context.Context
+		platformClient *fake.Client
+		options        importer.Options
+		user           *platform.User
+		apiKey         *platform.APIKey
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		platformClient = fake.New()
+		options = importer.Options{OrgID: fake.DefaultOrgID, Namespace: "pixo"}
+
+		user = platformClient.AddUser(platform.User{Username: "build-bot", FirstName: "Build", LastName: "Bot", Role: "developer", OrgID: fake.DefaultOrgID}, "secret")
+		_, err := platformClient.CreateAPIKey(ctx, platform.APIKey{UserID: user.ID})
+		Expect(err).NotTo(HaveOccurred())
+		apiKey, err = platformClient.CreateAPIKey(ctx, platform.APIKey{UserID: user.ID})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should emit an account that adopts the user and its newest api key", func() {
+		result, err := importer.Import(ctx, platformClient, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.ServiceAccounts).To(HaveLen(1))
+		serviceAccount := result.ServiceAccounts[0]
+		Expect(serviceAccount.Name).To(Equal("build-bot"))
+		Expect(serviceAccount.Namespace).To(Equal("pixo"))
+		Expect(serviceAccount.Annotations).To(HaveKeyWithValue(v1.AnnotationAdoptUserID, strconv.Itoa(user.ID)))
+		Expect(serviceAccount.Annotations).To(HaveKeyWithValue(v1.AnnotationAdoptAPIKeyID, strconv.Itoa(apiKey.ID)))
+		Expect(serviceAccount.Spec.Role).To(Equal("developer"))
+		Expect(serviceAccount.Spec.OrgID).To(Equal(fake.DefaultOrgID))
+		Expect(serviceAccount.Spec.Credentials).To(Equal(v1.CredentialsAPIKey))
+		Expect(platformClient.Calls("CreateUser")).To(BeZero())
+	})
+
+	It("should skip the operator's own user, excluded users and invalid names", func() {
+		platformClient.AddUser(platform.User{Username: "Jane.Doe@pixovr.com", OrgID: fake.DefaultOrgID}, "secret")
+		platformClient.AddUser(platform.User{Username: "legacy", OrgID: fake.DefaultOrgID}, "secret")
+		options.Exclude = []string{"legacy"}
+
+		result, err := importer.Import(ctx, platformClient, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.ServiceAccounts).To(HaveLen(1))
+		Expect(result.Skipped).To(ConsistOf(
+			HaveField("Username", fake.OperatorUsername),
+			HaveField("Username", "Jane.Doe@pixovr.com"),
+			And(HaveField("Username", "legacy"), HaveField("Reason", "excluded")),
+		))
+	})
+
+	It("can write the accounts as YAML", func() {
+		platformClient.AddUser(platform.User{Username: "deploy-bot", Role: "admin", OrgID: fake.DefaultOrgID}, "secret")
+		result, err := importer.Import(ctx, platformClient, options)
+		Expect(err).NotTo(HaveOccurred())
+
+		var out bytes.Buffer
+		Expect(importer.WriteYAML(&out, result.ServiceAccounts)).To(Succeed())
+
+		documents := strings.Split(out.String(), "---\n")
+		Expect(documents).To(HaveLen(2))
+		Expect(documents[0]).NotTo(ContainSubstring("status"))
+		var serviceAccount v1.PixoServiceAccount
+		Expect(yaml.UnmarshalStrict([]byte(documents[1]), &serviceAccount)).To(Succeed())
+		Expect(serviceAccount.Kind).To(Equal("PixoServiceAccount"))
+		Expect(serviceAccount.APIVersion).To(Equal(v1.GroupVersion.String()))
+		Expect(serviceAccount.Name).To(Equal("deploy-bot"))
+		Expect(serviceAccount.Annotations).NotTo(HaveKey(v1.AnnotationAdoptAPIKeyID))
+	})
+
+})
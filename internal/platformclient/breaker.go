@@ -0,0 +1,92 @@
+package platformclient
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a consecutive-failure circuit breaker. Once threshold retryable
+// failures happen in a row it opens and rejects calls for cooldown, then lets
+// a single probe through; the probe's outcome closes or re-opens it.
+type breaker struct {
+	mu sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+
+	failures int
+	open     bool
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may proceed and, if not, how long until the
+// breaker will let a probe through.
+func (b *breaker) allow() (bool, time.Duration) {
+	if b.threshold <= 0 {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true, 0
+	}
+
+	if remaining := b.cooldown - time.Since(b.openedAt); remaining > 0 {
+		return false, remaining
+	}
+
+	if b.probing {
+		return false, b.cooldown
+	}
+
+	b.probing = true
+	return true, 0
+}
+
+// record updates the breaker with the outcome of a call. Only retryable
+// failures count against the platform; a not-found or conflict still means
+// the platform answered.
+func (b *breaker) record(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.failures = 0
+		b.open = false
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.open = true
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+// state returns "closed", "open" or "half-open".
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case !b.open:
+		return "closed"
+	case time.Since(b.openedAt) >= b.cooldown:
+		return "half-open"
+	}
+
+	return "open"
+}
@@ -0,0 +1,132 @@
+package platformclient_test
+
+import (
+	"context"
+	"encoding/json"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	hasura "github.com/hasura/go-graphql-client"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pixovr.com/platform/internal/platformclient"
+)
+
+// contractExchange is a request the GraphQLClient sends for an operation the
+// pinned pixo-golang-clients doesn't provide, and the platform's answer to it.
+// The exchanges under testdata/contract are the contract these operations
+// are written against; update them together with the operations when the
+// platform's primary-api schema changes.
+type contractExchange struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+	Response  json.RawMessage        `json:"response"`
+}
+
+var _ = Describe("GraphQLClient contract", func() {
+
+	var (
+		ctx    context.Context
+		client *platformclient.GraphQLClient
+		server *httptest.Server
+	)
+
+	serve := func(operation string) {
+		data, err := os.ReadFile(filepath.Join("testdata", "contract", operation+".json"))
+		Expect(err).NotTo(HaveOccurred())
+		var exchange contractExchange
+		Expect(json.Unmarshal(data, &exchange)).To(Succeed())
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			var request contractExchange
+			Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+			Expect(request.Query).To(Equal(exchange.Query))
+			Expect(request.Variables).To(Equal(exchange.Variables))
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(exchange.Response)
+		}))
+		client = platformclient.NewGraphQLClient(&graphql.GraphQLAPIClient{
+			Client: hasura.NewClient(server.URL, server.Client()),
+		})
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("can get an org", func() {
+		serve("GetOrg")
+
+		org, err := client.GetOrg(ctx, 7)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(org).To(Equal(&platform.Org{ID: 7, Name: "acme", Type: "enterprise"}))
+	})
+
+	It("should report an org the platform answers with null as not found", func() {
+		serve("GetOrgByName")
+
+		_, err := client.GetOrgByName(ctx, "missing")
+
+		Expect(platformclient.Classify(err)).To(Equal(platformclient.ClassNotFound))
+	})
+
+	It("can create an org", func() {
+		serve("CreateOrg")
+
+		org, err := client.CreateOrg(ctx, platform.Org{Name: "acme", Type: "enterprise"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(org.ID).To(Equal(7))
+	})
+
+	It("can update an org", func() {
+		serve("UpdateOrg")
+
+		org, err := client.UpdateOrg(ctx, platform.Org{ID: 7, Name: "acme-renamed", Type: "enterprise"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(org.Name).To(Equal("acme-renamed"))
+	})
+
+	It("can delete an org", func() {
+		serve("DeleteOrg")
+
+		Expect(client.DeleteOrg(ctx, 7)).To(Succeed())
+	})
+
+	It("can list the users of an org", func() {
+		serve("GetUsers")
+
+		users, err := client.GetUsers(ctx, 7)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(ConsistOf(&platform.User{ID: 12, Username: "builder", FirstName: "Build", LastName: "Bot", Role: "developer", OrgID: 7}))
+	})
+
+	It("can tell whether a user is active", func() {
+		serve("UserActive")
+
+		active, err := client.UserActive(ctx, 12)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(active).To(BeFalse())
+	})
+
+	It("can reactivate a user", func() {
+		serve("SetUserActive")
+
+		Expect(client.SetUserActive(ctx, 12, true)).To(Succeed())
+	})
+
+})
@@ -0,0 +1,55 @@
+package platformclient
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Keys the operator's credentials Secret is expected to contain. When the
+// Secret is mounted as a volume each key becomes a file in the mount
+// directory.
+const (
+	CredentialsAPIKeyFile   = "api-key"
+	CredentialsUsernameFile = "username"
+	CredentialsPasswordFile = "password"
+)
+
+// ErrNoCredentials is returned when the credentials directory holds neither
+// an API key nor a username and password.
+var ErrNoCredentials = errors.New("no platform credentials found")
+
+// Credentials are the operator's own platform credentials. An API key takes
+// precedence over a username and password.
+type Credentials struct {
+	APIKey   string
+	Username string
+	Password string
+}
+
+// LoadCredentials reads credentials from a mounted Secret directory. Missing
+// files are treated as empty values; surrounding whitespace is trimmed so
+// Secrets created with a trailing newline still work.
+func LoadCredentials(dir string) (Credentials, error) {
+	var credentials Credentials
+	for file, value := range map[string]*string{
+		CredentialsAPIKeyFile:   &credentials.APIKey,
+		CredentialsUsernameFile: &credentials.Username,
+		CredentialsPasswordFile: &credentials.Password,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Credentials{}, fmt.Errorf("reading %s: %w", file, err)
+		}
+
+		*value = strings.TrimSpace(string(data))
+	}
+
+	if credentials.APIKey == "" && (credentials.Username == "" || credentials.Password == "") {
+		return Credentials{}, fmt.Errorf("%w in %s", ErrNoCredentials, dir)
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,50 @@
+package platformclient
+
+import (
+	"fmt"
+	"github.com/PixoVR/pixo-golang-clients/pixo-platform/urlfinder"
+)
+
+// DefaultLifecycle is the lifecycle an empty one stands for.
+const DefaultLifecycle = "prod"
+
+// Endpoints are the platform URLs of a lifecycle and region, resolved by
+// urlfinder the same way the platform clients resolve them.
+type Endpoints struct {
+	Lifecycle  string
+	Region     string
+	APIURL     string
+	GraphQLURL string
+}
+
+// ResolveEndpoints returns the endpoints of lifecycle and region, either of
+// which may be empty for its default. When internal is set the GraphQL API is
+// reached through its in-cluster service name, as the GraphQL client does;
+// urlfinder has no in-cluster name for the REST API, so it keeps its public
+// URL.
+func ResolveEndpoints(lifecycle, region string, internal bool) Endpoints {
+	if lifecycle == "" {
+		lifecycle = DefaultLifecycle
+	}
+	if region == "" {
+		region = urlfinder.DefaultRegion
+	}
+
+	api := urlfinder.ServiceConfig{Service: "api", Lifecycle: lifecycle, Region: region, Port: 3001}
+	graphql := urlfinder.ServiceConfig{
+		Service:     urlfinder.DefaultService,
+		ServiceName: "primary-api",
+		Lifecycle:   lifecycle,
+		Region:      region,
+		Namespace:   fmt.Sprintf("%s-%s", lifecycle, urlfinder.DefaultTenant),
+		Port:        8000,
+		InternalDNS: internal,
+	}
+
+	return Endpoints{
+		Lifecycle:  lifecycle,
+		Region:     region,
+		APIURL:     api.FormatURL(),
+		GraphQLURL: graphql.FormatURL() + "/query",
+	}
+}
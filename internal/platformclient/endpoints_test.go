@@ -0,0 +1,38 @@
+package platformclient_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"pixovr.com/platform/internal/platformclient"
+)
+
+var _ = Describe("Endpoints", func() {
+
+	It("should default to the production lifecycle in the default region", func() {
+		Expect(platformclient.ResolveEndpoints("", "", false)).To(Equal(platformclient.Endpoints{
+			Lifecycle:  "prod",
+			Region:     "na",
+			APIURL:     "https://api.apex.pixovr.com",
+			GraphQLURL: "https://apex.pixovr.com/v2/query",
+		}))
+	})
+
+	It("should resolve the endpoints of a lifecycle and region", func() {
+		Expect(platformclient.ResolveEndpoints("stage", "saudi", false)).To(Equal(platformclient.Endpoints{
+			Lifecycle:  "stage",
+			Region:     "saudi",
+			APIURL:     "https://saudi.api.apex.stage.pixovr.com",
+			GraphQLURL: "https://saudi.apex.stage.pixovr.com/v2/query",
+		}))
+	})
+
+	It("should reach the graphql api through its in-cluster service when internal", func() {
+		Expect(platformclient.ResolveEndpoints("dev", "", true)).To(Equal(platformclient.Endpoints{
+			Lifecycle:  "dev",
+			Region:     "na",
+			APIURL:     "https://api.apex.dev.pixovr.com",
+			GraphQLURL: "http://dev-apex-primary-api.dev-apex.svc/query",
+		}))
+	})
+
+})
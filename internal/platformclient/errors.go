@@ -0,0 +1,164 @@
+// Package platformclient wraps the Pixo platform GraphQL client with the
+// resilience the operator needs when it shares one client across every
+// reconcile: classified errors, bounded retries, a circuit breaker and a
+// client-side rate limit.
+package platformclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	hasura "github.com/hasura/go-graphql-client"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorClass groups platform errors by how the caller should react to them.
+type ErrorClass string
+
+const (
+	// ClassRetryable errors are transient: transport failures, timeouts, 5xx
+	// responses, rate limiting and an open circuit breaker.
+	ClassRetryable ErrorClass = "Retryable"
+	// ClassConflict errors mean the platform state changed underneath the
+	// caller, e.g. a username that already exists.
+	ClassConflict ErrorClass = "Conflict"
+	// ClassNotFound errors mean the requested platform object does not exist.
+	ClassNotFound ErrorClass = "NotFound"
+	// ClassAuth errors mean the operator's own credentials were rejected.
+	ClassAuth ErrorClass = "Auth"
+	// ClassUnknown covers everything else, including errors that did not come
+	// from the platform at all.
+	ClassUnknown ErrorClass = "Unknown"
+)
+
+// ErrCircuitOpen is returned without calling the platform while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("platform circuit breaker is open")
+
+// Error is a classified platform error.
+type Error struct {
+	// Operation is the PlatformClient method that failed.
+	Operation string
+	Class     ErrorClass
+	// RetryAfter, when set, is the earliest the operation is worth retrying.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Operation, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var statusPattern = regexp.MustCompile(`^(\d{3}) `)
+
+// Classify returns the class of err. Errors already wrapped in *Error keep
+// their class; raw errors from the GraphQL client are classified by their
+// HTTP status or GraphQL message. Errors that did not come from the platform,
+// such as Kubernetes API errors, are ClassUnknown.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.DeadlineExceeded) {
+		return ClassRetryable
+	}
+
+	var graphQLErrors hasura.Errors
+	if errors.As(err, &graphQLErrors) {
+		return classifyGraphQLErrors(graphQLErrors)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ClassRetryable
+	}
+
+	return ClassUnknown
+}
+
+// RetryAfter returns how long the caller should wait before retrying err, if
+// the error carries a hint.
+func RetryAfter(err error) (time.Duration, bool) {
+	var classified *Error
+	if errors.As(err, &classified) && classified.RetryAfter > 0 {
+		return classified.RetryAfter, true
+	}
+
+	return 0, false
+}
+
+// IsNotFound reports whether err means the platform object does not exist.
+func IsNotFound(err error) bool {
+	return Classify(err) == ClassNotFound
+}
+
+// IsRetryable reports whether err is a transient platform failure.
+func IsRetryable(err error) bool {
+	return Classify(err) == ClassRetryable
+}
+
+func classifyGraphQLErrors(graphQLErrors hasura.Errors) ErrorClass {
+	for _, graphQLError := range graphQLErrors {
+		if class := classifyGraphQLError(graphQLError); class != ClassUnknown {
+			return class
+		}
+	}
+
+	return ClassUnknown
+}
+
+func classifyGraphQLError(graphQLError hasura.Error) ErrorClass {
+	if graphQLError.Extensions["code"] == hasura.ErrRequestError {
+		// non-200 responses carry the HTTP status at the start of the message,
+		// anything else is a transport failure before a response was read
+		if match := statusPattern.FindStringSubmatch(graphQLError.Message); match != nil {
+			statusCode, _ := strconv.Atoi(match[1])
+			return classifyStatusCode(statusCode)
+		}
+
+		return ClassRetryable
+	}
+
+	message := strings.ToLower(graphQLError.Message)
+	switch {
+	case strings.Contains(message, "not found"), strings.Contains(message, "no rows"):
+		return ClassNotFound
+	case strings.Contains(message, "already exists"), strings.Contains(message, "duplicate"):
+		return ClassConflict
+	case strings.Contains(message, "unauthorized"), strings.Contains(message, "unauthenticated"),
+		strings.Contains(message, "forbidden"), strings.Contains(message, "invalid token"),
+		strings.Contains(message, "invalid api key"):
+		return ClassAuth
+	}
+
+	return ClassUnknown
+}
+
+func classifyStatusCode(statusCode int) ErrorClass {
+	switch {
+	case statusCode == 401, statusCode == 403:
+		return ClassAuth
+	case statusCode == 404:
+		return ClassNotFound
+	case statusCode == 409:
+		return ClassConflict
+	case statusCode == 408, statusCode == 429, statusCode >= 500:
+		return ClassRetryable
+	}
+
+	return ClassUnknown
+}
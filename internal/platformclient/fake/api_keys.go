@@ -0,0 +1,124 @@
+package fake
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/go-faker/faker/v4"
+	"sort"
+	"time"
+)
+
+// APIKey returns a copy of the API key with the given ID, if it exists.
+func (c *Client) APIKey(id int) (*platform.APIKey, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	apiKey, ok := c.apiKeys[id]
+	if !ok {
+		return nil, false
+	}
+
+	found := *apiKey
+	return &found, true
+}
+
+// APIKeysForUser returns copies of the user's API keys ordered by ID.
+func (c *Client) APIKeysForUser(userID int) []platform.APIKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.apiKeysForUser(userID)
+}
+
+func (c *Client) GetAPIKeys(ctx context.Context, params *graphql.APIKeyQueryParams) ([]*platform.APIKey, error) {
+	if err := c.begin(ctx, "GetAPIKeys"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	userID := c.activeUserID
+	if params != nil && params.UserID != nil {
+		userID = *params.UserID
+	}
+
+	// like the real query, only the id, key, user and role are selected
+	apiKeys := []*platform.APIKey{}
+	for _, apiKey := range c.apiKeysForUser(userID) {
+		apiKeys = append(apiKeys, &platform.APIKey{
+			ID:     apiKey.ID,
+			Key:    apiKey.Key,
+			UserID: apiKey.UserID,
+			User:   apiKey.User,
+		})
+	}
+
+	return apiKeys, nil
+}
+
+func (c *Client) CreateAPIKey(ctx context.Context, input platform.APIKey) (*platform.APIKey, error) {
+	if err := c.begin(ctx, "CreateAPIKey"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// like the real API, a key without a user belongs to the caller
+	if input.UserID == 0 {
+		input.UserID = c.activeUserID
+	}
+
+	user, ok := c.users[input.UserID]
+	if !ok {
+		return nil, graphQLError("createApiKey", "user not found")
+	}
+
+	apiKey := platform.APIKey{
+		ID:        c.nextAPIKeyID,
+		Key:       faker.UUIDHyphenated(),
+		UserID:    user.ID,
+		User:      &platform.User{Role: user.Role},
+		CreatedAt: time.Now().UTC(),
+	}
+	apiKey.UpdatedAt = apiKey.CreatedAt
+	c.nextAPIKeyID++
+
+	c.apiKeys[apiKey.ID] = &apiKey
+	if err := c.lose("CreateAPIKey"); err != nil {
+		return nil, err
+	}
+
+	created := apiKey
+	return &created, nil
+}
+
+func (c *Client) DeleteAPIKey(ctx context.Context, id int) error {
+	if err := c.begin(ctx, "DeleteAPIKey"); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.apiKeys[id]; !ok {
+		return graphQLError("deleteApiKey", "api key not found")
+	}
+
+	delete(c.apiKeys, id)
+	return nil
+}
+
+func (c *Client) apiKeysForUser(userID int) []platform.APIKey {
+	apiKeys := []platform.APIKey{}
+	for _, apiKey := range c.apiKeys {
+		if apiKey.UserID == userID {
+			apiKeys = append(apiKeys, *apiKey)
+		}
+	}
+	sort.Slice(apiKeys, func(i, j int) bool { return apiKeys[i].ID < apiKeys[j].ID })
+
+	return apiKeys
+}
@@ -0,0 +1,200 @@
+// Package fake provides an in-memory stand-in for the Pixo platform GraphQL
+// API. Unlike graphql_api.MockGraphQLClient it keeps real state for users, API
+// keys and orgs, so a user created in one reconcile is found by the next, and
+// it can inject latency, server errors and rate limits.
+package fake
+
+import (
+	"context"
+	"errors"
+	abstract_client "github.com/PixoVR/pixo-golang-clients/pixo-platform/abstract-client"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultOrgID is the org every fake platform starts with.
+	DefaultOrgID = 1
+	// OperatorUserID is the user the fake client is authenticated as. Calls
+	// that act on "the current user", such as creating an API key without a
+	// user ID, are attributed to it.
+	OperatorUserID = 1
+	// OperatorUsername is the username of the operator's own platform user.
+	OperatorUsername = "platform-operator"
+	// URL is the address the fake platform reports as its own.
+	URL = "https://api.fake.pixovr.com"
+)
+
+var _ graphql.PlatformClient = (*Client)(nil)
+
+// ErrNotImplemented is returned by the PlatformClient methods the operator
+// does not use.
+var ErrNotImplemented = errors.New("not implemented by the fake platform")
+
+// Client is an in-memory implementation of graphql.PlatformClient. It is safe
+// for concurrent use.
+type Client struct {
+	abstract_client.MockAbstractClient
+
+	mu sync.Mutex
+
+	users     map[int]*platform.User
+	passwords map[int]string
+	inactive  map[int]bool
+	apiKeys   map[int]*platform.APIKey
+	orgs      map[int]*platform.Org
+
+	nextUserID   int
+	nextAPIKeyID int
+	nextOrgID    int
+
+	activeUserID int
+
+	calls map[string]int
+
+	latency     time.Duration
+	faults      []*Fault
+	rateLimit   int
+	rateWindow  time.Duration
+	windowStart time.Time
+	windowCalls int
+}
+
+// New returns a fake platform containing the default org and the operator's
+// own user, authenticated as that user.
+func New() *Client {
+	c := &Client{
+		users:        map[int]*platform.User{},
+		passwords:    map[int]string{},
+		inactive:     map[int]bool{},
+		apiKeys:      map[int]*platform.APIKey{},
+		orgs:         map[int]*platform.Org{},
+		nextUserID:   1,
+		nextAPIKeyID: 1,
+		nextOrgID:    1,
+		calls:        map[string]int{},
+	}
+
+	c.AddOrg(platform.Org{Name: "Pixo"})
+	c.AddUser(platform.User{Username: OperatorUsername, Role: "superadmin", OrgID: DefaultOrgID}, "")
+	c.activeUserID = OperatorUserID
+
+	return c
+}
+
+// Calls returns how many times the named PlatformClient method was invoked,
+// including calls that failed because of an injected fault.
+func (c *Client) Calls(operation string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.calls[operation]
+}
+
+func (c *Client) Login(username, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	user := c.findUserByUsername(username)
+	if user == nil || c.passwords[user.ID] != password {
+		return graphQLError("login", "invalid username or password")
+	}
+
+	if c.inactive[user.ID] {
+		return graphQLError("login", "user is deactivated")
+	}
+
+	c.activeUserID = user.ID
+	return nil
+}
+
+func (c *Client) SetAPIKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, apiKey := range c.apiKeys {
+		if apiKey.Key == key {
+			c.activeUserID = apiKey.UserID
+			return
+		}
+	}
+
+	c.activeUserID = 0
+}
+
+func (c *Client) SetToken(token string) {}
+
+func (c *Client) GetURL() string {
+	return URL
+}
+
+func (c *Client) IsAuthenticated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.activeUserID != 0
+}
+
+func (c *Client) ActiveUserID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.activeUserID
+}
+
+func (c *Client) ActiveOrgID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if user, ok := c.users[c.activeUserID]; ok {
+		return user.OrgID
+	}
+
+	return 0
+}
+
+func (c *Client) GetPlatforms(ctx context.Context) ([]*graphql.Platform, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) GetControlTypes(ctx context.Context) ([]*graphql.ControlType, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) CreateModuleVersion(ctx context.Context, input graphql.ModuleVersion) (*graphql.ModuleVersion, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) GetSession(ctx context.Context, id int) (*graphql.Session, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) CreateSession(ctx context.Context, moduleID int, ipAddress, deviceId string) (*graphql.Session, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) UpdateSession(ctx context.Context, session graphql.Session) (*graphql.Session, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) CreateEvent(ctx context.Context, sessionID int, uuid string, eventType string, data string) (*platform.Event, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) GetMultiplayerServerConfigs(ctx context.Context, params *graphql.MultiplayerServerConfigParams) ([]*graphql.MultiplayerServerConfigQueryParams, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) GetMultiplayerServerVersions(ctx context.Context, params *graphql.MultiplayerServerVersionQueryParams) ([]*graphql.MultiplayerServerVersion, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) GetMultiplayerServerVersion(ctx context.Context, id int) (*graphql.MultiplayerServerVersion, error) {
+	return nil, ErrNotImplemented
+}
+
+func (c *Client) CreateMultiplayerServerVersion(ctx context.Context, input graphql.MultiplayerServerVersion) (*graphql.MultiplayerServerVersion, error) {
+	return nil, ErrNotImplemented
+}
@@ -0,0 +1,152 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	hasura "github.com/hasura/go-graphql-client"
+	"net/http"
+	"time"
+)
+
+// Fault makes matching calls fail with an HTTP status before they touch the
+// in-memory state, the same way a failing load balancer or API pod would.
+type Fault struct {
+	// Operation limits the fault to one PlatformClient method, e.g.
+	// "CreateUser". An empty operation matches every call.
+	Operation string
+	// StatusCode is the HTTP status the platform responds with.
+	StatusCode int
+	// Times is the number of calls that fail before the fault clears itself.
+	// Zero fails every matching call until ClearFaults is called.
+	Times int
+	// Lost applies the call to the platform state before failing it, like a
+	// response lost after the platform committed the change. Only calls that
+	// create something honour it.
+	Lost bool
+}
+
+// InjectFault registers a fault. Faults are matched in the order they were
+// injected.
+func (c *Client) InjectFault(fault Fault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faults = append(c.faults, &fault)
+}
+
+// ClearFaults removes every injected fault, the latency and the rate limit.
+func (c *Client) ClearFaults() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faults = nil
+	c.latency = 0
+	c.rateLimit = 0
+}
+
+// SetLatency delays every call by d.
+func (c *Client) SetLatency(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.latency = d
+}
+
+// SetRateLimit allows at most requests calls per window. Calls over the limit
+// fail with 429 Too Many Requests until the window rolls over.
+func (c *Client) SetRateLimit(requests int, window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rateLimit = requests
+	c.rateWindow = window
+	c.windowStart = time.Now()
+	c.windowCalls = 0
+}
+
+// begin records a call to operation and applies latency, rate limits and
+// faults, then rejects the call if the client is not authenticated. It must
+// be called without holding c.mu.
+func (c *Client) begin(ctx context.Context, operation string) error {
+	c.mu.Lock()
+	c.calls[operation]++
+	latency := c.latency
+	c.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return hasura.Errors{{Message: ctx.Err().Error(), Extensions: map[string]interface{}{"code": hasura.ErrRequestError}}}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rateLimit > 0 {
+		if time.Since(c.windowStart) >= c.rateWindow {
+			c.windowStart = time.Now()
+			c.windowCalls = 0
+		}
+
+		c.windowCalls++
+		if c.windowCalls > c.rateLimit {
+			return statusError(http.StatusTooManyRequests)
+		}
+	}
+
+	if err := c.fault(operation, false); err != nil {
+		return err
+	}
+
+	if c.activeUserID == 0 {
+		return statusError(http.StatusUnauthorized)
+	}
+
+	return nil
+}
+
+// lose fails a call that already changed the platform state if a Lost fault
+// matches it. It must be called with c.mu held.
+func (c *Client) lose(operation string) error {
+	return c.fault(operation, true)
+}
+
+func (c *Client) fault(operation string, lost bool) error {
+	for i, fault := range c.faults {
+		if fault.Lost != lost || (fault.Operation != "" && fault.Operation != operation) {
+			continue
+		}
+
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				c.faults = append(c.faults[:i], c.faults[i+1:]...)
+			}
+		}
+
+		return statusError(fault.StatusCode)
+	}
+
+	return nil
+}
+
+// statusError mirrors the error the GraphQL client returns for a non-200
+// response.
+func statusError(statusCode int) error {
+	status := fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+	return hasura.Errors{{
+		Message:    fmt.Sprintf("%v; body: %q", status, ""),
+		Extensions: map[string]interface{}{"code": hasura.ErrRequestError},
+	}}
+}
+
+// graphQLError mirrors an error reported in the "errors" array of a
+// successful GraphQL response.
+func graphQLError(path string, format string, args ...interface{}) error {
+	return hasura.Errors{{
+		Message: fmt.Sprintf(format, args...),
+		Path:    []interface{}{path},
+	}}
+}
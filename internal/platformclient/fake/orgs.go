@@ -0,0 +1,154 @@
+package fake
+
+import (
+	"context"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"sort"
+	"time"
+)
+
+// AddOrg seeds an org into the platform state and returns a copy of it.
+func (c *Client) AddOrg(org platform.Org) *platform.Org {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.storeOrg(org)
+}
+
+// Orgs returns a copy of every org on the platform ordered by ID.
+func (c *Client) Orgs() []platform.Org {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orgs := make([]platform.Org, 0, len(c.orgs))
+	for _, org := range c.orgs {
+		orgs = append(orgs, *org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+
+	return orgs
+}
+
+func (c *Client) GetOrg(ctx context.Context, id int) (*platform.Org, error) {
+	if err := c.begin(ctx, "GetOrg"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	org, ok := c.orgs[id]
+	if !ok {
+		return nil, graphQLError("org", "org not found")
+	}
+
+	found := *org
+	return &found, nil
+}
+
+func (c *Client) GetOrgByName(ctx context.Context, name string) (*platform.Org, error) {
+	if err := c.begin(ctx, "GetOrgByName"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	org := c.findOrgByName(name)
+	if org == nil {
+		return nil, graphQLError("org", "org not found")
+	}
+
+	found := *org
+	return &found, nil
+}
+
+func (c *Client) CreateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	if err := c.begin(ctx, "CreateOrg"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if org.Name == "" {
+		return nil, graphQLError("createOrg", "name is required")
+	}
+
+	if c.findOrgByName(org.Name) != nil {
+		return nil, graphQLError("createOrg", "org name already exists")
+	}
+
+	return c.storeOrg(org), nil
+}
+
+func (c *Client) UpdateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	if err := c.begin(ctx, "UpdateOrg"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, ok := c.orgs[org.ID]
+	if !ok {
+		return nil, graphQLError("updateOrg", "org not found")
+	}
+
+	if org.Name != "" && org.Name != existing.Name {
+		if c.findOrgByName(org.Name) != nil {
+			return nil, graphQLError("updateOrg", "org name already exists")
+		}
+		existing.Name = org.Name
+	}
+
+	if org.Type != "" {
+		existing.Type = org.Type
+	}
+
+	updated := *existing
+	return &updated, nil
+}
+
+func (c *Client) DeleteOrg(ctx context.Context, id int) error {
+	if err := c.begin(ctx, "DeleteOrg"); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.orgs[id]; !ok {
+		return graphQLError("deleteOrg", "org not found")
+	}
+
+	for _, user := range c.users {
+		if user.OrgID == id {
+			return graphQLError("deleteOrg", "org still has users")
+		}
+	}
+
+	delete(c.orgs, id)
+	return nil
+}
+
+func (c *Client) storeOrg(org platform.Org) *platform.Org {
+	org.ID = c.nextOrgID
+	c.nextOrgID++
+	org.CreatedAt = time.Now().UTC()
+
+	c.orgs[org.ID] = &org
+
+	stored := org
+	return &stored
+}
+
+func (c *Client) findOrgByName(name string) *platform.Org {
+	for _, org := range c.orgs {
+		if org.Name == name {
+			return org
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package fake
+
+import (
+	"context"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"sort"
+	"time"
+)
+
+// AddUser seeds a user directly into the platform state, bypassing faults
+// and validation, and returns a copy of the stored user.
+func (c *Client) AddUser(user platform.User, password string) *platform.User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.storeUser(user, password)
+}
+
+// Users returns a copy of every user on the platform ordered by ID.
+func (c *Client) Users() []platform.User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	users := make([]platform.User, 0, len(c.users))
+	for _, user := range c.users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users
+}
+
+// User returns a copy of the user with the given username, if any.
+func (c *Client) User(username string) (*platform.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	user := c.findUserByUsername(username)
+	if user == nil {
+		return nil, false
+	}
+
+	found := *user
+	return &found, true
+}
+
+// Password returns the password the user was created or last updated with.
+func (c *Client) Password(userID int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.passwords[userID]
+}
+
+func (c *Client) GetUsers(ctx context.Context, orgID int) ([]*platform.User, error) {
+	if err := c.begin(ctx, "GetUsers"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var users []*platform.User
+	for _, user := range c.users {
+		if user.OrgID == orgID {
+			found := *user
+			users = append(users, &found)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (c *Client) GetUserByUsername(ctx context.Context, username string) (*platform.User, error) {
+	if err := c.begin(ctx, "GetUserByUsername"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	user := c.findUserByUsername(username)
+	if user == nil {
+		return nil, graphQLError("user", "user not found")
+	}
+
+	found := *user
+	return &found, nil
+}
+
+func (c *Client) CreateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	if err := c.begin(ctx, "CreateUser"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if user.Username == "" {
+		return nil, graphQLError("createUser", "username is required")
+	}
+
+	if user.Password == "" {
+		return nil, graphQLError("createUser", "password is required")
+	}
+
+	if _, ok := c.orgs[user.OrgID]; !ok {
+		return nil, graphQLError("createUser", "org not found")
+	}
+
+	if c.findUserByUsername(user.Username) != nil {
+		return nil, graphQLError("createUser", "username already exists")
+	}
+
+	stored := c.storeUser(user, user.Password)
+	if err := c.lose("CreateUser"); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+func (c *Client) UpdateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	if err := c.begin(ctx, "UpdateUser"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, ok := c.users[user.ID]
+	if !ok {
+		return nil, graphQLError("updateUser", "user not found")
+	}
+
+	if user.Username != "" && user.Username != existing.Username {
+		if c.findUserByUsername(user.Username) != nil {
+			return nil, graphQLError("updateUser", "username already exists")
+		}
+		existing.Username = user.Username
+	}
+
+	if user.OrgID != 0 && user.OrgID != existing.OrgID {
+		if _, ok = c.orgs[user.OrgID]; !ok {
+			return nil, graphQLError("updateUser", "org not found")
+		}
+		existing.OrgID = user.OrgID
+	}
+
+	if user.FirstName != "" {
+		existing.FirstName = user.FirstName
+	}
+
+	if user.LastName != "" {
+		existing.LastName = user.LastName
+	}
+
+	if user.Role != "" {
+		existing.Role = user.Role
+	}
+
+	if user.Password != "" {
+		c.passwords[existing.ID] = user.Password
+	}
+
+	existing.UpdatedAt = time.Now().UTC()
+
+	updated := *existing
+	return &updated, nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	if err := c.begin(ctx, "DeleteUser"); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.users[id]; !ok {
+		return graphQLError("deleteUser", "user not found")
+	}
+
+	delete(c.users, id)
+	delete(c.passwords, id)
+	delete(c.inactive, id)
+
+	for keyID, apiKey := range c.apiKeys {
+		if apiKey.UserID == id {
+			delete(c.apiKeys, keyID)
+		}
+	}
+
+	if c.activeUserID == id {
+		c.activeUserID = 0
+	}
+
+	return nil
+}
+
+func (c *Client) UserActive(ctx context.Context, id int) (bool, error) {
+	if err := c.begin(ctx, "UserActive"); err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.users[id]; !ok {
+		return false, graphQLError("user", "user not found")
+	}
+
+	return !c.inactive[id], nil
+}
+
+func (c *Client) SetUserActive(ctx context.Context, id int, active bool) error {
+	if err := c.begin(ctx, "SetUserActive"); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.users[id]; !ok {
+		return graphQLError("setUserActive", "user not found")
+	}
+
+	if active {
+		delete(c.inactive, id)
+	} else {
+		c.inactive[id] = true
+	}
+
+	return nil
+}
+
+func (c *Client) storeUser(user platform.User, password string) *platform.User {
+	user.ID = c.nextUserID
+	c.nextUserID++
+
+	user.Password = ""
+	user.CreatedAt = time.Now().UTC()
+	user.UpdatedAt = user.CreatedAt
+	if org, ok := c.orgs[user.OrgID]; ok {
+		user.Org = *org
+	}
+
+	c.users[user.ID] = &user
+	c.passwords[user.ID] = password
+
+	stored := user
+	return &stored
+}
+
+func (c *Client) findUserByUsername(username string) *platform.User {
+	for _, user := range c.users {
+		if user.Username == username {
+			return user
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package platformclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+)
+
+// ErrUnsupported is returned when the wrapped client does not implement an
+// optional capability, such as managing orgs.
+var ErrUnsupported = errors.New("operation not supported by the platform client")
+
+// GraphQLClient extends the upstream GraphQL client with the operations the
+// operator needs that the upstream client does not provide yet. The requests
+// these operations send and the answers they expect are recorded under
+// testdata/contract.
+type GraphQLClient struct {
+	*graphql.GraphQLAPIClient
+}
+
+// NewGraphQLClient wraps client.
+func NewGraphQLClient(client *graphql.GraphQLAPIClient) *GraphQLClient {
+	return &GraphQLClient{GraphQLAPIClient: client}
+}
+
+// exec runs query and decodes the data of the response into response.
+func (c *GraphQLClient) exec(ctx context.Context, query string, variables map[string]interface{}, response interface{}) error {
+	res, err := c.GraphQLAPIClient.Client.ExecRaw(ctx, query, variables)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(res, response)
+}
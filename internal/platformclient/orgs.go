@@ -0,0 +1,216 @@
+package platformclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+)
+
+// OrgClient is implemented by platform clients that can manage orgs.
+type OrgClient interface {
+	GetOrg(ctx context.Context, id int) (*platform.Org, error)
+	GetOrgByName(ctx context.Context, name string) (*platform.Org, error)
+	CreateOrg(ctx context.Context, org platform.Org) (*platform.Org, error)
+	UpdateOrg(ctx context.Context, org platform.Org) (*platform.Org, error)
+	DeleteOrg(ctx context.Context, id int) error
+}
+
+var _ OrgClient = (*GraphQLClient)(nil)
+
+const orgFields = `id name type`
+
+func (c *GraphQLClient) GetOrg(ctx context.Context, id int) (*platform.Org, error) {
+	return c.getOrg(ctx, "GetOrg", map[string]interface{}{"id": id})
+}
+
+func (c *GraphQLClient) GetOrgByName(ctx context.Context, name string) (*platform.Org, error) {
+	return c.getOrg(ctx, "GetOrgByName", map[string]interface{}{"name": name})
+}
+
+func (c *GraphQLClient) getOrg(ctx context.Context, operation string, variables map[string]interface{}) (*platform.Org, error) {
+	query := `query org($id: ID, $name: String) { org(id: $id, name: $name) { ` + orgFields + ` } }`
+
+	var response struct {
+		Org *platform.Org `json:"org"`
+	}
+	if err := c.exec(ctx, query, variables, &response); err != nil {
+		return nil, err
+	}
+
+	// the platform answers a missing org with null rather than an error
+	if response.Org == nil || response.Org.ID == 0 {
+		return nil, &Error{Operation: operation, Class: ClassNotFound, Err: errors.New("org not found")}
+	}
+
+	return response.Org, nil
+}
+
+func (c *GraphQLClient) CreateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	query := `mutation createOrg($input: OrgInput!) { createOrg(input: $input) { ` + orgFields + ` } }`
+
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"name": org.Name,
+			"type": org.Type,
+		},
+	}
+
+	var response struct {
+		Org platform.Org `json:"createOrg"`
+	}
+	if err := c.exec(ctx, query, variables, &response); err != nil {
+		return nil, err
+	}
+
+	return &response.Org, nil
+}
+
+func (c *GraphQLClient) UpdateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	query := `mutation updateOrg($input: OrgInput!) { updateOrg(input: $input) { ` + orgFields + ` } }`
+
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"id":   org.ID,
+			"name": org.Name,
+			"type": org.Type,
+		},
+	}
+
+	var response struct {
+		Org platform.Org `json:"updateOrg"`
+	}
+	if err := c.exec(ctx, query, variables, &response); err != nil {
+		return nil, err
+	}
+
+	return &response.Org, nil
+}
+
+func (c *GraphQLClient) DeleteOrg(ctx context.Context, id int) error {
+	query := `mutation deleteOrg($id: ID!) { deleteOrg(id: $id) }`
+
+	var response struct {
+		Success bool `json:"deleteOrg"`
+	}
+	if err := c.exec(ctx, query, map[string]interface{}{"id": id}, &response); err != nil {
+		return err
+	}
+
+	if !response.Success {
+		return errors.New("failed to delete org")
+	}
+
+	return nil
+}
+
+func (c *ResilientClient) GetOrg(ctx context.Context, id int) (*platform.Org, error) {
+	orgs, err := Orgs(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return call(ctx, c, "GetOrg", true, func(ctx context.Context) (*platform.Org, error) {
+		return orgs.GetOrg(ctx, id)
+	})
+}
+
+func (c *ResilientClient) GetOrgByName(ctx context.Context, name string) (*platform.Org, error) {
+	orgs, err := Orgs(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return call(ctx, c, "GetOrgByName", true, func(ctx context.Context) (*platform.Org, error) {
+		return orgs.GetOrgByName(ctx, name)
+	})
+}
+
+func (c *ResilientClient) CreateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	orgs, err := Orgs(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return call(ctx, c, "CreateOrg", false, func(ctx context.Context) (*platform.Org, error) {
+		return orgs.CreateOrg(ctx, org)
+	})
+}
+
+func (c *ResilientClient) UpdateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	orgs, err := Orgs(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return call(ctx, c, "UpdateOrg", true, func(ctx context.Context) (*platform.Org, error) {
+		return orgs.UpdateOrg(ctx, org)
+	})
+}
+
+func (c *ResilientClient) DeleteOrg(ctx context.Context, id int) error {
+	orgs, err := Orgs(c.PlatformClient)
+	if err != nil {
+		return err
+	}
+
+	_, err = call(ctx, c, "DeleteOrg", true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, orgs.DeleteOrg(ctx, id)
+	})
+	return err
+}
+
+func (c *ReloadableClient) GetOrg(ctx context.Context, id int) (*platform.Org, error) {
+	orgs, err := Orgs(c.current())
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs.GetOrg(ctx, id)
+}
+
+func (c *ReloadableClient) GetOrgByName(ctx context.Context, name string) (*platform.Org, error) {
+	orgs, err := Orgs(c.current())
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs.GetOrgByName(ctx, name)
+}
+
+func (c *ReloadableClient) CreateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	orgs, err := Orgs(c.current())
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs.CreateOrg(ctx, org)
+}
+
+func (c *ReloadableClient) UpdateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	orgs, err := Orgs(c.current())
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs.UpdateOrg(ctx, org)
+}
+
+func (c *ReloadableClient) DeleteOrg(ctx context.Context, id int) error {
+	orgs, err := Orgs(c.current())
+	if err != nil {
+		return err
+	}
+
+	return orgs.DeleteOrg(ctx, id)
+}
+
+// Orgs returns client as an OrgClient, or ErrUnsupported if it cannot manage
+// orgs.
+func Orgs(client interface{}) (OrgClient, error) {
+	if orgs, ok := client.(OrgClient); ok {
+		return orgs, nil
+	}
+
+	return nil, fmt.Errorf("managing orgs: %w", ErrUnsupported)
+}
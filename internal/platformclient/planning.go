@@ -0,0 +1,205 @@
+package platformclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/go-resty/resty/v2"
+	"strings"
+	"sync"
+)
+
+// ErrDryRun is returned by the mutating calls of a PlanningClient that have
+// no meaningful planned result.
+var ErrDryRun = errors.New("not allowed in dry-run mode")
+
+var _ graphql.PlatformClient = (*PlanningClient)(nil)
+
+// PlanningClient is a graphql.PlatformClient for dry runs. Reads go to the
+// wrapped client; mutating calls are described to the record function
+// instead of being sent, and return what the platform would most likely
+// have answered.
+type PlanningClient struct {
+	graphql.PlatformClient
+
+	record func(action string)
+
+	mu    sync.Mutex
+	users map[int]platform.User
+}
+
+// NewPlanningClient wraps client so mutating calls are passed to record.
+func NewPlanningClient(client graphql.PlatformClient, record func(action string)) *PlanningClient {
+	return &PlanningClient{PlatformClient: client, record: record, users: map[int]platform.User{}}
+}
+
+func (c *PlanningClient) recordf(format string, args ...interface{}) {
+	c.record(fmt.Sprintf(format, args...))
+}
+
+// GetUserByUsername remembers the users it returns, so planned updates can
+// name the fields they change.
+func (c *PlanningClient) GetUserByUsername(ctx context.Context, username string) (*platform.User, error) {
+	user, err := c.PlatformClient.GetUserByUsername(ctx, username)
+	if err == nil && user != nil {
+		c.mu.Lock()
+		c.users[user.ID] = *user
+		c.mu.Unlock()
+	}
+
+	return user, err
+}
+
+func (c *PlanningClient) CreateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	c.recordf("create platform user %s in org %d with role %s", user.Username, user.OrgID, user.Role)
+	return &user, nil
+}
+
+func (c *PlanningClient) UpdateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	c.mu.Lock()
+	existing, known := c.users[user.ID]
+	c.mu.Unlock()
+
+	var changes []string
+	if user.Password != "" {
+		changes = append(changes, "reset password")
+	}
+	if known {
+		if user.Role != "" && user.Role != existing.Role {
+			changes = append(changes, fmt.Sprintf("role %s -> %s", existing.Role, user.Role))
+		}
+		if user.OrgID != 0 && user.OrgID != existing.OrgID {
+			changes = append(changes, fmt.Sprintf("org %d -> %d", existing.OrgID, user.OrgID))
+		}
+		if user.FirstName != "" && user.FirstName != existing.FirstName {
+			changes = append(changes, fmt.Sprintf("first name %q -> %q", existing.FirstName, user.FirstName))
+		}
+		if user.LastName != "" && user.LastName != existing.LastName {
+			changes = append(changes, fmt.Sprintf("last name %q -> %q", existing.LastName, user.LastName))
+		}
+	}
+
+	if len(changes) == 0 {
+		c.recordf("update platform user %d", user.ID)
+	} else {
+		c.recordf("update platform user %d: %s", user.ID, strings.Join(changes, ", "))
+	}
+	return &user, nil
+}
+
+func (c *PlanningClient) DeleteUser(ctx context.Context, id int) error {
+	c.recordf("delete platform user %d", id)
+	return nil
+}
+
+func (c *PlanningClient) CreateAPIKey(ctx context.Context, input platform.APIKey) (*platform.APIKey, error) {
+	if input.UserID == 0 {
+		c.recordf("mint api key for the operator's user")
+	} else {
+		c.recordf("mint api key for platform user %d", input.UserID)
+	}
+	return &input, nil
+}
+
+func (c *PlanningClient) DeleteAPIKey(ctx context.Context, id int) error {
+	c.recordf("revoke api key %d", id)
+	return nil
+}
+
+func (c *PlanningClient) GetUsers(ctx context.Context, orgID int) ([]*platform.User, error) {
+	users, err := UserList(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return users.GetUsers(ctx, orgID)
+}
+
+func (c *PlanningClient) UserActive(ctx context.Context, id int) (bool, error) {
+	users, err := UserActivation(c.PlatformClient)
+	if err != nil {
+		return false, err
+	}
+
+	return users.UserActive(ctx, id)
+}
+
+func (c *PlanningClient) SetUserActive(ctx context.Context, id int, active bool) error {
+	if active {
+		c.recordf("reactivate platform user %d", id)
+	} else {
+		c.recordf("deactivate platform user %d", id)
+	}
+	return nil
+}
+
+func (c *PlanningClient) GetOrg(ctx context.Context, id int) (*platform.Org, error) {
+	orgs, err := Orgs(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs.GetOrg(ctx, id)
+}
+
+func (c *PlanningClient) GetOrgByName(ctx context.Context, name string) (*platform.Org, error) {
+	orgs, err := Orgs(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs.GetOrgByName(ctx, name)
+}
+
+func (c *PlanningClient) CreateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	c.recordf("create platform org %s", org.Name)
+	return &org, nil
+}
+
+func (c *PlanningClient) UpdateOrg(ctx context.Context, org platform.Org) (*platform.Org, error) {
+	c.recordf("update platform org %d to name %s, type %s", org.ID, org.Name, org.Type)
+	return &org, nil
+}
+
+func (c *PlanningClient) DeleteOrg(ctx context.Context, id int) error {
+	c.recordf("delete platform org %d", id)
+	return nil
+}
+
+func (c *PlanningClient) Post(path string, body []byte) (*resty.Response, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) Put(path string, body []byte) (*resty.Response, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) Patch(path string, body []byte) (*resty.Response, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) Delete(path string) (*resty.Response, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) CreateModuleVersion(ctx context.Context, input graphql.ModuleVersion) (*graphql.ModuleVersion, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) CreateSession(ctx context.Context, moduleID int, ipAddress, deviceId string) (*graphql.Session, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) UpdateSession(ctx context.Context, session graphql.Session) (*graphql.Session, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) CreateEvent(ctx context.Context, sessionID int, uuid string, eventType string, data string) (*platform.Event, error) {
+	return nil, ErrDryRun
+}
+
+func (c *PlanningClient) CreateMultiplayerServerVersion(ctx context.Context, input graphql.MultiplayerServerVersion) (*graphql.MultiplayerServerVersion, error) {
+	return nil, ErrDryRun
+}
@@ -0,0 +1,76 @@
+package platformclient
+
+import (
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	"sync"
+)
+
+// ConnectionConfig is what the client of a platform connection is built
+// from.
+type ConnectionConfig struct {
+	Lifecycle   string
+	Region      string
+	Internal    bool
+	Credentials Credentials
+}
+
+// ConnectionBuildFunc builds the client of a platform connection.
+type ConnectionBuildFunc func(config ConnectionConfig) (graphql.PlatformClient, error)
+
+// Pool keeps one client per platform connection, so accounts on several
+// lifecycles and regions can be managed by one operator. Each client is
+// wrapped in a ResilientClient with the pool's options, so retries, the
+// rate limit and the circuit breaker apply per connection. A client is
+// rebuilt when its connection's config or credentials change.
+type Pool struct {
+	build   ConnectionBuildFunc
+	options Options
+
+	mu      sync.Mutex
+	clients map[string]pooledClient
+}
+
+type pooledClient struct {
+	config ConnectionConfig
+	client graphql.PlatformClient
+}
+
+func NewPool(build ConnectionBuildFunc, options Options) *Pool {
+	return &Pool{build: build, options: options, clients: map[string]pooledClient{}}
+}
+
+// Get returns the client of the connection key, building it if there is
+// none yet or config changed since it was built.
+func (p *Pool) Get(key string, config ConnectionConfig) (graphql.PlatformClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pooled, ok := p.clients[key]; ok && pooled.config == config {
+		return pooled.client, nil
+	}
+
+	client, err := p.build(config)
+	if err != nil {
+		return nil, err
+	}
+
+	resilient := NewResilientClient(client, p.options)
+	p.clients[key] = pooledClient{config: config, client: resilient}
+	return resilient, nil
+}
+
+// Remove drops the client of the connection key.
+func (p *Pool) Remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.clients, key)
+}
+
+// Len returns the number of pooled clients.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.clients)
+}
@@ -0,0 +1,77 @@
+package platformclient_test
+
+import (
+	"errors"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/internal/platformclient/fake"
+)
+
+var _ = Describe("Pool", func() {
+
+	var (
+		built []platformclient.ConnectionConfig
+		pool  *platformclient.Pool
+	)
+
+	stage := platformclient.ConnectionConfig{Lifecycle: "stage", Credentials: platformclient.Credentials{APIKey: "stage-key"}}
+	saudi := platformclient.ConnectionConfig{Region: "saudi", Credentials: platformclient.Credentials{APIKey: "saudi-key"}}
+
+	BeforeEach(func() {
+		built = nil
+		pool = platformclient.NewPool(func(config platformclient.ConnectionConfig) (graphql.PlatformClient, error) {
+			if config.Credentials.APIKey == "" {
+				return nil, platformclient.ErrNoCredentials
+			}
+
+			built = append(built, config)
+			return fake.New(), nil
+		}, platformclient.DefaultOptions())
+	})
+
+	It("should keep one client per connection", func() {
+		first, err := pool.Get("platform/stage", stage)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := pool.Get("platform/saudi", saudi)
+		Expect(err).NotTo(HaveOccurred())
+		again, err := pool.Get("platform/stage", stage)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(again).To(BeIdenticalTo(first))
+		Expect(second).NotTo(BeIdenticalTo(first))
+		Expect(built).To(Equal([]platformclient.ConnectionConfig{stage, saudi}))
+		Expect(pool.Len()).To(Equal(2))
+	})
+
+	It("should rebuild a client when its connection changes", func() {
+		first, err := pool.Get("platform/stage", stage)
+		Expect(err).NotTo(HaveOccurred())
+
+		rotated := stage
+		rotated.Credentials.APIKey = "rotated-key"
+		second, err := pool.Get("platform/stage", rotated)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).NotTo(BeIdenticalTo(first))
+		Expect(built).To(HaveLen(2))
+	})
+
+	It("should not pool a client that fails to build", func() {
+		_, err := pool.Get("platform/stage", platformclient.ConnectionConfig{Lifecycle: "stage"})
+
+		Expect(errors.Is(err, platformclient.ErrNoCredentials)).To(BeTrue())
+		Expect(pool.Len()).To(BeZero())
+	})
+
+	It("should forget removed connections", func() {
+		_, err := pool.Get("platform/stage", stage)
+		Expect(err).NotTo(HaveOccurred())
+
+		pool.Remove("platform/stage")
+
+		Expect(pool.Len()).To(BeZero())
+	})
+
+})
@@ -0,0 +1,299 @@
+package platformclient
+
+import (
+	"context"
+	"fmt"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"github.com/go-resty/resty/v2"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sync"
+	"time"
+)
+
+// BuildFunc builds a platform client authenticated with credentials.
+type BuildFunc func(credentials Credentials) (graphql.PlatformClient, error)
+
+var _ graphql.PlatformClient = (*ReloadableClient)(nil)
+
+// ReloadableClient is a graphql.PlatformClient backed by credentials mounted
+// from a Secret. It polls the mount directory and rebuilds the underlying
+// client whenever the credentials change, so rotating the operator's API key
+// or password only requires updating the Secret. Kubelet updates Secret
+// volumes by swapping a symlink, which polling the file contents handles
+// without any inotify bookkeeping.
+//
+// Every poll also checks the credentials against the platform; Check reports
+// the result so /readyz fails while the operator cannot authenticate.
+type ReloadableClient struct {
+	dir      string
+	interval time.Duration
+	build    BuildFunc
+
+	mu          sync.RWMutex
+	client      graphql.PlatformClient
+	credentials Credentials
+	invalid     error
+}
+
+// NewReloadableClient loads the credentials in dir and builds the first
+// client. Invalid or missing credentials are not fatal: the client reports
+// them through Check and keeps retrying on every poll once started. Until
+// then calls go through a client built from empty credentials, which the
+// platform rejects as unauthenticated.
+func NewReloadableClient(ctx context.Context, dir string, interval time.Duration, build BuildFunc) (*ReloadableClient, error) {
+	c := &ReloadableClient{dir: dir, interval: interval, build: build}
+	c.Reload(ctx)
+
+	if c.client == nil {
+		client, err := build(Credentials{})
+		if err != nil {
+			return nil, err
+		}
+
+		c.client = client
+	}
+
+	return c, nil
+}
+
+// Start polls the credentials directory until ctx is cancelled. It
+// implements manager.Runnable.
+func (c *ReloadableClient) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Reload(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection returns false so every replica keeps its credentials
+// current and reports its own readiness.
+func (c *ReloadableClient) NeedLeaderElection() bool {
+	return false
+}
+
+// Reload re-reads the credentials, rebuilds the client if they changed and
+// validates them against the platform.
+func (c *ReloadableClient) Reload(ctx context.Context) {
+	logger := log.FromContext(ctx).WithValues("dir", c.dir)
+
+	credentials, err := LoadCredentials(c.dir)
+	if err != nil {
+		logger.Error(err, "failed to load platform credentials")
+		c.setInvalid(err)
+		return
+	}
+
+	c.mu.RLock()
+	changed := credentials != c.credentials
+	c.mu.RUnlock()
+
+	if changed {
+		client, err := c.build(credentials)
+		if err != nil {
+			logger.Error(err, "failed to build platform client")
+			c.setInvalid(fmt.Errorf("authenticating with the platform: %w", err))
+			return
+		}
+
+		c.mu.Lock()
+		c.client = client
+		c.credentials = credentials
+		c.mu.Unlock()
+
+		logger.Info("loaded platform credentials")
+	}
+
+	c.validate(ctx)
+}
+
+// Check implements healthz.Checker. It fails while the credentials are
+// missing or were rejected by the platform.
+func (c *ReloadableClient) Check(_ *http.Request) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.invalid
+}
+
+// validate makes a cheap authenticated call. Only an authentication failure
+// marks the credentials invalid; an unavailable platform says nothing about
+// them, so readiness is left as it was.
+func (c *ReloadableClient) validate(ctx context.Context) {
+	_, err := c.current().GetAPIKeys(ctx, &graphql.APIKeyQueryParams{})
+
+	switch Classify(err) {
+	case "":
+		c.setInvalid(nil)
+	case ClassAuth:
+		log.FromContext(ctx).Error(err, "platform rejected the operator's credentials", "dir", c.dir)
+		c.setInvalid(fmt.Errorf("platform rejected the operator's credentials: %w", err))
+	}
+}
+
+func (c *ReloadableClient) setInvalid(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalid = err
+}
+
+func (c *ReloadableClient) current() graphql.PlatformClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.client
+}
+
+func (c *ReloadableClient) GetIPAddress() (string, error) {
+	return c.current().GetIPAddress()
+}
+
+func (c *ReloadableClient) Login(username, password string) error {
+	return c.current().Login(username, password)
+}
+
+func (c *ReloadableClient) SetAPIKey(key string) {
+	c.current().SetAPIKey(key)
+}
+
+func (c *ReloadableClient) SetToken(token string) {
+	c.current().SetToken(token)
+}
+
+func (c *ReloadableClient) GetToken() string {
+	return c.current().GetToken()
+}
+
+func (c *ReloadableClient) GetURL() string {
+	return c.current().GetURL()
+}
+
+func (c *ReloadableClient) IsAuthenticated() bool {
+	return c.current().IsAuthenticated()
+}
+
+func (c *ReloadableClient) Get(path string) (*resty.Response, error) {
+	return c.current().Get(path)
+}
+
+func (c *ReloadableClient) Post(path string, body []byte) (*resty.Response, error) {
+	return c.current().Post(path, body)
+}
+
+func (c *ReloadableClient) Put(path string, body []byte) (*resty.Response, error) {
+	return c.current().Put(path, body)
+}
+
+func (c *ReloadableClient) Patch(path string, body []byte) (*resty.Response, error) {
+	return c.current().Patch(path, body)
+}
+
+func (c *ReloadableClient) Delete(path string) (*resty.Response, error) {
+	return c.current().Delete(path)
+}
+
+func (c *ReloadableClient) DialWebsocket(endpoint string) (*websocket.Conn, *http.Response, error) {
+	return c.current().DialWebsocket(endpoint)
+}
+
+func (c *ReloadableClient) WriteToWebsocket(message []byte) error {
+	return c.current().WriteToWebsocket(message)
+}
+
+func (c *ReloadableClient) ReadFromWebsocket() (int, []byte, error) {
+	return c.current().ReadFromWebsocket()
+}
+
+func (c *ReloadableClient) CloseWebsocketConnection() error {
+	return c.current().CloseWebsocketConnection()
+}
+
+func (c *ReloadableClient) ActiveUserID() int {
+	return c.current().ActiveUserID()
+}
+
+func (c *ReloadableClient) ActiveOrgID() int {
+	return c.current().ActiveOrgID()
+}
+
+func (c *ReloadableClient) GetUserByUsername(ctx context.Context, username string) (*platform.User, error) {
+	return c.current().GetUserByUsername(ctx, username)
+}
+
+func (c *ReloadableClient) CreateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	return c.current().CreateUser(ctx, user)
+}
+
+func (c *ReloadableClient) UpdateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	return c.current().UpdateUser(ctx, user)
+}
+
+func (c *ReloadableClient) DeleteUser(ctx context.Context, id int) error {
+	return c.current().DeleteUser(ctx, id)
+}
+
+func (c *ReloadableClient) GetAPIKeys(ctx context.Context, params *graphql.APIKeyQueryParams) ([]*platform.APIKey, error) {
+	return c.current().GetAPIKeys(ctx, params)
+}
+
+func (c *ReloadableClient) CreateAPIKey(ctx context.Context, input platform.APIKey) (*platform.APIKey, error) {
+	return c.current().CreateAPIKey(ctx, input)
+}
+
+func (c *ReloadableClient) DeleteAPIKey(ctx context.Context, id int) error {
+	return c.current().DeleteAPIKey(ctx, id)
+}
+
+func (c *ReloadableClient) GetPlatforms(ctx context.Context) ([]*graphql.Platform, error) {
+	return c.current().GetPlatforms(ctx)
+}
+
+func (c *ReloadableClient) GetControlTypes(ctx context.Context) ([]*graphql.ControlType, error) {
+	return c.current().GetControlTypes(ctx)
+}
+
+func (c *ReloadableClient) CreateModuleVersion(ctx context.Context, input graphql.ModuleVersion) (*graphql.ModuleVersion, error) {
+	return c.current().CreateModuleVersion(ctx, input)
+}
+
+func (c *ReloadableClient) GetSession(ctx context.Context, id int) (*graphql.Session, error) {
+	return c.current().GetSession(ctx, id)
+}
+
+func (c *ReloadableClient) CreateSession(ctx context.Context, moduleID int, ipAddress, deviceId string) (*graphql.Session, error) {
+	return c.current().CreateSession(ctx, moduleID, ipAddress, deviceId)
+}
+
+func (c *ReloadableClient) UpdateSession(ctx context.Context, session graphql.Session) (*graphql.Session, error) {
+	return c.current().UpdateSession(ctx, session)
+}
+
+func (c *ReloadableClient) CreateEvent(ctx context.Context, sessionID int, uuid string, eventType string, data string) (*platform.Event, error) {
+	return c.current().CreateEvent(ctx, sessionID, uuid, eventType, data)
+}
+
+func (c *ReloadableClient) GetMultiplayerServerConfigs(ctx context.Context, params *graphql.MultiplayerServerConfigParams) ([]*graphql.MultiplayerServerConfigQueryParams, error) {
+	return c.current().GetMultiplayerServerConfigs(ctx, params)
+}
+
+func (c *ReloadableClient) GetMultiplayerServerVersions(ctx context.Context, params *graphql.MultiplayerServerVersionQueryParams) ([]*graphql.MultiplayerServerVersion, error) {
+	return c.current().GetMultiplayerServerVersions(ctx, params)
+}
+
+func (c *ReloadableClient) GetMultiplayerServerVersion(ctx context.Context, id int) (*graphql.MultiplayerServerVersion, error) {
+	return c.current().GetMultiplayerServerVersion(ctx, id)
+}
+
+func (c *ReloadableClient) CreateMultiplayerServerVersion(ctx context.Context, input graphql.MultiplayerServerVersion) (*graphql.MultiplayerServerVersion, error) {
+	return c.current().CreateMultiplayerServerVersion(ctx, input)
+}
@@ -0,0 +1,129 @@
+package platformclient_test
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/internal/platformclient/fake"
+	"time"
+)
+
+var _ = Describe("ReloadableClient", func() {
+
+	var (
+		ctx        context.Context
+		dir        string
+		fakeClient *fake.Client
+		apiKey     *platform.APIKey
+		builds     int
+		build      platformclient.BuildFunc
+	)
+
+	writeCredential := func(file, value string) {
+		Expect(os.WriteFile(filepath.Join(dir, file), []byte(value+"\n"), 0o600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		ctx = context.Background()
+		dir = GinkgoT().TempDir()
+		fakeClient = fake.New()
+		apiKey, err = fakeClient.CreateAPIKey(ctx, platform.APIKey{})
+		Expect(err).NotTo(HaveOccurred())
+		builds = 0
+		build = func(credentials platformclient.Credentials) (graphql.PlatformClient, error) {
+			builds++
+			if credentials.APIKey == "" && credentials.Username != "" {
+				return fakeClient, fakeClient.Login(credentials.Username, credentials.Password)
+			}
+
+			fakeClient.SetAPIKey(credentials.APIKey)
+			return fakeClient, nil
+		}
+	})
+
+	It("can load an api key from the mounted secret", func() {
+		writeCredential(platformclient.CredentialsAPIKeyFile, apiKey.Key)
+
+		client, err := platformclient.NewReloadableClient(ctx, dir, time.Minute, build)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Check(&http.Request{})).To(Succeed())
+		Expect(client.ActiveUserID()).To(Equal(fake.OperatorUserID))
+	})
+
+	It("can fail readiness while the secret is missing and recover once it is mounted", func() {
+		client, err := platformclient.NewReloadableClient(ctx, dir, time.Minute, build)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Check(&http.Request{})).To(MatchError(ContainSubstring("no platform credentials")))
+		_, err = client.GetUserByUsername(ctx, fake.OperatorUsername)
+		Expect(platformclient.Classify(err)).To(Equal(platformclient.ClassAuth))
+
+		writeCredential(platformclient.CredentialsAPIKeyFile, apiKey.Key)
+		client.Reload(ctx)
+
+		Expect(client.Check(&http.Request{})).To(Succeed())
+		_, err = client.GetUserByUsername(ctx, fake.OperatorUsername)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("can fail readiness when the platform rejects the api key", func() {
+		writeCredential(platformclient.CredentialsAPIKeyFile, "revoked")
+
+		client, err := platformclient.NewReloadableClient(ctx, dir, time.Minute, build)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Check(&http.Request{})).To(MatchError(ContainSubstring("rejected")))
+	})
+
+	It("can rebuild the client only when the credentials change", func() {
+		writeCredential(platformclient.CredentialsAPIKeyFile, apiKey.Key)
+		client, err := platformclient.NewReloadableClient(ctx, dir, time.Minute, build)
+		Expect(err).NotTo(HaveOccurred())
+
+		client.Reload(ctx)
+		Expect(builds).To(Equal(1))
+
+		rotated, err := fakeClient.CreateAPIKey(ctx, platform.APIKey{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fakeClient.DeleteAPIKey(ctx, apiKey.ID)).To(Succeed())
+		writeCredential(platformclient.CredentialsAPIKeyFile, rotated.Key)
+		client.Reload(ctx)
+
+		Expect(builds).To(Equal(2))
+		Expect(client.Check(&http.Request{})).To(Succeed())
+	})
+
+	It("can log in with a username and password", func() {
+		fakeClient.AddUser(platform.User{Username: "operator-bot", OrgID: fake.DefaultOrgID}, "secret")
+		writeCredential(platformclient.CredentialsUsernameFile, "operator-bot")
+		writeCredential(platformclient.CredentialsPasswordFile, "wrong")
+
+		client, err := platformclient.NewReloadableClient(ctx, dir, time.Minute, build)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Check(&http.Request{})).NotTo(Succeed())
+
+		writeCredential(platformclient.CredentialsPasswordFile, "secret")
+		client.Reload(ctx)
+
+		Expect(client.Check(&http.Request{})).To(Succeed())
+	})
+
+	It("can keep its readiness while the platform is unavailable", func() {
+		writeCredential(platformclient.CredentialsAPIKeyFile, apiKey.Key)
+		client, err := platformclient.NewReloadableClient(ctx, dir, time.Minute, build)
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeClient.InjectFault(fake.Fault{StatusCode: http.StatusServiceUnavailable})
+		client.Reload(ctx)
+
+		Expect(client.Check(&http.Request{})).To(Succeed())
+	})
+
+})
@@ -0,0 +1,172 @@
+package platformclient
+
+import (
+	"context"
+	graphql "github.com/PixoVR/pixo-golang-clients/pixo-platform/graphql-api"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+// Options configures a ResilientClient.
+type Options struct {
+	// MaxRetries is how many times an idempotent call is retried after a
+	// retryable failure.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry; it doubles on each
+	// subsequent retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// QPS and Burst limit the calls made to the platform. A QPS of zero
+	// disables the limit.
+	QPS   float64
+	Burst int
+	// BreakerThreshold is the number of consecutive retryable failures that
+	// opens the circuit breaker. Zero disables the breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before it lets a
+	// probe call through.
+	BreakerCooldown time.Duration
+}
+
+// DefaultOptions returns the options used when no flags override them.
+func DefaultOptions() Options {
+	return Options{
+		MaxRetries:       3,
+		InitialBackoff:   200 * time.Millisecond,
+		MaxBackoff:       5 * time.Second,
+		QPS:              10,
+		Burst:            20,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+var _ graphql.PlatformClient = (*ResilientClient)(nil)
+
+// ResilientClient decorates a graphql.PlatformClient with a client-side rate
+// limit, bounded retries with exponential backoff, and a circuit breaker
+// shared by every caller. The user and API key methods return *Error so the
+// caller can tell transient failures from permanent ones.
+//
+// Creates are never retried here: if a create timed out after the platform
+// committed it, retrying would produce a duplicate. The caller re-reads
+// platform state on its next reconcile instead.
+type ResilientClient struct {
+	graphql.PlatformClient
+
+	options Options
+	limiter *rate.Limiter
+	breaker *breaker
+}
+
+// NewResilientClient wraps client.
+func NewResilientClient(client graphql.PlatformClient, options Options) *ResilientClient {
+	c := &ResilientClient{
+		PlatformClient: client,
+		options:        options,
+		breaker:        newBreaker(options.BreakerThreshold, options.BreakerCooldown),
+	}
+
+	if options.QPS > 0 {
+		c.limiter = rate.NewLimiter(rate.Limit(options.QPS), max(options.Burst, 1))
+	}
+
+	return c
+}
+
+// BreakerState returns the circuit breaker state: "closed", "open" or
+// "half-open".
+func (c *ResilientClient) BreakerState() string {
+	return c.breaker.state()
+}
+
+func (c *ResilientClient) GetUserByUsername(ctx context.Context, username string) (*platform.User, error) {
+	return call(ctx, c, "GetUserByUsername", true, func(ctx context.Context) (*platform.User, error) {
+		return c.PlatformClient.GetUserByUsername(ctx, username)
+	})
+}
+
+func (c *ResilientClient) CreateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	return call(ctx, c, "CreateUser", false, func(ctx context.Context) (*platform.User, error) {
+		return c.PlatformClient.CreateUser(ctx, user)
+	})
+}
+
+func (c *ResilientClient) UpdateUser(ctx context.Context, user platform.User) (*platform.User, error) {
+	return call(ctx, c, "UpdateUser", true, func(ctx context.Context) (*platform.User, error) {
+		return c.PlatformClient.UpdateUser(ctx, user)
+	})
+}
+
+func (c *ResilientClient) DeleteUser(ctx context.Context, id int) error {
+	_, err := call(ctx, c, "DeleteUser", true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.PlatformClient.DeleteUser(ctx, id)
+	})
+	return err
+}
+
+func (c *ResilientClient) GetAPIKeys(ctx context.Context, params *graphql.APIKeyQueryParams) ([]*platform.APIKey, error) {
+	return call(ctx, c, "GetAPIKeys", true, func(ctx context.Context) ([]*platform.APIKey, error) {
+		return c.PlatformClient.GetAPIKeys(ctx, params)
+	})
+}
+
+func (c *ResilientClient) CreateAPIKey(ctx context.Context, input platform.APIKey) (*platform.APIKey, error) {
+	return call(ctx, c, "CreateAPIKey", false, func(ctx context.Context) (*platform.APIKey, error) {
+		return c.PlatformClient.CreateAPIKey(ctx, input)
+	})
+}
+
+func (c *ResilientClient) DeleteAPIKey(ctx context.Context, id int) error {
+	_, err := call(ctx, c, "DeleteAPIKey", true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.PlatformClient.DeleteAPIKey(ctx, id)
+	})
+	return err
+}
+
+func call[T any](ctx context.Context, c *ResilientClient, operation string, idempotent bool, fn func(context.Context) (T, error)) (T, error) {
+	var zero T
+
+	backoff := wait.Backoff{
+		Duration: c.options.InitialBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    c.options.MaxRetries + 1,
+		Cap:      c.options.MaxBackoff,
+	}
+
+	for attempt := 0; ; attempt++ {
+		// wait for the limiter before asking the breaker, so a probe it lets
+		// through is always made and its outcome recorded
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return zero, &Error{Operation: operation, Class: ClassRetryable, Err: err}
+			}
+		}
+
+		if ok, retryAfter := c.breaker.allow(); !ok {
+			return zero, &Error{Operation: operation, Class: ClassRetryable, RetryAfter: retryAfter, Err: ErrCircuitOpen}
+		}
+
+		result, err := fn(ctx)
+		class := Classify(err)
+		c.breaker.record(class == ClassRetryable)
+
+		if err == nil {
+			return result, nil
+		}
+
+		classified := &Error{Operation: operation, Class: class, Err: err}
+		if class != ClassRetryable || !idempotent || attempt >= c.options.MaxRetries {
+			return zero, classified
+		}
+
+		select {
+		case <-time.After(backoff.Step()):
+		case <-ctx.Done():
+			return zero, classified
+		}
+	}
+}
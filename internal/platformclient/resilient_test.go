@@ -0,0 +1,149 @@
+package platformclient_test
+
+import (
+	"context"
+	"errors"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net/http"
+	"pixovr.com/platform/internal/platformclient"
+	"pixovr.com/platform/internal/platformclient/fake"
+	"time"
+)
+
+var _ = Describe("ResilientClient", func() {
+
+	var (
+		ctx         context.Context
+		fakeClient  *fake.Client
+		client      *platformclient.ResilientClient
+		testOptions platformclient.Options
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fakeClient = fake.New()
+		testOptions = platformclient.Options{
+			MaxRetries:       3,
+			InitialBackoff:   time.Millisecond,
+			MaxBackoff:       5 * time.Millisecond,
+			BreakerThreshold: 10,
+			BreakerCooldown:  50 * time.Millisecond,
+		}
+		client = platformclient.NewResilientClient(fakeClient, testOptions)
+	})
+
+	DescribeTable("can classify platform errors",
+		func(statusCode int, class platformclient.ErrorClass) {
+			fakeClient.InjectFault(fake.Fault{StatusCode: statusCode})
+			_, err := fakeClient.GetUserByUsername(ctx, "anyone")
+			Expect(platformclient.Classify(err)).To(Equal(class))
+		},
+		Entry("service unavailable", http.StatusServiceUnavailable, platformclient.ClassRetryable),
+		Entry("too many requests", http.StatusTooManyRequests, platformclient.ClassRetryable),
+		Entry("unauthorized", http.StatusUnauthorized, platformclient.ClassAuth),
+		Entry("forbidden", http.StatusForbidden, platformclient.ClassAuth),
+		Entry("not found", http.StatusNotFound, platformclient.ClassNotFound),
+		Entry("conflict", http.StatusConflict, platformclient.ClassConflict),
+		Entry("bad request", http.StatusBadRequest, platformclient.ClassUnknown),
+	)
+
+	It("can classify graphql errors by message", func() {
+		_, err := fakeClient.GetUserByUsername(ctx, "missing")
+		Expect(platformclient.IsNotFound(err)).To(BeTrue())
+
+		_, err = fakeClient.CreateUser(ctx, platform.User{Username: fake.OperatorUsername, Password: "pw", OrgID: fake.DefaultOrgID})
+		Expect(platformclient.Classify(err)).To(Equal(platformclient.ClassConflict))
+	})
+
+	It("can leave errors that did not come from the platform unclassified", func() {
+		Expect(platformclient.Classify(errors.New("error getting user"))).To(Equal(platformclient.ClassUnknown))
+		notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "missing")
+		Expect(platformclient.Classify(notFound)).To(Equal(platformclient.ClassUnknown))
+	})
+
+	It("can retry idempotent calls until they succeed", func() {
+		fakeClient.InjectFault(fake.Fault{Operation: "GetUserByUsername", StatusCode: http.StatusBadGateway, Times: 2})
+
+		user, err := client.GetUserByUsername(ctx, fake.OperatorUsername)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.ID).To(Equal(fake.OperatorUserID))
+		Expect(fakeClient.Calls("GetUserByUsername")).To(Equal(3))
+	})
+
+	It("can give up after the configured number of retries", func() {
+		fakeClient.InjectFault(fake.Fault{Operation: "DeleteAPIKey", StatusCode: http.StatusServiceUnavailable})
+
+		err := client.DeleteAPIKey(ctx, 1)
+
+		Expect(platformclient.IsRetryable(err)).To(BeTrue())
+		Expect(fakeClient.Calls("DeleteAPIKey")).To(Equal(testOptions.MaxRetries + 1))
+	})
+
+	It("can avoid retrying creates that may have reached the platform", func() {
+		fakeClient.InjectFault(fake.Fault{Operation: "CreateUser", StatusCode: http.StatusGatewayTimeout, Times: 1})
+
+		_, err := client.CreateUser(ctx, platform.User{Username: "new-user", Password: "pw", OrgID: fake.DefaultOrgID})
+
+		Expect(platformclient.IsRetryable(err)).To(BeTrue())
+		Expect(fakeClient.Calls("CreateUser")).To(Equal(1))
+	})
+
+	It("can avoid retrying permanent errors", func() {
+		_, err := client.GetUserByUsername(ctx, "missing")
+
+		Expect(platformclient.IsNotFound(err)).To(BeTrue())
+		Expect(fakeClient.Calls("GetUserByUsername")).To(Equal(1))
+	})
+
+	It("can open the circuit breaker and probe again after the cooldown", func() {
+		testOptions.MaxRetries = 0
+		testOptions.BreakerThreshold = 2
+		client = platformclient.NewResilientClient(fakeClient, testOptions)
+		fakeClient.InjectFault(fake.Fault{StatusCode: http.StatusServiceUnavailable, Times: 2})
+
+		_, _ = client.GetUserByUsername(ctx, fake.OperatorUsername)
+		_, _ = client.GetUserByUsername(ctx, fake.OperatorUsername)
+		_, err := client.GetUserByUsername(ctx, fake.OperatorUsername)
+
+		Expect(err).To(MatchError(platformclient.ErrCircuitOpen))
+		retryAfter, ok := platformclient.RetryAfter(err)
+		Expect(ok).To(BeTrue())
+		Expect(retryAfter).To(BeNumerically("<=", testOptions.BreakerCooldown))
+		Expect(fakeClient.Calls("GetUserByUsername")).To(Equal(2))
+		Expect(client.BreakerState()).To(Equal("open"))
+
+		Eventually(client.BreakerState).Should(Equal("half-open"))
+		_, err = client.GetUserByUsername(ctx, fake.OperatorUsername)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.BreakerState()).To(Equal("closed"))
+	})
+
+	It("can probe again when the context of a probe is cancelled while rate limited", func() {
+		testOptions.MaxRetries = 0
+		testOptions.BreakerThreshold = 2
+		testOptions.QPS = 0.001
+		testOptions.Burst = 3
+		client = platformclient.NewResilientClient(fakeClient, testOptions)
+		fakeClient.InjectFault(fake.Fault{StatusCode: http.StatusServiceUnavailable, Times: 2})
+		_, _ = client.GetUserByUsername(ctx, fake.OperatorUsername)
+		_, _ = client.GetUserByUsername(ctx, fake.OperatorUsername)
+		Eventually(client.BreakerState).Should(Equal("half-open"))
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := client.GetUserByUsername(cancelled, fake.OperatorUsername)
+		Expect(err).To(MatchError(context.Canceled))
+
+		_, err = client.GetUserByUsername(ctx, fake.OperatorUsername)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.BreakerState()).To(Equal("closed"))
+	})
+
+})
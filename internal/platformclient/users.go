@@ -0,0 +1,159 @@
+package platformclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	platform "github.com/PixoVR/pixo-golang-clients/pixo-platform/primary-api"
+)
+
+// UserActivationClient is implemented by platform clients that can
+// deactivate users without deleting them. A deactivated user cannot sign in
+// or use its api keys until it is reactivated.
+type UserActivationClient interface {
+	UserActive(ctx context.Context, id int) (bool, error)
+	SetUserActive(ctx context.Context, id int, active bool) error
+}
+
+// UserListClient is implemented by platform clients that can list the users
+// of an org.
+type UserListClient interface {
+	GetUsers(ctx context.Context, orgID int) ([]*platform.User, error)
+}
+
+var (
+	_ UserActivationClient = (*GraphQLClient)(nil)
+	_ UserListClient       = (*GraphQLClient)(nil)
+)
+
+func (c *GraphQLClient) GetUsers(ctx context.Context, orgID int) ([]*platform.User, error) {
+	query := `query users($params: UserParams) { users(params: $params) { id username firstName lastName role orgId } }`
+
+	var response struct {
+		Users []*platform.User `json:"users"`
+	}
+	if err := c.exec(ctx, query, map[string]interface{}{"params": map[string]interface{}{"orgId": orgID}}, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Users, nil
+}
+
+func (c *GraphQLClient) UserActive(ctx context.Context, id int) (bool, error) {
+	query := `query user($id: ID!) { user(id: $id) { id active } }`
+
+	var response struct {
+		User *struct {
+			ID     int  `json:"id"`
+			Active bool `json:"active"`
+		} `json:"user"`
+	}
+	if err := c.exec(ctx, query, map[string]interface{}{"id": id}, &response); err != nil {
+		return false, err
+	}
+
+	// the platform answers a missing user with null rather than an error
+	if response.User == nil || response.User.ID == 0 {
+		return false, &Error{Operation: "UserActive", Class: ClassNotFound, Err: errors.New("user not found")}
+	}
+
+	return response.User.Active, nil
+}
+
+func (c *GraphQLClient) SetUserActive(ctx context.Context, id int, active bool) error {
+	query := `mutation setUserActive($id: ID!, $active: Boolean!) { setUserActive(id: $id, active: $active) }`
+
+	var response struct {
+		Success bool `json:"setUserActive"`
+	}
+	if err := c.exec(ctx, query, map[string]interface{}{"id": id, "active": active}, &response); err != nil {
+		return err
+	}
+
+	if !response.Success {
+		return errors.New("failed to set user active")
+	}
+
+	return nil
+}
+
+func (c *ResilientClient) GetUsers(ctx context.Context, orgID int) ([]*platform.User, error) {
+	users, err := UserList(c.PlatformClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return call(ctx, c, "GetUsers", true, func(ctx context.Context) ([]*platform.User, error) {
+		return users.GetUsers(ctx, orgID)
+	})
+}
+
+func (c *ResilientClient) UserActive(ctx context.Context, id int) (bool, error) {
+	users, err := UserActivation(c.PlatformClient)
+	if err != nil {
+		return false, err
+	}
+
+	return call(ctx, c, "UserActive", true, func(ctx context.Context) (bool, error) {
+		return users.UserActive(ctx, id)
+	})
+}
+
+func (c *ResilientClient) SetUserActive(ctx context.Context, id int, active bool) error {
+	users, err := UserActivation(c.PlatformClient)
+	if err != nil {
+		return err
+	}
+
+	_, err = call(ctx, c, "SetUserActive", true, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, users.SetUserActive(ctx, id, active)
+	})
+	return err
+}
+
+func (c *ReloadableClient) GetUsers(ctx context.Context, orgID int) ([]*platform.User, error) {
+	users, err := UserList(c.current())
+	if err != nil {
+		return nil, err
+	}
+
+	return users.GetUsers(ctx, orgID)
+}
+
+func (c *ReloadableClient) UserActive(ctx context.Context, id int) (bool, error) {
+	users, err := UserActivation(c.current())
+	if err != nil {
+		return false, err
+	}
+
+	return users.UserActive(ctx, id)
+}
+
+func (c *ReloadableClient) SetUserActive(ctx context.Context, id int, active bool) error {
+	users, err := UserActivation(c.current())
+	if err != nil {
+		return err
+	}
+
+	return users.SetUserActive(ctx, id, active)
+}
+
+// UserActivation returns client as a UserActivationClient, or ErrUnsupported
+// if it cannot deactivate users.
+func UserActivation(client interface{}) (UserActivationClient, error) {
+	if users, ok := client.(UserActivationClient); ok {
+		return users, nil
+	}
+
+	return nil, fmt.Errorf("deactivating users: %w", ErrUnsupported)
+}
+
+// UserList returns client as a UserListClient, or ErrUnsupported if it cannot
+// list users.
+func UserList(client interface{}) (UserListClient, error) {
+	if users, ok := client.(UserListClient); ok {
+		return users, nil
+	}
+
+	return nil, fmt.Errorf("listing users: %w", ErrUnsupported)
+}
@@ -0,0 +1,34 @@
+package secretsink
+
+import (
+	"context"
+	"net/http"
+)
+
+// HTTP writes the credentials to an endpoint that stores them: a PUT with the
+// credentials as JSON replaces them and a DELETE removes them.
+type HTTP struct {
+	URL string
+	// Token is sent as a bearer token when it is set.
+	Token  string
+	Client *http.Client
+}
+
+var _ Sink = (*HTTP)(nil)
+
+func (h *HTTP) Write(ctx context.Context, credentials Credentials) error {
+	return do(ctx, h.Client, http.MethodPut, h.URL, h.header(), credentials, false)
+}
+
+func (h *HTTP) Delete(ctx context.Context) error {
+	return do(ctx, h.Client, http.MethodDelete, h.URL, h.header(), nil, true)
+}
+
+func (h *HTTP) header() http.Header {
+	header := http.Header{}
+	if h.Token != "" {
+		header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	return header
+}
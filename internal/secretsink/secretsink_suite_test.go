@@ -0,0 +1,14 @@
+package secretsink_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSecretSink(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Secret Sink Suite")
+}
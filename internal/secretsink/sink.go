@@ -0,0 +1,87 @@
+// Package secretsink pushes service account credentials to secret stores
+// outside the cluster, for consumers that can't read a Kubernetes Secret.
+package secretsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Credentials are the values written to a sink.
+type Credentials struct {
+	Username    string `json:"username"`
+	APIKey      string `json:"apiKey"`
+	APIKeyID    int    `json:"apiKeyId"`
+	UserID      int    `json:"userId"`
+	PlatformURL string `json:"platformUrl,omitempty"`
+}
+
+// Sink is an external store the credentials of one service account are kept
+// in.
+type Sink interface {
+	// Write replaces the credentials held by the sink.
+	Write(ctx context.Context, credentials Credentials) error
+	// Delete removes the credentials from the sink. Deleting credentials
+	// that aren't there is not an error.
+	Delete(ctx context.Context) error
+}
+
+// StatusError is returned when a sink answers with an unexpected HTTP status.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s %s: unexpected status %d", e.Method, e.URL, e.StatusCode)
+	}
+
+	return fmt.Sprintf("%s %s: unexpected status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// do sends a request with an optional JSON body and header and fails on any
+// status other than 2xx, or 404 when allowNotFound is set.
+func do(ctx context.Context, client *http.Client, method, url string, header http.Header, body interface{}, allowNotFound bool) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 == 2 || (allowNotFound && res.StatusCode == http.StatusNotFound) {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return &StatusError{Method: method, URL: url, StatusCode: res.StatusCode, Body: string(bytes.TrimSpace(message))}
+}
@@ -0,0 +1,80 @@
+package secretsink_test
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"pixovr.com/platform/internal/secretsink"
+	"pixovr.com/platform/internal/secretsink/sinktest"
+)
+
+var _ = Describe("Sinks", func() {
+
+	var (
+		ctx         context.Context
+		credentials secretsink.Credentials
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		credentials = secretsink.Credentials{Username: "uploader", APIKey: "key-1", APIKeyID: 1, UserID: 7, PlatformURL: "https://api.pixovr.com"}
+	})
+
+	It("can write to and clear a Vault KV path", func() {
+		vault := sinktest.NewVault("root")
+		DeferCleanup(vault.Close)
+		sink := &secretsink.Vault{Address: vault.URL, Path: "ci/uploader", Token: "root"}
+
+		Expect(sink.Write(ctx, credentials)).To(Succeed())
+
+		document, ok := vault.Get("ci/uploader")
+		Expect(ok).To(BeTrue())
+		Expect(document).To(HaveKeyWithValue("apiKey", "key-1"))
+		Expect(document).To(HaveKeyWithValue("username", "uploader"))
+
+		Expect(sink.Delete(ctx)).To(Succeed())
+		_, ok = vault.Get("ci/uploader")
+		Expect(ok).To(BeFalse())
+		Expect(sink.Delete(ctx)).To(Succeed())
+	})
+
+	It("can report a rejected Vault token", func() {
+		vault := sinktest.NewVault("root")
+		DeferCleanup(vault.Close)
+		sink := &secretsink.Vault{Address: vault.URL, Path: "ci/uploader", Token: "wrong"}
+
+		err := sink.Write(ctx, credentials)
+
+		var statusErr *secretsink.StatusError
+		Expect(err).To(BeAssignableToTypeOf(statusErr))
+		Expect(err.(*secretsink.StatusError).StatusCode).To(Equal(http.StatusForbidden))
+	})
+
+	It("can write to and clear an HTTP endpoint with a bearer token", func() {
+		store := sinktest.NewHTTP("token")
+		DeferCleanup(store.Close)
+		sink := &secretsink.HTTP{URL: store.URL + "/credentials/uploader", Token: "token"}
+
+		Expect(sink.Write(ctx, credentials)).To(Succeed())
+
+		document, ok := store.Get("/credentials/uploader")
+		Expect(ok).To(BeTrue())
+		Expect(document).To(HaveKeyWithValue("apiKey", "key-1"))
+		Expect(document).To(HaveKeyWithValue("apiKeyId", BeNumerically("==", 1)))
+
+		Expect(sink.Delete(ctx)).To(Succeed())
+		Expect(sink.Delete(ctx)).To(Succeed())
+	})
+
+	It("can fail on server errors", func() {
+		store := sinktest.NewHTTP("")
+		DeferCleanup(store.Close)
+		store.Fail(1)
+		sink := &secretsink.HTTP{URL: store.URL + "/credentials/uploader"}
+
+		Expect(sink.Write(ctx, credentials)).To(MatchError(ContainSubstring("503")))
+		Expect(sink.Write(ctx, credentials)).To(Succeed())
+	})
+
+})
@@ -0,0 +1,111 @@
+// Package sinktest provides in-memory stand-ins for the stores the secret
+// sinks write to, served over httptest.
+package sinktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Store is an HTTP server that keeps the JSON documents written to it.
+type Store struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	token     string
+	documents map[string]map[string]interface{}
+	failures  int
+}
+
+// Get returns the document stored under path, if any.
+func (s *Store) Get(path string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document, ok := s.documents[path]
+	return document, ok
+}
+
+// Fail makes the next n requests fail with a 503.
+func (s *Store) Fail(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = n
+}
+
+func newStore(token, authHeader, authPrefix string, handle func(s *Store, w http.ResponseWriter, r *http.Request)) *Store {
+	s := &Store{token: token, documents: map[string]map[string]interface{}{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.failures > 0 {
+			s.failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if s.token != "" && r.Header.Get(authHeader) != authPrefix+s.token {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+
+		handle(s, w, r)
+	}))
+
+	return s
+}
+
+// NewVault starts a stand-in for the KV version 2 engine of a Vault server
+// mounted at "secret". Documents are keyed by their path within the mount.
+func NewVault(token string) *Store {
+	return newStore(token, "X-Vault-Token", "", func(s *Store, w http.ResponseWriter, r *http.Request) {
+		endpoint, path, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/secret/"), "/")
+		switch {
+		case ok && endpoint == "data" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+			body := struct {
+				Data map[string]interface{} `json:"data"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.documents[path] = body.Data
+			w.WriteHeader(http.StatusOK)
+		case ok && endpoint == "metadata" && r.Method == http.MethodDelete:
+			delete(s.documents, path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// NewHTTP starts a stand-in for a generic HTTP sink. Documents are keyed by
+// the request path.
+func NewHTTP(token string) *Store {
+	return newStore(token, "Authorization", "Bearer ", func(s *Store, w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			document := map[string]interface{}{}
+			if err := json.NewDecoder(r.Body).Decode(&document); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.documents[r.URL.Path] = document
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if _, ok := s.documents[r.URL.Path]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			delete(s.documents, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
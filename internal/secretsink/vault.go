@@ -0,0 +1,57 @@
+package secretsink
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultVaultMount is the mount of the KV version 2 engine in a Vault dev
+// server.
+const DefaultVaultMount = "secret"
+
+// Vault writes the credentials to a path in a HashiCorp Vault KV version 2
+// engine.
+type Vault struct {
+	Address string
+	Mount   string
+	Path    string
+	Token   string
+	Client  *http.Client
+}
+
+var _ Sink = (*Vault)(nil)
+
+func (v *Vault) Write(ctx context.Context, credentials Credentials) error {
+	body := map[string]interface{}{
+		"data": map[string]interface{}{
+			"username":    credentials.Username,
+			"apiKey":      credentials.APIKey,
+			"apiKeyId":    credentials.APIKeyID,
+			"userId":      credentials.UserID,
+			"platformUrl": credentials.PlatformURL,
+		},
+	}
+
+	return do(ctx, v.Client, http.MethodPost, v.url("data"), v.header(), body, false)
+}
+
+// Delete removes every version of the secret, so revoked keys can't be read
+// back from its history.
+func (v *Vault) Delete(ctx context.Context) error {
+	return do(ctx, v.Client, http.MethodDelete, v.url("metadata"), v.header(), nil, true)
+}
+
+func (v *Vault) url(endpoint string) string {
+	mount := v.Mount
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+
+	return fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimSuffix(v.Address, "/"), strings.Trim(mount, "/"), endpoint, strings.Trim(v.Path, "/"))
+}
+
+func (v *Vault) header() http.Header {
+	return http.Header{"X-Vault-Token": []string{v.Token}}
+}
@@ -0,0 +1,178 @@
+// Package tokenexchange lets workloads trade the projected Kubernetes
+// ServiceAccount token of their pod for a short-lived Pixo platform api key,
+// issued by the platform operator for the PixoServiceAccount bound to the
+// pod's ServiceAccount. Mount a projected token with the operator's audience
+// and the CA of the exchange's serving certificate, and call APIKey whenever
+// a platform request needs one:
+//
+//	client := tokenexchange.New("https://platform-operator-token-exchange.platform-operator-system.svc:8444")
+//	client.HTTPClient, err = tokenexchange.NewHTTPClient("/var/run/secrets/pixovr.com/ca.crt")
+//	apiKey, err := client.APIKey(ctx)
+package tokenexchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Path is where the operator serves the exchange.
+	Path = "/v1/token"
+	// DefaultTokenPath is where the projected ServiceAccount token is read
+	// from unless Client.TokenPath is set.
+	DefaultTokenPath = "/var/run/secrets/pixovr.com/token"
+	// DefaultAudience is the audience the operator expects the projected
+	// token to be issued for.
+	DefaultAudience = "platform.pixovr.com"
+)
+
+// Request is the body of an exchange.
+type Request struct {
+	// TTLSeconds asks for a credential that lives this long. The operator
+	// caps it at its maximum and uses its default when it is zero.
+	TTLSeconds int `json:"ttlSeconds,omitempty"`
+}
+
+// Credential is a short-lived api key of the bound PixoServiceAccount's
+// platform user. It is revoked once it expires.
+type Credential struct {
+	Username  string    `json:"username"`
+	APIKey    string    `json:"apiKey"`
+	APIKeyID  int       `json:"apiKeyId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ErrorResponse is the body of a failed exchange.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Client exchanges the pod's token and caches the credential until shortly
+// before it expires. It is safe for concurrent use.
+type Client struct {
+	// URL is the base URL of the operator's exchange service.
+	URL string
+	// TokenPath is the file the projected token is read from on every
+	// exchange, so a token the kubelet rotated is picked up.
+	TokenPath string
+	// TTL is the lifetime asked for. Zero uses the operator's default.
+	TTL time.Duration
+	// RefreshBefore is how long before expiry a cached credential is
+	// replaced.
+	RefreshBefore time.Duration
+	HTTPClient    *http.Client
+
+	mu         sync.Mutex
+	credential *Credential
+}
+
+// New returns a client for the exchange service at url that reads the token
+// from DefaultTokenPath.
+func New(url string) *Client {
+	return &Client{
+		URL:           strings.TrimRight(url, "/"),
+		TokenPath:     DefaultTokenPath,
+		RefreshBefore: time.Minute,
+		HTTPClient:    http.DefaultClient,
+	}
+}
+
+// NewHTTPClient returns an HTTP client that verifies the exchange's serving
+// certificate with the PEM encoded CA certificates in caFile.
+func NewHTTPClient(caFile string) (*http.Client, error) {
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading token exchange CA: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+	return &http.Client{Transport: transport}, nil
+}
+
+// APIKey returns a live api key, exchanging the token for a new one when
+// the cached one is about to expire.
+func (c *Client) APIKey(ctx context.Context) (string, error) {
+	credential, err := c.Credential(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return credential.APIKey, nil
+}
+
+// Credential returns the cached credential, or exchanges the token for a
+// new one when there is none or it is about to expire.
+func (c *Client) Credential(ctx context.Context) (*Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.credential != nil && time.Until(c.credential.ExpiresAt) > c.RefreshBefore {
+		return c.credential, nil
+	}
+
+	credential, err := c.Exchange(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.credential = credential
+	return credential, nil
+}
+
+// Exchange trades the token for a new credential without using the cache.
+func (c *Client) Exchange(ctx context.Context) (*Credential, error) {
+	token, err := os.ReadFile(c.TokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+
+	body, err := json.Marshal(Request{TTLSeconds: int(c.TTL.Seconds())})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&failure)
+		return nil, fmt.Errorf("token exchange failed with status %d: %s", resp.StatusCode, failure.Error)
+	}
+
+	credential := &Credential{}
+	if err = json.NewDecoder(resp.Body).Decode(credential); err != nil {
+		return nil, fmt.Errorf("decoding token exchange response: %w", err)
+	}
+
+	return credential, nil
+}